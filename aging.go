@@ -0,0 +1,158 @@
+package worker_pool
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// AgingConfig — старение приоритетов в очереди с приоритетами
+// (см. WithPriorityAging): за каждые Rate ожидания эффективный приоритет
+// задачи растёт на единицу, но не больше чем на MaxBoost. Так задача
+// с низким приоритетом рано или поздно обгоняет поток новых задач
+// с высоким: для гарантии MaxBoost должен быть не меньше разницы
+// приоритетов; MaxBoost <= 0 — без ограничения.
+type AgingConfig struct {
+	Rate     time.Duration
+	MaxBoost int
+}
+
+// boost — прибавка к приоритету за ожидание waited
+func (c AgingConfig) boost(waited time.Duration) int {
+	if c.Rate <= 0 || waited <= 0 {
+		return 0
+	}
+	b := int(waited / c.Rate)
+	if c.MaxBoost > 0 && b > c.MaxBoost {
+		b = c.MaxBoost
+	}
+	return b
+}
+
+// agingEntry — задача в agingStore, момент её постановки в очередь
+// и прибавка к приоритету на момент последнего пересчёта
+type agingEntry struct {
+	it    *queueItem
+	at    time.Time
+	boost int
+}
+
+func (e agingEntry) effective() int { return e.it.priority + e.boost }
+
+// agingStore — priorityStore со старением: прибавки за ожидание
+// пересчитываются не чаще раза за Rate (см. age), так что между
+// пересчётами выдача стоит O(log n), а прибавка отстаёт от ожидания
+// меньше чем на Rate
+type agingStore struct {
+	cfg   AgingConfig
+	clock Clock
+	aged  time.Time // момент последнего пересчёта прибавок
+	items agingHeap
+}
+
+func newAgingStore(cfg AgingConfig, clock Clock) *agingStore {
+	return &agingStore{cfg: cfg, clock: clock, aged: clock.Now()}
+}
+
+// age — пересчитать прибавки, если с прошлого пересчёта прошло не меньше
+// Rate, и поправить кучу только для задач, чья прибавка изменилась.
+// Прибавки только растут, поэтому такая задача лишь поднимается к корню,
+// меняясь местами с предками, которые уже пересчитаны: обход по порядку
+// индексов ни одну задачу не пропустит
+func (s *agingStore) age() {
+	now := s.clock.Now()
+	if now.Sub(s.aged) < s.cfg.Rate {
+		return
+	}
+	s.aged = now
+	for i := range s.items.entries {
+		e := &s.items.entries[i]
+		if b := s.cfg.boost(now.Sub(e.at)); b != e.boost {
+			e.boost = b
+			heap.Fix(&s.items, i)
+		}
+	}
+}
+
+func (s *agingStore) push(it *queueItem) {
+	heap.Push(&s.items, agingEntry{it: it, at: s.clock.Now()})
+}
+
+func (s *agingStore) pop() *queueItem {
+	s.age()
+	return heap.Pop(&s.items).(agingEntry).it
+}
+
+func (s *agingStore) len() int { return len(s.items.entries) }
+
+func (s *agingStore) snapshot() []*queueItem {
+	s.age()
+	h := s.items
+	h.entries = append([]agingEntry(nil), s.items.entries...)
+	sort.Slice(h.entries, h.Less)
+	items := make([]*queueItem, len(h.entries))
+	for i, e := range h.entries {
+		items[i] = e.it
+	}
+	return items
+}
+
+func (s *agingStore) clear() []*queueItem {
+	items := make([]*queueItem, len(s.items.entries))
+	for i, e := range s.items.entries {
+		items[i] = e.it
+	}
+	s.items.entries = nil
+	return items
+}
+
+// oldestIndex — индекс задачи с наименьшим seq
+func (s *agingStore) oldestIndex() int {
+	i := -1
+	for j, e := range s.items.entries {
+		if i < 0 || e.it.seq < s.items.entries[i].it.seq {
+			i = j
+		}
+	}
+	return i
+}
+
+func (s *agingStore) oldest() *queueItem {
+	if i := s.oldestIndex(); i >= 0 {
+		return s.items.entries[i].it
+	}
+	return nil
+}
+
+func (s *agingStore) removeOldest() *queueItem {
+	return heap.Remove(&s.items, s.oldestIndex()).(agingEntry).it
+}
+
+// agingHeap — реализация heap.Interface для agingStore: сравнивает
+// эффективные приоритеты с последними пересчитанными прибавками, при
+// равенстве — порядок поступления
+type agingHeap struct {
+	entries []agingEntry
+}
+
+func (h agingHeap) Len() int { return len(h.entries) }
+
+func (h agingHeap) Less(i, j int) bool {
+	pi, pj := h.entries[i].effective(), h.entries[j].effective()
+	if pi != pj {
+		return pi > pj
+	}
+	return h.entries[i].it.seq < h.entries[j].it.seq
+}
+
+func (h agingHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *agingHeap) Push(x interface{}) { h.entries = append(h.entries, x.(agingEntry)) }
+
+func (h *agingHeap) Pop() interface{} {
+	n := len(h.entries)
+	e := h.entries[n-1]
+	h.entries[n-1] = agingEntry{}
+	h.entries = h.entries[:n-1]
+	return e
+}
@@ -0,0 +1,83 @@
+package worker_pool
+
+import "time"
+
+// ScaleConfig — параметры автомасштабирования пула по глубине очереди
+type ScaleConfig struct {
+	Interval  time.Duration // период замера QueueLen; по умолчанию 100 мс
+	HighWater int           // пул растёт, пока в очереди больше HighWater задач
+	LowWater  int           // пул сжимается, пока в очереди меньше LowWater задач; по умолчанию 1 — пустая очередь
+	Samples   int           // сколько замеров подряд нужно для изменения размера; по умолчанию 3
+}
+
+// withDefaults — ScaleConfig с заполненными значениями по умолчанию
+func (c ScaleConfig) withDefaults() ScaleConfig {
+	if c.Interval <= 0 {
+		c.Interval = 100 * time.Millisecond
+	}
+	c.HighWater = max(c.HighWater, 0)
+	if c.LowWater <= 0 {
+		c.LowWater = 1
+	}
+	// пороги не должны пересекаться, иначе пул будет расти и сжиматься одновременно
+	c.LowWater = min(c.LowWater, c.HighWater+1)
+	if c.Samples <= 0 {
+		c.Samples = 3
+	}
+	return c
+}
+
+// NewAutoScalingPool — создаёт пул из minWorkers воркеров, размер которого
+// меняется в пределах [minWorkers, maxWorkers] по глубине очереди: раз в
+// cfg.Interval пул добавляет воркер, если очередь держится выше cfg.HighWater,
+// и убирает, если ниже cfg.LowWater, cfg.Samples замеров подряд.
+// Масштабирование прекращается при остановке пула.
+func NewAutoScalingPool(minWorkers, maxWorkers int, cfg ScaleConfig, opts ...Option) *WorkerPool {
+	minWorkers = max(minWorkers, 1)
+	maxWorkers = max(maxWorkers, minWorkers)
+
+	wp := NewWorkerPool(minWorkers, opts...)
+	maxWorkers = max(min(maxWorkers, wp.maxWorkers), wp.WorkerCount())
+	go wp.autoscale(minWorkers, maxWorkers, cfg.withDefaults())
+	return wp
+}
+
+// autoscale — цикл автомасштабирования; завершается при остановке пула
+func (wp *WorkerPool) autoscale(minWorkers, maxWorkers int, cfg ScaleConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	var above, below int
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		depth := wp.QueueLen()
+		switch {
+		case depth > cfg.HighWater:
+			above, below = above+1, 0
+		case depth < cfg.LowWater:
+			above, below = 0, below+1
+		default:
+			above, below = 0, 0
+		}
+
+		n := wp.WorkerCount()
+		switch {
+		case above >= cfg.Samples && n < maxWorkers:
+			n++
+		case below >= cfg.Samples && n > minWorkers:
+			n--
+		default:
+			continue
+		}
+		above, below = 0, 0
+		if wp.Resize(n) != nil {
+			// пул останавливается
+			return
+		}
+	}
+}
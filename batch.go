@@ -0,0 +1,154 @@
+package worker_pool
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchHandle — пачка задач, отправленная через SubmitAll
+type BatchHandle struct {
+	wg   sync.WaitGroup
+	errs []error
+}
+
+// Wait — дождаться завершения всех задач пачки и вернуть их ошибки в порядке
+// отправки: nil для успешных задач, *PanicError для упавших с паникой,
+// ErrPoolStopped для задач, не попавших в остановленный пул или отброшенных
+// им до запуска, ErrTaskCancelled для отброшенных CancelAll, ErrNilTask для
+// nil вместо задачи
+func (b *BatchHandle) Wait() []error {
+	b.wg.Wait()
+	return b.errs
+}
+
+// SubmitAll — добавить пачку задач, дожидаясь места в очереди для каждой,
+// и вернуть BatchHandle для сбора их ошибок
+func (wp *WorkerPool) SubmitAll(tasks []func() error) *BatchHandle {
+	b := &BatchHandle{errs: make([]error, len(tasks))}
+
+	for i, task := range tasks {
+		if task == nil {
+			b.errs[i] = ErrNilTask
+			continue
+		}
+		b.wg.Add(1)
+		run := wp.wrapResult(task, func(err error) {
+			b.errs[i] = err
+			b.wg.Done()
+		})
+		dropped := func(err error) {
+			b.errs[i] = err
+			b.wg.Done()
+		}
+		if err := wp.enqueueWait(context.Background(), &queueItem{run: run, drop: dropped}); err != nil {
+			b.errs[i] = err
+			b.wg.Done()
+		}
+	}
+	return b
+}
+
+// Map — применить fn к каждому элементу items через пул и дождаться всех
+// результатов. results[i] и errs[i] соответствуют items[i]; при ошибке или
+// панике в results[i] остаётся нулевое значение. Если пул останавливается
+// раньше, Map не ждёт начатых задач: возвращает уже готовые результаты,
+// а для остальных элементов — ErrPoolStopped (поздние результаты таких
+// задач отбрасываются). Не вызывайте Map из задачи того же пула: при
+// заполненной очереди она будет ждать саму себя.
+func Map[T, R any](wp *WorkerPool, items []T, fn func(T) (R, error)) (results []R, errs []error) {
+	results = make([]R, len(items))
+	errs = make([]error, len(items))
+	if len(items) == 0 {
+		return results, errs
+	}
+
+	// finished и remaining — под mu: после остановки пула Map возвращает
+	// срезы вызывающему, и запоздавшие задачи не должны в них писать
+	var mu sync.Mutex
+	finished := make([]bool, len(items))
+	remaining := len(items)
+	aborted := false
+	done := make(chan struct{})
+	finish := func(i int, r R, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted || finished[i] {
+			return
+		}
+		finished[i] = true
+		results[i], errs[i] = r, err
+		if remaining--; remaining == 0 {
+			close(done)
+		}
+	}
+
+	for i, item := range items {
+		var r R
+		run := wp.wrapResult(func() error {
+			var err error
+			r, err = fn(item)
+			return err
+		}, func(err error) { finish(i, r, err) })
+		dropped := func(err error) {
+			var zero R
+			finish(i, zero, err)
+		}
+		if err := wp.enqueueWait(context.Background(), &queueItem{run: run, drop: dropped}); err != nil {
+			dropped(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-wp.Done():
+		mu.Lock()
+		aborted = true
+		for i, ok := range finished {
+			if !ok {
+				errs[i] = ErrPoolStopped
+			}
+		}
+		mu.Unlock()
+	}
+	return results, errs
+}
+
+// MapReduce — разбить items на куски по chunkSize элементов (последний
+// может быть короче), обработать каждый кусок mapFn отдельной задачей пула
+// и свернуть частичные результаты reduceFn в порядке кусков. Для пустого
+// items возвращается нулевое значение R без вызова mapFn; chunkSize <= 0 —
+// один кусок на все элементы. Если кусок не обработан (паника в mapFn или
+// остановка пула), MapReduce возвращает нулевое значение R и ошибку
+// первого такого куска: *PanicError или ErrPoolStopped — свёртка без него
+// дала бы неверный результат. При остановке пула MapReduce возвращается
+// сразу, не дожидаясь начатых кусков (см. Map). Как и Map, не вызывайте
+// из задачи того же пула.
+func MapReduce[T, R any](wp *WorkerPool, items []T, chunkSize int, mapFn func([]T) R, reduceFn func(R, R) R) (R, error) {
+	var zero R
+	if len(items) == 0 {
+		return zero, nil
+	}
+	if chunkSize <= 0 {
+		chunkSize = len(items)
+	}
+
+	chunks := make([][]T, 0, (len(items)+chunkSize-1)/chunkSize)
+	for start := 0; start < len(items); start += chunkSize {
+		chunks = append(chunks, items[start:min(start+chunkSize, len(items))])
+	}
+
+	partials, errs := Map(wp, chunks, func(chunk []T) (R, error) {
+		return mapFn(chunk), nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			return zero, err
+		}
+	}
+
+	acc := partials[0]
+	for _, r := range partials[1:] {
+		acc = reduceFn(acc, r)
+	}
+	return acc, nil
+}
@@ -0,0 +1,123 @@
+package worker_pool
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock — источник времени для отложенных и периодических задач
+// (SubmitAfter, SubmitAt, SubmitEvery, повторы SubmitRetry) и срока жизни
+// SubmitWithTTL. По умолчанию — системное время; в тестах можно подставить
+// MockClock через WithClock и двигать время вручную.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer — таймер Clock.AfterFunc. Stop отменяет вызов f и сообщает,
+// успел ли таймер остановиться до срабатывания.
+type Timer interface {
+	Stop() bool
+}
+
+// realClock — Clock поверх пакета time
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// MockClock — Clock для тестов: время стоит на месте, пока его не сдвинут
+// Advance. Таймеры срабатывают в Advance по порядку сроков, в горутине
+// вызывающего; таймер с неположительной задержкой срабатывает сразу
+// в отдельной горутине, как у time.AfterFunc.
+type MockClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*mockTimer
+}
+
+// mockTimer — ожидающий таймер MockClock
+type mockTimer struct {
+	clock *MockClock
+	at    time.Time
+	f     func()
+}
+
+// NewMockClock — MockClock, показывающий время start
+func NewMockClock(start time.Time) *MockClock {
+	return &MockClock{now: start}
+}
+
+// Now — текущее время часов
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After — канал, в который придёт время часов, когда они дойдут до now+d
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.AfterFunc(d, func() { ch <- c.Now() })
+	return ch
+}
+
+// AfterFunc — вызвать f, когда часы дойдут до now+d
+func (c *MockClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &mockTimer{clock: c, at: c.now.Add(d), f: f}
+	if d <= 0 {
+		go f()
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance — сдвинуть часы на d и вызвать таймеры, срок которых наступил
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due, rest []*mockTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			rest = append(rest, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = rest
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// Pending — число таймеров, ещё не сработавших и не остановленных;
+// позволяет тесту дождаться, пока код под тестом заведёт таймер
+func (c *MockClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *mockTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
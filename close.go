@@ -0,0 +1,17 @@
+package worker_pool
+
+import (
+	"errors"
+	"io"
+)
+
+var _ io.Closer = (*WorkerPool)(nil)
+
+// Close — остановить пул, как StopWait, дождавшись задач из очереди,
+// и вернуть ошибки и паники задач, выполненных во время остановки,
+// объединённые errors.Join (см. StopWaitErr); nil, если их не было.
+// Позволяет закрывать пул через defer и io.Closer. Повторные вызовы,
+// как и после Stop или StopWait, ничего не делают и возвращают nil.
+func (wp *WorkerPool) Close() error {
+	return errors.Join(wp.StopWaitErr()...)
+}
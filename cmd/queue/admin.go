@@ -0,0 +1,69 @@
+package main
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+
+    wpkg "worker_pool"
+)
+
+// adminTokenEnv names the bearer token required by /admin endpoints. When it
+// is unset the endpoints are disabled.
+const adminTokenEnv = "ADMIN_TOKEN"
+
+// authorizeAdmin checks the request's "Authorization: Bearer <token>" header
+// against adminToken. On failure it writes 403 (admin disabled) or 401 and
+// returns false.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+    if s.adminToken == "" {
+        http.Error(w, "admin endpoints disabled", http.StatusForbidden)
+        return false
+    }
+    token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return false
+    }
+    return true
+}
+
+// handleAdminWorkers resizes the pool to the requested worker count and
+// returns the count in effect, which may be clamped by the pool's limit.
+func (s *Server) handleAdminWorkers(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    if !s.authorizeAdmin(w, r) {
+        return
+    }
+
+    var req WorkerCount
+    if !s.decodeBody(w, r, &req) {
+        return
+    }
+    if req.Count < 1 {
+        http.Error(w, "count must be >= 1", http.StatusBadRequest)
+        return
+    }
+
+    old := s.pool.WorkerCount()
+    if err := s.pool.Resize(req.Count); err != nil {
+        status := http.StatusBadRequest
+        if errors.Is(err, wpkg.ErrPoolStopped) {
+            status = http.StatusServiceUnavailable
+        }
+        http.Error(w, err.Error(), status)
+        return
+    }
+    n := s.pool.WorkerCount()
+    log.Printf("admin: workers %d -> %d", old, n)
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(WorkerCount{Count: n})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestAdminWorkers(t *testing.T) {
+    post := func(s *Server, token, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/admin/workers", strings.NewReader(body))
+        if token != "" {
+            req.Header.Set("Authorization", "Bearer "+token)
+        }
+        rec := httptest.NewRecorder()
+        s.httpServer.Handler.ServeHTTP(rec, req)
+        return rec
+    }
+
+    t.Run("resizes the pool", func(t *testing.T) {
+        s := newTestServer(t, 2, 8)
+        s.adminToken = "secret"
+
+        rec := post(s, "secret", `{"count":5}`)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+        }
+        var got WorkerCount
+        if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+            t.Fatalf("decode: %v", err)
+        }
+        if got.Count != 5 {
+            t.Errorf("response count %d, want 5", got.Count)
+        }
+        if n := s.pool.WorkerCount(); n != 5 {
+            t.Errorf("pool workers %d, want 5", n)
+        }
+    })
+
+    t.Run("rejects bad requests", func(t *testing.T) {
+        s := newTestServer(t, 2, 8)
+        s.adminToken = "secret"
+
+        cases := []struct {
+            name, token, body string
+            want              int
+        }{
+            {"missing token", "", `{"count":3}`, http.StatusUnauthorized},
+            {"wrong token", "guess", `{"count":3}`, http.StatusUnauthorized},
+            {"zero count", "secret", `{"count":0}`, http.StatusBadRequest},
+            {"negative count", "secret", `{"count":-1}`, http.StatusBadRequest},
+            {"invalid json", "secret", `{"count":`, http.StatusBadRequest},
+        }
+        for _, c := range cases {
+            if rec := post(s, c.token, c.body); rec.Code != c.want {
+                t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.want)
+            }
+        }
+        if rec := doRequest(s, http.MethodGet, "/admin/workers", ""); rec.Code != http.StatusMethodNotAllowed {
+            t.Errorf("GET: status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+        }
+        if n := s.pool.WorkerCount(); n != 2 {
+            t.Errorf("pool workers %d, want unchanged 2", n)
+        }
+    })
+
+    t.Run("disabled without a token", func(t *testing.T) {
+        s := newTestServer(t, 2, 8)
+        s.adminToken = ""
+        if rec := post(s, "anything", `{"count":3}`); rec.Code != http.StatusForbidden {
+            t.Errorf("status %d, want %d", rec.Code, http.StatusForbidden)
+        }
+    })
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+    "math/rand"
+    "time"
+)
+
+// BackoffStrategy decides how long a failed task waits before its retry.
+// attempt counts retries from 1.
+type BackoffStrategy interface {
+    Delay(attempt int) time.Duration
+}
+
+// ExponentialBackoff doubles the delay with every attempt, starting at Base
+// and capped at Max (0 means no cap), plus a random Jitter in [0, Jitter).
+type ExponentialBackoff struct {
+    Base   time.Duration
+    Max    time.Duration
+    Jitter time.Duration
+}
+
+// Delay implements BackoffStrategy.
+func (b ExponentialBackoff) Delay(attempt int) time.Duration {
+    d := b.Base
+    for i := 1; i < attempt; i++ {
+        if b.Max > 0 && d >= b.Max {
+            break
+        }
+        d *= 2
+    }
+    if b.Max > 0 && d > b.Max {
+        d = b.Max
+    }
+    return d + jitter(b.Jitter)
+}
+
+// LinearBackoff grows the delay by Step with every attempt, capped at Max
+// (0 means no cap), plus a random Jitter in [0, Jitter).
+type LinearBackoff struct {
+    Step   time.Duration
+    Max    time.Duration
+    Jitter time.Duration
+}
+
+// Delay implements BackoffStrategy.
+func (b LinearBackoff) Delay(attempt int) time.Duration {
+    d := b.Step * time.Duration(max(attempt, 1))
+    if b.Max > 0 && d > b.Max {
+        d = b.Max
+    }
+    return d + jitter(b.Jitter)
+}
+
+// ConstantBackoff waits Interval before every retry, plus a random Jitter
+// in [0, Jitter).
+type ConstantBackoff struct {
+    Interval time.Duration
+    Jitter   time.Duration
+}
+
+// Delay implements BackoffStrategy.
+func (b ConstantBackoff) Delay(int) time.Duration {
+    return b.Interval + jitter(b.Jitter)
+}
+
+// defaultBackoff is used when newServer gets no strategy: 100ms doubling
+// up to 6.4s (the seventh attempt), plus up to 200ms of jitter.
+var defaultBackoff = ExponentialBackoff{
+    Base:   100 * time.Millisecond,
+    Max:    6400 * time.Millisecond,
+    Jitter: 200 * time.Millisecond,
+}
+
+// jitter returns a random duration in [0, j); zero when j is not positive.
+func jitter(j time.Duration) time.Duration {
+    if j <= 0 {
+        return 0
+    }
+    return time.Duration(rand.Int63n(int64(j)))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "slices"
+    "testing"
+    "time"
+)
+
+// delays returns b's delays for attempts 1..5.
+func delays(b BackoffStrategy) []time.Duration {
+    var ds []time.Duration
+    for attempt := 1; attempt <= 5; attempt++ {
+        ds = append(ds, b.Delay(attempt))
+    }
+    return ds
+}
+
+func TestBackoffStrategies(t *testing.T) {
+    ms := time.Millisecond
+    tests := []struct {
+        name    string
+        backoff BackoffStrategy
+        want    []time.Duration
+    }{
+        {"exponential", ExponentialBackoff{Base: 100 * ms}, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 1600 * ms}},
+        {"exponential capped", ExponentialBackoff{Base: 100 * ms, Max: 500 * ms}, []time.Duration{100 * ms, 200 * ms, 400 * ms, 500 * ms, 500 * ms}},
+        {"linear", LinearBackoff{Step: 50 * ms}, []time.Duration{50 * ms, 100 * ms, 150 * ms, 200 * ms, 250 * ms}},
+        {"linear capped", LinearBackoff{Step: 50 * ms, Max: 120 * ms}, []time.Duration{50 * ms, 100 * ms, 120 * ms, 120 * ms, 120 * ms}},
+        {"constant", ConstantBackoff{Interval: 30 * ms}, []time.Duration{30 * ms, 30 * ms, 30 * ms, 30 * ms, 30 * ms}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := delays(tt.backoff); !slices.Equal(got, tt.want) {
+                t.Errorf("delays %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestBackoffJitter(t *testing.T) {
+    ms := time.Millisecond
+    base := []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 1600 * ms}
+    for i := 0; i < 50; i++ {
+        for n, d := range delays(defaultBackoff) {
+            if d < base[n] || d >= base[n]+200*ms {
+                t.Fatalf("attempt %d: delay %s outside [%s, %s)", n+1, d, base[n], base[n]+200*ms)
+            }
+        }
+    }
+    // the default caps at the seventh attempt
+    if d := defaultBackoff.Delay(20); d < 6400*ms || d >= 6600*ms {
+        t.Errorf("attempt 20: delay %s, want capped at 6.4s plus jitter", d)
+    }
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+)
+
+// subscriberBuffer is how many events a slow /events client may lag behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// broker fans task events out to /events subscribers.
+type broker struct {
+    mu     sync.Mutex
+    subs   map[chan TaskEvent]struct{}
+    closed bool
+}
+
+func newBroker() *broker {
+    return &broker{subs: make(map[chan TaskEvent]struct{})}
+}
+
+// subscribe registers a new subscriber channel; it returns nil once the
+// broker is closed.
+func (b *broker) subscribe() chan TaskEvent {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.closed {
+        return nil
+    }
+    ch := make(chan TaskEvent, subscriberBuffer)
+    b.subs[ch] = struct{}{}
+    return ch
+}
+
+// unsubscribe removes ch and closes it, unless close already did.
+func (b *broker) unsubscribe(ch chan TaskEvent) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if _, ok := b.subs[ch]; ok {
+        delete(b.subs, ch)
+        close(ch)
+    }
+}
+
+// publish delivers ev to every subscriber without blocking; a subscriber
+// whose buffer is full misses the event.
+func (b *broker) publish(ev TaskEvent) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for ch := range b.subs {
+        select {
+        case ch <- ev:
+        default:
+            log.Printf("events: subscriber lagging, dropped event id=%s", ev.ID)
+        }
+    }
+}
+
+// close ends every subscription so streaming handlers return.
+func (b *broker) close() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.closed = true
+    for ch := range b.subs {
+        delete(b.subs, ch)
+        close(ch)
+    }
+}
+
+// handleEvents streams task state transitions as Server-Sent Events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+    events := s.events.subscribe()
+    if events == nil {
+        http.Error(w, "shutting down", http.StatusServiceUnavailable)
+        return
+    }
+    defer s.events.unsubscribe(events)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case ev, ok := <-events:
+            if !ok {
+                return
+            }
+            data, err := json.Marshal(ev)
+            if err != nil {
+                log.Printf("events: encode failed id=%s error=%v", ev.ID, err)
+                continue
+            }
+            if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+                return
+            }
+            flusher.Flush()
+        }
+    }
+}
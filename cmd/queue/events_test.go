@@ -0,0 +1,89 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestEventsStream(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    s.runner = func(context.Context, Task) (string, error) { return "", nil }
+
+    ts := httptest.NewServer(s.httpServer.Handler)
+    defer ts.Close()
+
+    resp, err := http.Get(ts.URL + "/events")
+    if err != nil {
+        t.Fatalf("GET /events: %v", err)
+    }
+    defer resp.Body.Close()
+    if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+        t.Fatalf("content type %q, want text/event-stream", ct)
+    }
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"t1"}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+
+    events := make(chan TaskEvent)
+    go func() {
+        defer close(events)
+        sc := bufio.NewScanner(resp.Body)
+        for sc.Scan() {
+            data, ok := strings.CutPrefix(sc.Text(), "data: ")
+            if !ok {
+                continue
+            }
+            var ev TaskEvent
+            if err := json.Unmarshal([]byte(data), &ev); err != nil {
+                t.Errorf("decode event %q: %v", data, err)
+                return
+            }
+            events <- ev
+        }
+    }()
+
+    want := []struct{ from, to TaskState }{
+        {"", StateQueued},
+        {StateQueued, StateRunning},
+        {StateRunning, StateDone},
+    }
+    for _, w := range want {
+        select {
+        case ev, ok := <-events:
+            if !ok {
+                t.Fatal("event stream closed early")
+            }
+            if ev.ID != "t1" || ev.From != w.from || ev.To != w.to {
+                t.Errorf("event %+v, want t1 %q -> %q", ev, w.from, w.to)
+            }
+            if ev.TS.IsZero() {
+                t.Errorf("event %+v has no timestamp", ev)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("timed out waiting for %q -> %q", w.from, w.to)
+        }
+    }
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+    b := newBroker()
+    ch := b.subscribe()
+    b.unsubscribe(ch)
+    if _, ok := <-ch; ok {
+        t.Error("unsubscribed channel should be closed")
+    }
+    // publishing with no subscribers and closing twice must not panic
+    b.publish(TaskEvent{ID: "x"})
+    b.close()
+    b.unsubscribe(ch)
+    if b.subscribe() != nil {
+        t.Error("subscribe after close should return nil")
+    }
+}
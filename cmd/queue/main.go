@@ -1,5 +1,5 @@
-package main
-
-func main() { run() }
-
-
+package main
+
+func main() { run() }
+
+
@@ -1,143 +1,315 @@
-package main
-
-import (
-    "context"
-    "errors"
-    "log"
-    "math/rand"
-    "net/http"
-    "os"
-    "os/signal"
-    "strconv"
-    "syscall"
-    "time"
-)
-
-// simulateWork performs a fake task: 100–500ms, ~20% failure rate.
-func simulateWork() error {
-    d := time.Duration(100+rand.Intn(401)) * time.Millisecond
-    time.Sleep(d)
-    if rand.Intn(100) < 20 {
-        return errors.New("simulated failure")
-    }
-    return nil
-}
-
-// backoffDuration calculates exponential backoff with jitter.
-func backoffDuration(attempt int) time.Duration {
-    if attempt < 1 {
-        attempt = 1
-    }
-    if attempt > 7 {
-        attempt = 7
-    }
-    base := time.Duration(100*(1<<uint(attempt-1))) * time.Millisecond
-    jitter := time.Duration(rand.Intn(200)) * time.Millisecond
-    return base + jitter
-}
-
-// timeSleep is a tiny sleep helper (ms) used in workerLoop.
-func timeSleep(ms int) { time.Sleep(time.Duration(ms) * time.Millisecond) }
-
-// processTask runs a task with retries, updating in-memory state and logging.
-func (s *Server) processTask(t Task) {
-    s.setState(t.ID, StateRunning)
-    log.Printf("task start id=%s", t.ID)
-    if err := simulateWork(); err != nil {
-        if s.getRetry(t.ID) < t.MaxRetries {
-            attempt := s.incRetry(t.ID)
-            delay := backoffDuration(attempt)
-            log.Printf("task fail id=%s attempt=%d delay=%s error=%v", t.ID, attempt, delay, err)
-            time.AfterFunc(delay, func() {
-                s.mu.Lock()
-                if s.shuttingDown {
-                    s.mu.Unlock()
-                    s.setState(t.ID, StateFailed)
-                    log.Printf("task dropped due to shutdown id=%s", t.ID)
-                    return
-                }
-                s.states[t.ID] = StateQueued
-                s.mu.Unlock()
-                select {
-                case s.jobs <- t:
-                    log.Printf("task requeued id=%s attempt=%d", t.ID, attempt)
-                default:
-                    s.setState(t.ID, StateFailed)
-                    log.Printf("task retry dropped (queue full) id=%s attempt=%d", t.ID, attempt)
-                }
-            })
-            return
-        }
-        s.setState(t.ID, StateFailed)
-        log.Printf("task failed permanently id=%s", t.ID)
-        return
-    }
-    s.setState(t.ID, StateDone)
-    log.Printf("task done id=%s", t.ID)
-}
-
-// getenvInt reads positive ints from env with default.
-func getenvInt(key string, def int) int {
-    v := os.Getenv(key)
-    if v == "" {
-        return def
-    }
-    n, err := strconv.Atoi(v)
-    if err != nil || n <= 0 {
-        return def
-    }
-    return n
-}
-
-// shutdown stops HTTP, then the pool, then marks remaining queued tasks failed.
-func (s *Server) shutdown(ctx context.Context) error {
-    var err error
-    s.shutdownOnce.Do(func() {
-        s.mu.Lock()
-        s.shuttingDown = true
-        s.mu.Unlock()
-
-        log.Printf("shutdown: stopping http server")
-        _ = s.httpServer.Shutdown(ctx)
-
-        log.Printf("shutdown: stopping worker pool")
-        s.pool.Stop()
-
-        log.Printf("shutdown: marking remaining queued tasks as failed")
-        for {
-            select {
-            case t := <-s.jobs:
-                s.setState(t.ID, StateFailed)
-                log.Printf("shutdown: failed queued id=%s", t.ID)
-            default:
-                log.Printf("shutdown: complete")
-                return
-            }
-        }
-    })
-    return err
-}
-
-// run bootstraps the service and installs signal handling.
-func run() {
-    rand.Seed(time.Now().UnixNano())
-    workers := getenvInt("WORKERS", 4)
-    queueSize := getenvInt("QUEUE_SIZE", 64)
-    srv := newServer(workers, queueSize)
-    go func() {
-        log.Printf("listening on :8080 (workers=%d, queue=%d)", workers, queueSize)
-        if err := srv.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-            log.Fatalf("http server error: %v", err)
-        }
-    }()
-
-    sigs := make(chan os.Signal, 1)
-    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-    <-sigs
-
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-    _ = srv.shutdown(ctx)
-}
-
-
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "math/rand"
+    "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "syscall"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+// simulateWork is the default TaskRunner: a fake task taking 100–500ms
+// with a ~20% failure rate. It stops early when ctx is cancelled.
+func simulateWork(ctx context.Context, t Task) (string, error) {
+    d := time.Duration(100+rand.Intn(401)) * time.Millisecond
+    select {
+    case <-time.After(d):
+    case <-ctx.Done():
+        return "", ctx.Err()
+    }
+    if rand.Intn(100) < 20 {
+        return "", errors.New("simulated failure")
+    }
+    return fmt.Sprintf("processed %s in %s", t.ID, d), nil
+}
+
+// processTask runs a task through s.runner with retries, updating in-memory state and logging.
+// It returns the attempt's error so pool metrics count failed attempts.
+// ctx is the task's context; DELETE /tasks/{id} cancels it mid-run.
+func (s *Server) processTask(ctx context.Context, t Task) error {
+    if !s.startTask(t.ID) {
+        log.Printf("task skipped (cancelled or shutting down) id=%s", t.ID)
+        return nil
+    }
+    log.Printf("task start id=%s", t.ID)
+    out, err := s.runner(ctx, t)
+    if s.cancelled(t.ID) {
+        log.Printf("task cancelled while running id=%s", t.ID)
+        return nil
+    }
+    if err != nil {
+        s.recordError(t.ID, err)
+        if s.getRetry(t.ID) < t.MaxRetries {
+            attempt := s.incRetry(t.ID)
+            delay := s.backoff.Delay(attempt)
+            log.Printf("task fail id=%s attempt=%d delay=%s error=%v", t.ID, attempt, delay, err)
+            s.retried.Inc()
+            s.scheduleRetry(t, attempt, delay)
+            return err
+        }
+        s.setState(t.ID, StateFailed)
+        log.Printf("task failed permanently id=%s", t.ID)
+        s.deadLetter(t)
+        s.notify(t)
+        return err
+    }
+    s.finishTask(t.ID, out)
+    log.Printf("task done id=%s", t.ID)
+    s.notify(t)
+    return nil
+}
+
+// defaultRetryRate is how many retries per second are requeued when
+// RETRY_RATE is unset or invalid.
+const defaultRetryRate = 20
+
+// newRetryLimiter builds the retry budget: perSecond requeues per second
+// with an equal burst.
+func newRetryLimiter(perSecond int) *rate.Limiter {
+    return rate.NewLimiter(rate.Limit(perSecond), perSecond)
+}
+
+// scheduleRetry requeues t after delay. The timer is tracked so shutdown can
+// stop it; a retry due during shutdown fails the task instead.
+func (s *Server) scheduleRetry(t Task, attempt int, delay time.Duration) {
+    s.mu.Lock()
+    if s.shuttingDown {
+        s.mu.Unlock()
+        s.dropRetry(t)
+        return
+    }
+    s.armRetryLocked(t, attempt, delay, false)
+    s.mu.Unlock()
+}
+
+// armRetryLocked starts the retry timer for t; s.mu must be held. When it
+// fires, the retry takes a token from s.retryLimiter (unless reserved says
+// it already holds one) and waits for it if the budget is spent, so a burst
+// of failures is requeued at a bounded rate. A retry that finds the queue
+// full backs off again instead of being dropped.
+func (s *Server) armRetryLocked(t Task, attempt int, delay time.Duration, reserved bool) {
+    s.retryWG.Add(1)
+    var tm *time.Timer
+    tm = time.AfterFunc(delay, func() {
+        defer s.retryWG.Done()
+        s.mu.Lock()
+        if _, ok := s.retryTimers[tm]; !ok {
+            s.mu.Unlock()
+            return
+        }
+        delete(s.retryTimers, tm)
+        if s.shuttingDown {
+            s.mu.Unlock()
+            s.dropRetry(t)
+            return
+        }
+        if s.consumeCancelledLocked(t.ID) {
+            s.mu.Unlock()
+            log.Printf("task retry dropped (cancelled) id=%s", t.ID)
+            return
+        }
+        if !reserved && s.retryLimiter != nil {
+            if wait := s.retryLimiter.Reserve().Delay(); wait > 0 {
+                log.Printf("task retry throttled id=%s attempt=%d wait=%s", t.ID, attempt, wait)
+                s.armRetryLocked(t, attempt, wait, true)
+                s.mu.Unlock()
+                return
+            }
+        }
+        select {
+        case s.slots <- struct{}{}:
+            s.jobs <- t
+            // under s.mu, so startTask cannot mark it running first
+            s.setStateLocked(t.ID, StateQueued)
+            log.Printf("task requeued id=%s attempt=%d", t.ID, attempt)
+        default:
+            delay := s.backoff.Delay(attempt)
+            log.Printf("task retry deferred (queue full) id=%s attempt=%d delay=%s", t.ID, attempt, delay)
+            s.armRetryLocked(t, attempt, delay, false)
+        }
+        s.mu.Unlock()
+    })
+    s.retryTimers[tm] = t
+}
+
+// dropRetry fails a task whose retry was cut short by shutdown.
+func (s *Server) dropRetry(t Task) {
+    s.setState(t.ID, StateFailed)
+    log.Printf("task dropped due to shutdown id=%s", t.ID)
+    s.notify(t)
+}
+
+// stopRetries stops pending retry timers and fails their tasks, then waits
+// for timers that already fired, so no retry touches the queue or the store
+// after shutdown drains them.
+func (s *Server) stopRetries() {
+    var dropped []Task
+    s.mu.Lock()
+    for tm, t := range s.retryTimers {
+        // a timer that already fired stays in the map; its callback sees
+        // shuttingDown and fails the task itself
+        if tm.Stop() {
+            delete(s.retryTimers, tm)
+            s.retryWG.Done()
+            dropped = append(dropped, t)
+        }
+    }
+    s.mu.Unlock()
+
+    for _, t := range dropped {
+        s.dropRetry(t)
+    }
+    s.retryWG.Wait()
+}
+
+// defaultShutdownTimeoutSeconds bounds graceful shutdown when
+// SHUTDOWN_TIMEOUT_SECONDS is unset or invalid.
+const defaultShutdownTimeoutSeconds = 10
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT_SECONDS; non-positive or malformed
+// values fall back to the default.
+func shutdownTimeout() time.Duration {
+    return time.Duration(getenvInt("SHUTDOWN_TIMEOUT_SECONDS", defaultShutdownTimeoutSeconds)) * time.Second
+}
+
+// getenvInt reads positive ints from env with default.
+func getenvInt(key string, def int) int {
+    v := os.Getenv(key)
+    if v == "" {
+        return def
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n <= 0 {
+        return def
+    }
+    return n
+}
+
+// reloadWorkers re-reads WORKERS and resizes the pool; tasks already queued
+// stay queued and are picked up by the resized pool.
+func (s *Server) reloadWorkers() {
+    old := s.pool.WorkerCount()
+    n := getenvInt("WORKERS", old)
+    if n == old {
+        log.Printf("reload: workers unchanged (%d)", n)
+        return
+    }
+    if err := s.pool.Resize(n); err != nil {
+        log.Printf("reload: resize failed error=%v", err)
+        return
+    }
+    log.Printf("reload: workers %d -> %d", old, n)
+}
+
+// shutdown stops HTTP, drains the pool within ctx, then saves remaining queued
+// tasks to the QUEUE_SNAPSHOT file or, without one, marks them failed.
+func (s *Server) shutdown(ctx context.Context) error {
+    var err error
+    s.shutdownOnce.Do(func() {
+        s.mu.Lock()
+        s.shuttingDown = true
+        s.mu.Unlock()
+
+        log.Printf("shutdown: closing event streams")
+        s.events.close()
+
+        log.Printf("shutdown: stopping http server")
+        _ = s.httpServer.Shutdown(ctx)
+
+        log.Printf("shutdown: stopping pending retries")
+        s.stopRetries()
+
+        log.Printf("shutdown: draining worker pool")
+        if perr := s.pool.StopWaitContext(ctx); perr != nil {
+            log.Printf("shutdown: pool drain aborted error=%v", perr)
+            err = perr
+        }
+
+        // once the readers are gone no job can leave the channel for the
+        // stopped pool while it is being drained; tasks the pool dropped
+        // when ctx expired go first, they were queued before the rest, and
+        // restored tasks still waiting for a slot before new ones
+        s.readers.Wait()
+        remaining := append(s.takeUnstarted(), s.takeRestored()...)
+        remaining = append(remaining, s.drainJobs()...)
+        if s.snapshotPath != "" && len(remaining) > 0 {
+            if serr := s.saveSnapshot(remaining); serr != nil {
+                log.Printf("shutdown: snapshot failed error=%v", serr)
+            } else {
+                remaining = nil
+            }
+        }
+
+        log.Printf("shutdown: marking remaining queued tasks as failed")
+        for _, t := range remaining {
+            if s.failUnlessCancelled(t.ID) {
+                log.Printf("shutdown: failed queued id=%s", t.ID)
+            }
+        }
+
+        // callbacks of tasks that finished during the drain or lost their
+        // retry get their own deadline
+        log.Printf("shutdown: delivering pending webhooks")
+        wctx, cancel := context.WithTimeout(context.Background(), webhookDrainTimeout)
+        if werr := s.webhooks.StopWaitContext(wctx); werr != nil {
+            log.Printf("shutdown: pending webhooks dropped error=%v", werr)
+        }
+        cancel()
+
+        if err := s.store.Close(); err != nil {
+            log.Printf("shutdown: store close error=%v", err)
+        }
+        log.Printf("shutdown: complete")
+    })
+    return err
+}
+
+// run bootstraps the service and installs signal handling: SIGHUP reloads
+// the worker count, SIGINT/SIGTERM shut down gracefully.
+func run() {
+    rand.Seed(time.Now().UnixNano())
+    workers := getenvInt("WORKERS", 4)
+    queueSize := getenvInt("QUEUE_SIZE", 64)
+    store, err := openStore(os.Getenv("STATE_DB"))
+    if err != nil {
+        log.Fatalf("open state store: %v", err)
+    }
+    srv := newServer(workers, queueSize, store, nil, nil)
+    srv.MaxPayloadBytes = int64(getenvInt("MAX_PAYLOAD_BYTES", defaultMaxPayloadBytes))
+    srv.retryLimiter = newRetryLimiter(getenvInt("RETRY_RATE", defaultRetryRate))
+    go func() {
+        log.Printf("listening on :8080 (workers=%d, queue=%d)", workers, queueSize)
+        if err := srv.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Fatalf("http server error: %v", err)
+        }
+    }()
+
+    hups := make(chan os.Signal, 1)
+    signal.Notify(hups, syscall.SIGHUP)
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+    for waiting := true; waiting; {
+        select {
+        case <-hups:
+            srv.reloadWorkers()
+        case <-sigs:
+            waiting = false
+        }
+    }
+
+    timeout := shutdownTimeout()
+    log.Printf("shutdown: draining for up to %s", timeout)
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    _ = srv.shutdown(ctx)
+}
+
+
@@ -0,0 +1,233 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+func TestReloadWorkers(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    started := make(chan string, 8)
+    release := make(chan struct{})
+    s.runner = func(_ context.Context, t Task) (string, error) {
+        started <- t.ID
+        <-release
+        return "", nil
+    }
+
+    ids := []string{"a", "b", "c"}
+    for _, id := range ids {
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    <-started
+    select {
+    case id := <-started:
+        t.Fatalf("task %s started with a single worker busy", id)
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    t.Setenv("WORKERS", "3")
+    s.reloadWorkers()
+    if got := s.pool.WorkerCount(); got != 3 {
+        t.Fatalf("worker count %d after reload, want 3", got)
+    }
+    for i := 0; i < 2; i++ {
+        select {
+        case <-started:
+        case <-time.After(5 * time.Second):
+            t.Fatal("queued tasks did not start after growing the pool")
+        }
+    }
+
+    close(release)
+    for _, id := range ids {
+        waitForState(t, s, id, StateDone, 5*time.Second)
+    }
+}
+
+func TestTaskRunner(t *testing.T) {
+    var calls atomic.Int32
+    runner := func(context.Context, Task) (string, error) {
+        if calls.Add(1) < 3 {
+            return "", errors.New("transient")
+        }
+        return "", nil
+    }
+    s := newServer(1, 8, newMemoryStore(), runner, nil)
+    t.Cleanup(func() {
+        ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+        defer cancel()
+        _ = s.shutdown(ctx)
+    })
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"r","max_retries":3}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    st := waitForState(t, s, "r", StateDone, 5*time.Second)
+    if got := calls.Load(); got != 3 {
+        t.Errorf("runner called %d times, want 3", got)
+    }
+    if st.Retries != 2 {
+        t.Errorf("retries %d, want 2", st.Retries)
+    }
+}
+
+func TestShutdownStopsRetryTimers(t *testing.T) {
+    s := newServer(1, 8, newMemoryStore(), func(context.Context, Task) (string, error) { return "", errors.New("always fails") }, nil)
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"r","max_retries":5}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    // the first attempt failed and a retry is waiting out its backoff
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        s.mu.Lock()
+        pending := len(s.retryTimers)
+        s.mu.Unlock()
+        if pending == 1 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("retry was never scheduled")
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    if err := s.shutdown(ctx); err != nil {
+        t.Fatalf("shutdown: %v", err)
+    }
+
+    if st := getStatus(t, s, "r"); st.State != StateFailed {
+        t.Errorf("state %q right after shutdown, want %q", st.State, StateFailed)
+    }
+    s.mu.Lock()
+    left := len(s.retryTimers)
+    s.mu.Unlock()
+    if left != 0 {
+        t.Errorf("%d retry timers left after shutdown", left)
+    }
+    if len(s.jobs) != 0 {
+        t.Errorf("%d jobs requeued after shutdown", len(s.jobs))
+    }
+}
+
+func TestShutdownTimeout(t *testing.T) {
+    cases := []struct {
+        env  string
+        want time.Duration
+    }{
+        {"", 10 * time.Second},
+        {"30", 30 * time.Second},
+        {"0", 10 * time.Second},
+        {"-5", 10 * time.Second},
+        {"soon", 10 * time.Second},
+    }
+    for _, c := range cases {
+        t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", c.env)
+        if got := shutdownTimeout(); got != c.want {
+            t.Errorf("SHUTDOWN_TIMEOUT_SECONDS=%q: got %s, want %s", c.env, got, c.want)
+        }
+    }
+}
+
+func TestShutdownHonorsContext(t *testing.T) {
+    release := make(chan struct{})
+    defer close(release)
+    started := make(chan struct{})
+    s := newServer(1, 8, newMemoryStore(), func(context.Context, Task) (string, error) {
+        close(started)
+        <-release
+        return "", nil
+    }, nil)
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"slow"}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    <-started
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    begin := time.Now()
+    err := s.shutdown(ctx)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("shutdown error %v, want deadline exceeded", err)
+    }
+    if d := time.Since(begin); d > time.Second {
+        t.Errorf("shutdown took %s with a 50ms deadline", d)
+    }
+}
+
+func TestRetryBudget(t *testing.T) {
+    const tasks = 10
+    var mu sync.Mutex
+    attempts := make(map[string]int)
+    var retriedAt []time.Time
+    s := newTestServer(t, 4, 4)
+    s.retryLimiter = rate.NewLimiter(20, 1)
+    s.runner = func(_ context.Context, t Task) (string, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        attempts[t.ID]++
+        if attempts[t.ID] == 1 {
+            return "", errors.New("downstream outage")
+        }
+        retriedAt = append(retriedAt, time.Now())
+        return "", nil
+    }
+
+    for i := 0; i < tasks; i++ {
+        id := fmt.Sprintf("t%d", i)
+        // the queue holds only four tasks; wait for room as a client would
+        for {
+            rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`","max_retries":1}`)
+            if rec.Code == http.StatusAccepted {
+                break
+            }
+            time.Sleep(time.Millisecond)
+        }
+    }
+    for i := 0; i < tasks; i++ {
+        waitForState(t, s, fmt.Sprintf("t%d", i), StateDone, 10*time.Second)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(retriedAt) != tasks {
+        t.Fatalf("%d retries ran, want %d", len(retriedAt), tasks)
+    }
+    sort.Slice(retriedAt, func(i, j int) bool { return retriedAt[i].Before(retriedAt[j]) })
+    // 20 requeues per second with a burst of one: ten retries need 450ms,
+    // while backoff jitter alone spreads them over at most 200ms
+    if span := retriedAt[tasks-1].Sub(retriedAt[0]); span < 400*time.Millisecond {
+        t.Errorf("%d retries ran within %s, want them spread by the retry budget", tasks, span)
+    }
+}
+
+func TestQueueReadersStopWithPool(t *testing.T) {
+    s := newTestServer(t, 4, 8)
+    s.pool.Stop()
+
+    done := make(chan struct{})
+    go func() {
+        s.readers.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(40 * time.Millisecond):
+        t.Fatal("queue readers still running 40ms after pool.Stop")
+    }
+}
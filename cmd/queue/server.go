@@ -1,144 +1,996 @@
-package main
-
-import (
-    "encoding/json"
-    "log"
-    "net/http"
-    "sync"
-
-    wpkg "worker_pool"
-)
-
-// Server wires HTTP endpoints to an internal buffered queue and a worker pool.
-type Server struct {
-    httpServer   *http.Server
-    jobs         chan Task
-    states       map[string]TaskState
-    retries      map[string]int
-    mu           sync.Mutex
-    shuttingDown bool
-    shutdownOnce sync.Once
-    pool         *wpkg.WorkerPool
-}
-
-// newServer constructs a Server and starts queue readers.
-func newServer(workers, queueSize int) *Server {
-    s := &Server{
-        jobs:    make(chan Task, queueSize),
-        states:  make(map[string]TaskState, queueSize),
-        retries: make(map[string]int, queueSize),
-        pool:    wpkg.NewWorkerPool(workers),
-    }
-
-    mux := http.NewServeMux()
-    mux.HandleFunc("/enqueue", s.handleEnqueue)
-    mux.HandleFunc("/healthz", s.handleHealth)
-    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-        _, _ = w.Write([]byte("Worker Queue API\n\nPOST /enqueue {id,payload,max_retries}\nGET /healthz\n"))
-    })
-    s.httpServer = &http.Server{Addr: ":8080", Handler: mux}
-
-    // Start queue readers; each reader submits jobs to the pool.
-    for i := 0; i < workers; i++ {
-        go s.workerLoop()
-    }
-
-    return s
-}
-
-// handleHealth returns 200 OK.
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-    w.WriteHeader(http.StatusOK)
-    _, _ = w.Write([]byte("ok"))
-}
-
-// handleEnqueue validates input and enqueues a task if buffer has space.
-func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        w.WriteHeader(http.StatusMethodNotAllowed)
-        return
-    }
-    s.mu.Lock()
-    if s.shuttingDown {
-        s.mu.Unlock()
-        http.Error(w, "shutting down", http.StatusServiceUnavailable)
-        return
-    }
-    s.mu.Unlock()
-
-    var t Task
-    dec := json.NewDecoder(r.Body)
-    if err := dec.Decode(&t); err != nil {
-        http.Error(w, "invalid json", http.StatusBadRequest)
-        return
-    }
-    if t.ID == "" {
-        http.Error(w, "missing id", http.StatusBadRequest)
-        return
-    }
-    if t.MaxRetries < 0 {
-        http.Error(w, "max_retries must be >= 0", http.StatusBadRequest)
-        return
-    }
-
-    // Mark as queued and try to place into the channel
-    s.mu.Lock()
-    if _, exists := s.states[t.ID]; !exists {
-        s.states[t.ID] = StateQueued
-        s.retries[t.ID] = 0
-    }
-    s.mu.Unlock()
-
-    select {
-    case s.jobs <- t:
-        log.Printf("enqueue accepted id=%s max_retries=%d", t.ID, t.MaxRetries)
-        w.WriteHeader(http.StatusAccepted)
-        _, _ = w.Write([]byte("enqueued"))
-    default:
-        log.Printf("enqueue rejected (queue full) id=%s", t.ID)
-        http.Error(w, "queue full", http.StatusServiceUnavailable)
-    }
-}
-
-func (s *Server) setState(id string, st TaskState) {
-    s.mu.Lock()
-    s.states[id] = st
-    s.mu.Unlock()
-}
-
-func (s *Server) incRetry(id string) int {
-    s.mu.Lock()
-    defer s.mu.Unlock()
-    s.retries[id] = s.retries[id] + 1
-    return s.retries[id]
-}
-
-func (s *Server) getRetry(id string) int {
-    s.mu.Lock()
-    defer s.mu.Unlock()
-    return s.retries[id]
-}
-
-func (s *Server) workerLoop() {
-    stop := make(chan struct{})
-    // Stop readers when the underlying pool stops
-    go func() {
-        for s.pool.IsRunning() {
-            timeSleep(50)
-        }
-        close(stop)
-    }()
-
-    for {
-        select {
-        case <-stop:
-            return
-        case t := <-s.jobs:
-            task := t
-            _ = s.pool.Submit(func() error { s.processTask(task); return nil })
-        }
-    }
-}
-
-
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "golang.org/x/time/rate"
+
+    wpkg "worker_pool"
+    "worker_pool/metrics"
+)
+
+// Server wires HTTP endpoints to an internal buffered queue and a worker pool.
+type Server struct {
+    httpServer   *http.Server
+    jobs         chan Task
+    slots        chan struct{}        // one per accepted task that has not started yet; QUEUE_SIZE bounds admission
+    tasks        map[string]Task
+    states       map[string]TaskState
+    retries      map[string]int
+    lastErrors   map[string]string    // error of each task's most recent failed attempt
+    results      map[string]string    // runner output of each task that finished successfully
+    times        map[string]taskTimes // when each task was enqueued, started and finished
+    taskCtxs     map[string]taskCtx   // per-task contexts, cancelled by DELETE /tasks/{id}
+    pending      map[string]enqueuing // tasks being enqueued, registered once in the jobs channel
+    submitted    map[string]Task      // tasks handed to the pool and not yet started
+    restored     []Task               // restored tasks waiting for a queue slot (see feedRestored)
+    cancelling   map[string]struct{}  // cancelled tasks whose job is still queued, running or waiting to retry
+    retryTimers  map[*time.Timer]Task // pending retry requeues, stopped on shutdown
+    retryWG      sync.WaitGroup       // retry timers scheduled and not yet finished
+    readers      sync.WaitGroup       // queue readers (workerLoop, feedRestored) still running
+    readCtx      context.Context      // shared by the queue readers, cancelled once the pool stops
+    retryLimiter *rate.Limiter        // retry budget: caps requeues per second; nil is unlimited
+    store        StateStore
+    mu           sync.Mutex
+    shuttingDown bool
+    shutdownOnce sync.Once
+    events       *broker
+    idemKeys     map[string]idempotencyEntry
+    idemOrder    []idempotencyKey     // reserved keys, oldest first, so expiry only looks at the front
+    idemTTL      time.Duration
+    pool         *wpkg.WorkerPool
+    webhooks     *wpkg.WorkerPool // delivers callbacks (see notify)
+    metrics      *metrics.Collector
+    retried      prometheus.Counter // task retries; the pool counts every attempt as a task of its own
+    runner       TaskRunner
+    backoff      BackoffStrategy
+    deadLetters  []func(Task)
+    snapshotPath string // QUEUE_SNAPSHOT; empty fails queued tasks on shutdown
+    adminToken   string // ADMIN_TOKEN; empty disables /admin endpoints
+
+    // MaxPayloadBytes caps the request body of /enqueue and /enqueue/batch;
+    // larger bodies are rejected with 413.
+    MaxPayloadBytes int64
+}
+
+// defaultMaxPayloadBytes is the default request body limit.
+const defaultMaxPayloadBytes = 1 << 20
+
+// maxTaskPayload caps the length of a single task's payload.
+const maxTaskPayload = 64 << 10
+
+// idempotencyTTL is how long an Idempotency-Key is remembered after the
+// request that used it was accepted.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyEntry records the task accepted under an Idempotency-Key.
+type idempotencyEntry struct {
+    taskID string
+    at     time.Time
+}
+
+// idempotencyKey is a reservation in Server.idemOrder. The key's map entry
+// may have been released and reserved again since; at tells them apart.
+type idempotencyKey struct {
+    key string
+    at  time.Time
+}
+
+// taskCtx is the context a task runs under and the func that cancels it.
+type taskCtx struct {
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+// taskTimes records when a task was first accepted, when its first attempt
+// started and when it reached a final state; zero means not yet.
+type taskTimes struct {
+    enqueued time.Time
+    started  time.Time
+    finished time.Time
+}
+
+// errQueueFull is returned by enqueue when QUEUE_SIZE tasks are already
+// waiting to start.
+var errQueueFull = errors.New("queue full")
+
+// errTaskExists is returned by enqueue for an ID that is queued, running or
+// cancelled with its job not yet consumed. Only done, failed and consumed
+// cancelled tasks can be enqueued again.
+var errTaskExists = errors.New("task already exists")
+
+// enqueuing is a task enqueue is placing into the jobs channel. It is
+// registered as queued only once it is in the channel, so a rejected enqueue
+// leaves no trace; ctx is the enqueue request's context.
+type enqueuing struct {
+    task Task
+    ctx  context.Context
+}
+
+// newServer constructs a Server, restores persisted and snapshotted tasks
+// and starts queue readers. runner performs each task; nil means simulateWork.
+// backoff spaces out retries; nil means exponential defaultBackoff.
+func newServer(workers, queueSize int, store StateStore, runner TaskRunner, backoff BackoffStrategy) *Server {
+    if runner == nil {
+        runner = simulateWork
+    }
+    if backoff == nil {
+        backoff = defaultBackoff
+    }
+    s := &Server{
+        jobs:         make(chan Task, queueSize),
+        slots:        make(chan struct{}, queueSize),
+        tasks:        make(map[string]Task, queueSize),
+        states:       make(map[string]TaskState, queueSize),
+        retries:      make(map[string]int, queueSize),
+        lastErrors:   make(map[string]string),
+        results:      make(map[string]string),
+        times:        make(map[string]taskTimes),
+        taskCtxs:     make(map[string]taskCtx),
+        pending:      make(map[string]enqueuing),
+        submitted:    make(map[string]Task),
+        cancelling:   make(map[string]struct{}),
+        retryTimers:  make(map[*time.Timer]Task),
+        retryLimiter: newRetryLimiter(defaultRetryRate),
+        store:        store,
+        events:       newBroker(),
+        idemKeys:     make(map[string]idempotencyEntry),
+        idemTTL:      idempotencyTTL,
+        pool:         wpkg.NewWorkerPool(workers, wpkg.WithPriorityQueue(), wpkg.WithQueueSize(queueSize)),
+        webhooks:     wpkg.NewWorkerPoolWithQueue(webhookWorkers, webhookQueueSize),
+        runner:       runner,
+        backoff:      backoff,
+        snapshotPath: os.Getenv(snapshotEnv),
+        adminToken:   os.Getenv(adminTokenEnv),
+
+        MaxPayloadBytes: defaultMaxPayloadBytes,
+    }
+    registry := prometheus.NewRegistry()
+    s.metrics = metrics.New(registry, s.pool)
+    s.retried = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: "queue",
+        Name:      "task_retries_total",
+        Help:      "Failed task attempts requeued for another try.",
+    })
+    registry.MustRegister(s.retried)
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/enqueue", s.handleEnqueue)
+    mux.HandleFunc("/enqueue/batch", s.handleEnqueueBatch)
+    mux.HandleFunc("/tasks", s.handleTasks)
+    mux.HandleFunc("/tasks/", s.handleTask)
+    mux.HandleFunc("/results/", s.handleResult)
+    mux.HandleFunc("/events", s.handleEvents)
+    mux.HandleFunc("/healthz", s.handleHealth)
+    mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+    mux.HandleFunc("/metrics.json", s.handleMetricsJSON)
+    mux.HandleFunc("/admin/workers", s.handleAdminWorkers)
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        _, _ = w.Write([]byte("Worker Queue API\n\nPOST /enqueue {id,payload,max_retries,callback_url,priority}\nPOST /enqueue/batch [{...}, ...]\nGET /tasks?state=\nGET /tasks/{id}\nDELETE /tasks/{id}\nGET /results/{id}\nGET /events\nGET /healthz\nGET /metrics\nGET /metrics.json\nPOST /admin/workers {count}\n"))
+    })
+    s.httpServer = &http.Server{Addr: ":8080", Handler: mux}
+
+    // Start queue readers; each reader submits jobs to the pool.
+    readCtx, cancel := context.WithCancel(context.Background())
+    s.readCtx = readCtx
+    go func() {
+        <-s.pool.Done()
+        cancel()
+    }()
+    s.readers.Add(workers)
+    for i := 0; i < workers; i++ {
+        go s.workerLoop()
+    }
+
+    // Restored tasks may outnumber the queue slots, so they are fed in as
+    // the readers' tasks start rather than all at once.
+    s.restore()
+    s.restoreSnapshot()
+    if len(s.restored) > 0 {
+        s.readers.Add(1)
+        go s.feedRestored()
+    }
+
+    return s
+}
+
+// handleHealth reports queue saturation and worker status. It returns 503
+// while shutting down, once the pool has stopped or when the queue is full,
+// so load balancers can route away from the instance.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    shuttingDown := s.shuttingDown
+    s.mu.Unlock()
+
+    h := HealthStatus{
+        QueueLen:     len(s.slots),
+        QueueCap:     cap(s.slots),
+        Workers:      s.pool.WorkerCount(),
+        Active:       s.pool.ActiveWorkers(),
+        ShuttingDown: shuttingDown,
+    }
+    status := http.StatusOK
+    if shuttingDown || !s.pool.IsRunning() || h.QueueLen >= h.QueueCap {
+        status = http.StatusServiceUnavailable
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(h)
+}
+
+// handleMetricsJSON serves a MetricsSnapshot for setups without Prometheus.
+func (s *Server) handleMetricsJSON(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+
+    snap := MetricsSnapshot{Pool: s.pool.Stats(), Tasks: make(map[TaskState]int)}
+    for _, st := range []TaskState{StateQueued, StateRunning, StateDone, StateFailed, StateCancelled} {
+        snap.Tasks[st] = 0
+    }
+    s.mu.Lock()
+    for _, st := range s.states {
+        snap.Tasks[st]++
+    }
+    s.mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(snap)
+}
+
+// handleEnqueue validates input and enqueues a task if buffer has space.
+// With an X-Enqueue-Wait header it waits up to that long for space instead.
+func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    if s.stopped() {
+        s.writeEnqueueError(w, wpkg.ErrPoolStopped)
+        return
+    }
+
+    wait, err := parseEnqueueWait(r.Header.Get(enqueueWaitHeader))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    var t Task
+    if !s.decodeBody(w, r, &t) {
+        return
+    }
+    if err := validateTask(t); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    key := r.Header.Get("Idempotency-Key")
+    if key != "" {
+        taskID, seen := s.reserveIdempotencyKey(key, t.ID)
+        if seen {
+            if taskID != t.ID {
+                http.Error(w, "idempotency key already used for task "+taskID, http.StatusConflict)
+                return
+            }
+            log.Printf("enqueue replayed id=%s idempotency_key=%s", t.ID, key)
+            w.WriteHeader(http.StatusAccepted)
+            _, _ = w.Write([]byte("enqueued"))
+            return
+        }
+    }
+
+    if err := s.enqueueWait(r.Context(), t, wait); err != nil {
+        if key != "" {
+            s.releaseIdempotencyKey(key)
+        }
+        s.writeEnqueueError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusAccepted)
+    _, _ = w.Write([]byte("enqueued"))
+}
+
+// enqueueWaitHeader lets a client wait for queue space instead of getting
+// 429 at once, e.g. "X-Enqueue-Wait: 500ms".
+const enqueueWaitHeader = "X-Enqueue-Wait"
+
+// parseEnqueueWait parses the X-Enqueue-Wait header; empty means no wait.
+func parseEnqueueWait(v string) (time.Duration, error) {
+    if v == "" {
+        return 0, nil
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil || d < 0 {
+        return 0, fmt.Errorf("%s must be a non-negative duration", enqueueWaitHeader)
+    }
+    return d, nil
+}
+
+// writeEnqueueError reports why enqueue rejected a task. A full queue is
+// transient: 429 with an estimated Retry-After. A stopped pool is 503, as it
+// will not accept tasks again and the client should go elsewhere.
+func (s *Server) writeEnqueueError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, wpkg.ErrPoolStopped):
+        http.Error(w, "pool stopped", http.StatusServiceUnavailable)
+    case errors.Is(err, errTaskExists):
+        http.Error(w, err.Error(), http.StatusConflict)
+    case errors.Is(err, errQueueFull):
+        w.Header().Set("Retry-After", strconv.Itoa(s.retryAfter()))
+        http.Error(w, "queue full", http.StatusTooManyRequests)
+    default:
+        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+    }
+}
+
+// maxRetryAfter caps the Retry-After estimate for a full queue, in seconds.
+const maxRetryAfter = 60
+
+// retryAfter roughly estimates in whole seconds when the queue will have
+// room: waiting tasks times the mean task run time, spread over the pool's
+// workers. It is at least 1, also before any task has finished, and at most
+// maxRetryAfter.
+func (s *Server) retryAfter() int {
+    waiting := len(s.slots)
+    workers := max(s.pool.WorkerCount(), 1)
+    d := time.Duration(waiting) * s.pool.Latencies().Mean / time.Duration(workers)
+    secs := int((d + time.Second - 1) / time.Second)
+    return min(max(secs, 1), maxRetryAfter)
+}
+
+// stopped reports whether the server is shutting down or its pool has
+// stopped, so no new task can run.
+func (s *Server) stopped() bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.shuttingDown || !s.pool.IsRunning()
+}
+
+// reserveIdempotencyKey records key for taskID unless it is already known,
+// in which case it returns the task the key was first used for. Expired keys
+// are dropped on the way; reservations are made in time order, so they are
+// popped from the front of idemOrder until the first live one.
+func (s *Server) reserveIdempotencyKey(key, taskID string) (string, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    for len(s.idemOrder) > 0 && now.Sub(s.idemOrder[0].at) > s.idemTTL {
+        old := s.idemOrder[0]
+        if e, ok := s.idemKeys[old.key]; ok && e.at.Equal(old.at) {
+            delete(s.idemKeys, old.key)
+        }
+        s.idemOrder[0] = idempotencyKey{}
+        s.idemOrder = s.idemOrder[1:]
+    }
+    if e, ok := s.idemKeys[key]; ok {
+        return e.taskID, true
+    }
+    s.idemKeys[key] = idempotencyEntry{taskID: taskID, at: now}
+    s.idemOrder = append(s.idemOrder, idempotencyKey{key: key, at: now})
+    return taskID, false
+}
+
+// releaseIdempotencyKey forgets a key whose request was not accepted, so the
+// client can retry it.
+func (s *Server) releaseIdempotencyKey(key string) {
+    s.mu.Lock()
+    delete(s.idemKeys, key)
+    s.mu.Unlock()
+}
+
+// handleEnqueueBatch enqueues a JSON array of tasks, reporting a result per
+// task. It answers 202 when all were accepted and 207 when some were not.
+func (s *Server) handleEnqueueBatch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    if s.stopped() {
+        s.writeEnqueueError(w, wpkg.ErrPoolStopped)
+        return
+    }
+
+    var batch []Task
+    if !s.decodeBody(w, r, &batch) {
+        return
+    }
+    if len(batch) == 0 {
+        http.Error(w, "empty batch", http.StatusBadRequest)
+        return
+    }
+
+    results := make([]EnqueueResult, len(batch))
+    status := http.StatusAccepted
+    for i, t := range batch {
+        results[i].ID = t.ID
+        err := validateTask(t)
+        if err == nil {
+            err = s.enqueue(r.Context(), t)
+        }
+        if err != nil {
+            results[i].Error = err.Error()
+            status = http.StatusMultiStatus
+            continue
+        }
+        results[i].Accepted = true
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(results)
+}
+
+// decodeBody decodes the JSON request body into v, limited to
+// MaxPayloadBytes. On failure it writes 413 or 400 and returns false.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    r.Body = http.MaxBytesReader(w, r.Body, s.MaxPayloadBytes)
+    if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            http.Error(w, fmt.Sprintf("body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+            return false
+        }
+        http.Error(w, "invalid json", http.StatusBadRequest)
+        return false
+    }
+    return true
+}
+
+// validateTask checks the fields of an incoming task.
+func validateTask(t Task) error {
+    if t.ID == "" {
+        return errors.New("missing id")
+    }
+    if len(t.Payload) > maxTaskPayload {
+        return fmt.Errorf("payload exceeds %d bytes", maxTaskPayload)
+    }
+    if t.MaxRetries < 0 {
+        return errors.New("max_retries must be >= 0")
+    }
+    if t.CallbackURL != "" && !validCallbackURL(t.CallbackURL) {
+        return errors.New("callback_url must be an absolute http(s) URL")
+    }
+    if t.Priority < MinPriority || t.Priority > MaxPriority {
+        return fmt.Errorf("priority must be between %d and %d", MinPriority, MaxPriority)
+    }
+    return nil
+}
+
+// enqueue places the task into the channel if it has space and marks it queued.
+// ctx is the enqueue request's context; the task's own context derives from it.
+// A done or failed task with the same ID starts over: its retries, last error,
+// result and timestamps are cleared. It returns errTaskExists for an ID that
+// is queued, running or cancelled, errQueueFull when the channel is full and
+// wpkg.ErrPoolStopped once the server is shutting down or its pool has stopped.
+func (s *Server) enqueue(ctx context.Context, t Task) error {
+    return s.enqueueWait(ctx, t, 0)
+}
+
+// enqueueWait is enqueue that waits up to wait for space in the channel
+// before giving up with errQueueFull. It stops waiting early with
+// wpkg.ErrPoolStopped when the pool stops and with ctx.Err() when the
+// client goes away.
+func (s *Server) enqueueWait(ctx context.Context, t Task, wait time.Duration) error {
+    s.mu.Lock()
+    if s.shuttingDown || !s.pool.IsRunning() {
+        s.mu.Unlock()
+        log.Printf("enqueue rejected (pool stopped) id=%s", t.ID)
+        return wpkg.ErrPoolStopped
+    }
+    if err := s.reusableLocked(t.ID); err != nil {
+        s.mu.Unlock()
+        log.Printf("enqueue rejected (%v) id=%s", err, t.ID)
+        return err
+    }
+    s.pending[t.ID] = enqueuing{task: t, ctx: ctx}
+    s.mu.Unlock()
+
+    err := s.sendJob(ctx, t, wait)
+
+    s.mu.Lock()
+    if err == nil {
+        s.registerLocked(t.ID)
+    } else {
+        delete(s.pending, t.ID)
+    }
+    s.mu.Unlock()
+    return err
+}
+
+// reusableLocked reports whether a task with id may be enqueued: it is new,
+// done, failed, or cancelled and its job consumed (see consumeCancelledLocked);
+// until then the job may still wait in the channel or run. s.mu must be held.
+func (s *Server) reusableLocked(id string) error {
+    if _, ok := s.pending[id]; ok {
+        return fmt.Errorf("%w: being enqueued", errTaskExists)
+    }
+    st, ok := s.states[id]
+    if !ok || st == StateDone || st == StateFailed {
+        return nil
+    }
+    if _, held := s.cancelling[id]; st == StateCancelled && !held {
+        return nil
+    }
+    return fmt.Errorf("%w: %s", errTaskExists, st)
+}
+
+// registerLocked marks a pending task queued, replacing what is left of an
+// earlier run with the same ID. It is a no-op once the task is registered, so
+// both enqueue and the reader that picks the job up may call it; s.mu must be
+// held.
+func (s *Server) registerLocked(id string) {
+    p, ok := s.pending[id]
+    if !ok {
+        return
+    }
+    delete(s.pending, id)
+    delete(s.cancelling, id)
+    s.tasks[id] = p.task
+    s.retries[id] = 0
+    delete(s.lastErrors, id)
+    delete(s.results, id)
+    s.times[id] = taskTimes{}
+    s.taskCtxs[id] = newTaskCtx(p.ctx)
+    s.setStateLocked(id, StateQueued)
+}
+
+// sendJob takes a queue slot for t, waiting up to wait for one, and places t
+// into the jobs channel. The slot is given back once t starts (see
+// startTask), so it covers the jobs channel and the pool queue alike.
+func (s *Server) sendJob(ctx context.Context, t Task, wait time.Duration) error {
+    if wait <= 0 {
+        select {
+        case s.slots <- struct{}{}:
+            s.jobs <- t
+            log.Printf("enqueue accepted id=%s max_retries=%d", t.ID, t.MaxRetries)
+            return nil
+        default:
+            log.Printf("enqueue rejected (queue full) id=%s", t.ID)
+            return errQueueFull
+        }
+    }
+
+    timer := time.NewTimer(wait)
+    defer timer.Stop()
+    select {
+    case s.slots <- struct{}{}:
+        s.jobs <- t
+        log.Printf("enqueue accepted id=%s max_retries=%d", t.ID, t.MaxRetries)
+        return nil
+    case <-timer.C:
+        log.Printf("enqueue rejected (queue full after %s) id=%s", wait, t.ID)
+        return errQueueFull
+    case <-s.pool.Done():
+        log.Printf("enqueue rejected (pool stopped) id=%s", t.ID)
+        return wpkg.ErrPoolStopped
+    case <-ctx.Done():
+        log.Printf("enqueue abandoned id=%s: %v", t.ID, ctx.Err())
+        return ctx.Err()
+    }
+}
+
+// handleTasks lists tasks sorted by ID, optionally filtered by ?state=.
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    filter := TaskState(r.URL.Query().Get("state"))
+    if filter != "" && !filter.valid() {
+        http.Error(w, "unknown state", http.StatusBadRequest)
+        return
+    }
+
+    s.mu.Lock()
+    list := make([]TaskStatus, 0, len(s.states))
+    for id, st := range s.states {
+        if filter == "" || st == filter {
+            list = append(list, s.statusLocked(id))
+        }
+    }
+    s.mu.Unlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(list)
+}
+
+// handleTask returns the state and retry count of a single task (GET)
+// or cancels a queued or running task (DELETE). A running task has its
+// context cancelled and is expected to stop cooperatively.
+func (s *Server) handleTask(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    id := strings.TrimPrefix(r.URL.Path, "/tasks/")
+    if id == "" {
+        http.Error(w, "missing id", http.StatusBadRequest)
+        return
+    }
+
+    s.mu.Lock()
+    st, ok := s.states[id]
+    cancelled := false
+    if ok && r.Method == http.MethodDelete && (st == StateQueued || st == StateRunning) {
+        // A queued task may already sit in the jobs channel; processTask
+        // skips it. setStateLocked cancels the context of a running one.
+        // Either way the ID stays taken until its job is consumed.
+        st = StateCancelled
+        s.setStateLocked(id, st)
+        s.cancelling[id] = struct{}{}
+        cancelled = true
+    }
+    status := s.statusLocked(id)
+    s.mu.Unlock()
+    if !ok {
+        http.Error(w, "task not found", http.StatusNotFound)
+        return
+    }
+    if r.Method == http.MethodDelete {
+        if !cancelled {
+            http.Error(w, "task is "+string(st)+", not queued or running", http.StatusConflict)
+            return
+        }
+        log.Printf("task cancelled id=%s", id)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(status)
+}
+
+// handleResult returns the output of a finished task (200), 202 with the
+// task's status while it is queued or running, and 404 for unknown tasks and
+// tasks that finished without a result (failed or cancelled).
+func (s *Server) handleResult(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    id := strings.TrimPrefix(r.URL.Path, "/results/")
+    if id == "" {
+        http.Error(w, "missing id", http.StatusBadRequest)
+        return
+    }
+
+    s.mu.Lock()
+    st, ok := s.states[id]
+    result, done := s.results[id]
+    status := s.statusLocked(id)
+    s.mu.Unlock()
+
+    switch {
+    case !ok:
+        http.Error(w, "task not found", http.StatusNotFound)
+    case st == StateQueued || st == StateRunning:
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusAccepted)
+        _ = json.NewEncoder(w).Encode(status)
+    case !done:
+        http.Error(w, "task is "+string(st)+", no result", http.StatusNotFound)
+    default:
+        w.Header().Set("Content-Type", "application/json")
+        _ = json.NewEncoder(w).Encode(TaskResult{ID: id, Result: result})
+    }
+}
+
+// statusLocked builds the public view of a task; s.mu must be held.
+func (s *Server) statusLocked(id string) TaskStatus {
+    tt := s.times[id]
+    return TaskStatus{
+        ID:         id,
+        State:      s.states[id],
+        Retries:    s.retries[id],
+        LastError:  s.lastErrors[id],
+        EnqueuedAt: timePtr(tt.enqueued),
+        StartedAt:  timePtr(tt.started),
+        FinishedAt: timePtr(tt.finished),
+    }
+}
+
+// timePtr returns nil for the zero time so that unset timestamps are omitted
+// from JSON.
+func timePtr(t time.Time) *time.Time {
+    if t.IsZero() {
+        return nil
+    }
+    return &t
+}
+
+// timeOrZero is the inverse of timePtr.
+func timeOrZero(t *time.Time) time.Time {
+    if t == nil {
+        return time.Time{}
+    }
+    return *t
+}
+
+func (s *Server) setState(id string, st TaskState) {
+    s.mu.Lock()
+    s.setStateLocked(id, st)
+    s.mu.Unlock()
+}
+
+// setStateLocked records a state transition, persists it and publishes it to
+// /events subscribers; s.mu must be held. It stamps the task's first enqueue
+// and first start; a final state stamps the finish and cancels and forgets
+// the task's context.
+func (s *Server) setStateLocked(id string, st TaskState) {
+    from := s.states[id]
+    s.states[id] = st
+
+    now := time.Now()
+    tt := s.times[id]
+    switch st {
+    case StateQueued:
+        if tt.enqueued.IsZero() {
+            tt.enqueued = now
+        }
+    case StateRunning:
+        if tt.started.IsZero() {
+            tt.started = now
+        }
+    case StateDone, StateFailed, StateCancelled:
+        tt.finished = now
+        if tc, ok := s.taskCtxs[id]; ok {
+            tc.cancel()
+            delete(s.taskCtxs, id)
+        }
+    }
+    s.times[id] = tt
+    s.persistLocked(id)
+    s.events.publish(TaskEvent{ID: id, From: from, To: st, TS: now})
+}
+
+// startTask marks the task running unless it was cancelled while queued
+// or shutdown has already taken it back from the pool (see takeUnstarted).
+// Either way a task leaving the pool queue frees its queue slot.
+func (s *Server) startTask(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.submitted[id]; !ok {
+        return false
+    }
+    delete(s.submitted, id)
+    <-s.slots
+    if s.consumeCancelledLocked(id) {
+        return false
+    }
+    s.setStateLocked(id, StateRunning)
+    return true
+}
+
+// newTaskCtx derives a task context from the enqueue request's ctx. The
+// request ends as soon as the task is accepted, so its cancellation is not
+// inherited; only its values are, and the task is cancelled on its own.
+func newTaskCtx(ctx context.Context) taskCtx {
+    ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+    return taskCtx{ctx: ctx, cancel: cancel}
+}
+
+// taskContext returns the context of task id. Tasks restored from the store
+// or a snapshot get a fresh one on first use. A task the reader picks up
+// before enqueue has registered it is registered here.
+func (s *Server) taskContext(id string) context.Context {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.registerLocked(id)
+    tc, ok := s.taskCtxs[id]
+    if !ok {
+        tc = newTaskCtx(context.Background())
+        s.taskCtxs[id] = tc
+    }
+    return tc.ctx
+}
+
+// cancelled reports whether task id was cancelled; its job ends here, so
+// the ID may be enqueued again.
+func (s *Server) cancelled(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.consumeCancelledLocked(id)
+}
+
+// consumeCancelledLocked reports whether task id was cancelled and, if so,
+// records that its job is gone. s.mu must be held.
+func (s *Server) consumeCancelledLocked(id string) bool {
+    if s.states[id] != StateCancelled {
+        return false
+    }
+    delete(s.cancelling, id)
+    return true
+}
+
+// finishTask stores the runner's output and marks the task done.
+func (s *Server) finishTask(id, result string) {
+    s.mu.Lock()
+    s.results[id] = result
+    s.setStateLocked(id, StateDone)
+    s.mu.Unlock()
+}
+
+// failUnlessCancelled marks the task failed, leaving cancelled tasks as is.
+func (s *Server) failUnlessCancelled(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.states[id] == StateCancelled {
+        return false
+    }
+    s.setStateLocked(id, StateFailed)
+    return true
+}
+
+// recordError remembers err as the task's last error. It is persisted with
+// the retry count or state change that follows the failed attempt.
+func (s *Server) recordError(id string, err error) {
+    s.mu.Lock()
+    s.lastErrors[id] = err.Error()
+    s.mu.Unlock()
+}
+
+func (s *Server) incRetry(id string) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.retries[id] = s.retries[id] + 1
+    s.persistLocked(id)
+    return s.retries[id]
+}
+
+// persistLocked writes the task's current record to the store; s.mu must be held.
+func (s *Server) persistLocked(id string) {
+    tt := s.times[id]
+    rec := TaskRecord{
+        Task:       s.tasks[id],
+        State:      s.states[id],
+        Retries:    s.retries[id],
+        LastError:  s.lastErrors[id],
+        Result:     s.results[id],
+        EnqueuedAt: timePtr(tt.enqueued),
+        StartedAt:  timePtr(tt.started),
+        FinishedAt: timePtr(tt.finished),
+    }
+    if err := s.store.Set(rec); err != nil {
+        log.Printf("store: persist failed id=%s error=%v", id, err)
+    }
+}
+
+// restore loads persisted records and re-enqueues tasks that were still
+// queued or running when the previous process stopped; feedRestored places
+// them into the jobs channel.
+func (s *Server) restore() {
+    records, err := s.store.List()
+    if err != nil {
+        log.Printf("store: load failed error=%v", err)
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, rec := range records {
+        id := rec.Task.ID
+        s.tasks[id] = rec.Task
+        s.states[id] = rec.State
+        s.retries[id] = rec.Retries
+        if rec.LastError != "" {
+            s.lastErrors[id] = rec.LastError
+        }
+        if rec.State == StateDone {
+            s.results[id] = rec.Result
+        }
+        s.times[id] = taskTimes{
+            enqueued: timeOrZero(rec.EnqueuedAt),
+            started:  timeOrZero(rec.StartedAt),
+            finished: timeOrZero(rec.FinishedAt),
+        }
+        if rec.State != StateQueued && rec.State != StateRunning {
+            continue
+        }
+        s.setStateLocked(id, StateQueued)
+        s.restored = append(s.restored, rec.Task)
+        log.Printf("restore: requeued id=%s", id)
+    }
+}
+
+// OnDeadLetter registers a handler for tasks that failed permanently after
+// exhausting their retries. Handlers run on their own goroutine so a slow
+// consumer never blocks a pool worker.
+func (s *Server) OnDeadLetter(handler func(Task)) {
+    if handler == nil {
+        return
+    }
+    s.mu.Lock()
+    s.deadLetters = append(s.deadLetters, handler)
+    s.mu.Unlock()
+}
+
+// deadLetter hands a permanently failed task to the registered handlers.
+func (s *Server) deadLetter(t Task) {
+    s.mu.Lock()
+    handlers := s.deadLetters
+    s.mu.Unlock()
+    for _, h := range handlers {
+        go func() {
+            defer func() {
+                if r := recover(); r != nil {
+                    log.Printf("dead letter handler panic id=%s: %v", t.ID, r)
+                }
+            }()
+            h(t)
+        }()
+    }
+}
+
+func (s *Server) getRetry(id string) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.retries[id]
+}
+
+// feedRestored places restored tasks into the jobs channel in order, each
+// once it gets a queue slot, until the pool stops. Shutdown snapshots or
+// fails those still waiting along with the rest of the queue.
+func (s *Server) feedRestored() {
+    defer s.readers.Done()
+    for {
+        select {
+        case s.slots <- struct{}{}:
+        case <-s.readCtx.Done():
+            return
+        }
+        s.mu.Lock()
+        t := s.restored[0]
+        s.restored = s.restored[1:]
+        s.jobs <- t
+        left := len(s.restored)
+        s.mu.Unlock()
+        if left == 0 {
+            return
+        }
+    }
+}
+
+// workerLoop feeds queued jobs into the pool, which orders them by priority,
+// until the pool stops. A task keeps its queue slot until it leaves the pool
+// queue, and the pool queue holds QUEUE_SIZE tasks, as many as there are
+// slots, so submission never waits for space.
+func (s *Server) workerLoop() {
+    defer s.readers.Done()
+    for {
+        select {
+        case <-s.pool.Done():
+            return
+        case t := <-s.jobs:
+            task := t
+            ctx := s.taskContext(task.ID)
+            s.mu.Lock()
+            s.submitted[task.ID] = task
+            s.mu.Unlock()
+            if err := s.pool.SubmitPriorityBlockingContext(s.readCtx, task.Priority, func() error { return s.processTask(ctx, task) }); err != nil {
+                // the pool only fails a blocking submit once it stops;
+                // shutdown snapshots or fails the task with the others
+                // the pool never started
+                log.Printf("task not submitted (pool: %v) id=%s", err, task.ID)
+            }
+        }
+    }
+}
+
+
@@ -0,0 +1,1028 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    wpkg "worker_pool"
+)
+
+// newTestServer builds a Server and shuts it down when the test ends.
+func newTestServer(t *testing.T, workers, queueSize int) *Server {
+    t.Helper()
+    s := newServer(workers, queueSize, newMemoryStore(), nil, nil)
+    t.Cleanup(func() {
+        ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+        defer cancel()
+        _ = s.shutdown(ctx)
+    })
+    return s
+}
+
+// blockPool occupies every pool worker until the returned func is called.
+func blockPool(t *testing.T, s *Server, workers int) (release func()) {
+    t.Helper()
+    started := make(chan struct{}, workers)
+    unblock := make(chan struct{})
+    for i := 0; i < workers; i++ {
+        if err := s.pool.Submit(func() error {
+            started <- struct{}{}
+            <-unblock
+            return nil
+        }); err != nil {
+            t.Fatalf("block pool: %v", err)
+        }
+    }
+    for i := 0; i < workers; i++ {
+        <-started
+    }
+    return func() { close(unblock) }
+}
+
+// takeJob receives a job from the jobs channel and frees its queue slot, as
+// a reader and a starting worker would.
+func takeJob(s *Server) Task {
+    t := <-s.jobs
+    <-s.slots
+    return t
+}
+
+func doRequest(s *Server, method, path, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    rec := httptest.NewRecorder()
+    s.httpServer.Handler.ServeHTTP(rec, req)
+    return rec
+}
+
+func getStatus(t *testing.T, s *Server, id string) TaskStatus {
+    t.Helper()
+    rec := doRequest(s, http.MethodGet, "/tasks/"+id, "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /tasks/%s: status %d, body %q", id, rec.Code, rec.Body.String())
+    }
+    var st TaskStatus
+    if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+        t.Fatalf("decode status: %v", err)
+    }
+    return st
+}
+
+// waitForState polls /tasks/{id} until the task reaches want.
+func waitForState(t *testing.T, s *Server, id string, want TaskState, timeout time.Duration) TaskStatus {
+    t.Helper()
+    deadline := time.Now().Add(timeout)
+    for {
+        st := getStatus(t, s, id)
+        if st.State == want {
+            return st
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("task %s: state %q, want %q", id, st.State, want)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestHandleTask(t *testing.T) {
+    t.Run("state transitions from queued to done", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        release := blockPool(t, s, 1)
+
+        // generous retries so the simulated 20% failure rate can't fail the task
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"t1","payload":"x","max_retries":20}`)
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue: status %d", rec.Code)
+        }
+        if st := getStatus(t, s, "t1"); st.State != StateQueued {
+            t.Fatalf("state %q, want %q", st.State, StateQueued)
+        }
+
+        release()
+        st := waitForState(t, s, "t1", StateDone, 20*time.Second)
+        if st.ID != "t1" {
+            t.Errorf("id %q, want %q", st.ID, "t1")
+        }
+    })
+
+    t.Run("unknown id returns 404", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        if rec := doRequest(s, http.MethodGet, "/tasks/missing", ""); rec.Code != http.StatusNotFound {
+            t.Errorf("status %d, want %d", rec.Code, http.StatusNotFound)
+        }
+    })
+
+    t.Run("missing id and wrong method are rejected", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        if rec := doRequest(s, http.MethodGet, "/tasks/", ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("missing id: status %d, want %d", rec.Code, http.StatusBadRequest)
+        }
+        if rec := doRequest(s, http.MethodPost, "/tasks/t1", ""); rec.Code != http.StatusMethodNotAllowed {
+            t.Errorf("POST: status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+        }
+    })
+}
+
+func TestEnqueueBatch(t *testing.T) {
+    post := func(t *testing.T, s *Server, body string) (int, []EnqueueResult) {
+        t.Helper()
+        rec := doRequest(s, http.MethodPost, "/enqueue/batch", body)
+        var out []EnqueueResult
+        if rec.Code == http.StatusAccepted || rec.Code == http.StatusMultiStatus {
+            if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+                t.Fatalf("decode: %v", err)
+            }
+        }
+        return rec.Code, out
+    }
+
+    t.Run("batch larger than the queue is partially accepted", func(t *testing.T) {
+        // no queue readers, so the jobs channel holds exactly queueSize tasks
+        s := newTestServer(t, 0, 2)
+
+        code, results := post(t, s, `[{"id":"a"},{"id":"b"},{"id":"c"},{"id":""},{"id":"d"}]`)
+        if code != http.StatusMultiStatus {
+            t.Fatalf("status %d, want %d", code, http.StatusMultiStatus)
+        }
+        want := []EnqueueResult{
+            {ID: "a", Accepted: true},
+            {ID: "b", Accepted: true},
+            {ID: "c", Error: "queue full"},
+            {ID: "", Error: "missing id"},
+            {ID: "d", Error: "queue full"},
+        }
+        if len(results) != len(want) {
+            t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+        }
+        for i := range want {
+            if results[i] != want[i] {
+                t.Errorf("result %d: %+v, want %+v", i, results[i], want[i])
+            }
+        }
+    })
+
+    t.Run("fully accepted batch returns 202", func(t *testing.T) {
+        s := newTestServer(t, 0, 8)
+        code, results := post(t, s, `[{"id":"a"},{"id":"b"}]`)
+        if code != http.StatusAccepted || len(results) != 2 || !results[0].Accepted || !results[1].Accepted {
+            t.Errorf("status %d results %+v, want 202 with both accepted", code, results)
+        }
+    })
+
+    t.Run("malformed, empty and shutting-down requests are rejected", func(t *testing.T) {
+        s := newTestServer(t, 0, 8)
+        if code, _ := post(t, s, `{"id":"a"}`); code != http.StatusBadRequest {
+            t.Errorf("object body: status %d, want %d", code, http.StatusBadRequest)
+        }
+        if code, _ := post(t, s, `[]`); code != http.StatusBadRequest {
+            t.Errorf("empty batch: status %d, want %d", code, http.StatusBadRequest)
+        }
+        s.mu.Lock()
+        s.shuttingDown = true
+        s.mu.Unlock()
+        if code, _ := post(t, s, `[{"id":"a"}]`); code != http.StatusServiceUnavailable {
+            t.Errorf("shutting down: status %d, want %d", code, http.StatusServiceUnavailable)
+        }
+    })
+}
+
+func TestTaskPriority(t *testing.T) {
+    t.Run("high priority task runs before an earlier low priority one", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        order := make(chan string, 2)
+        s.runner = func(_ context.Context, t Task) (string, error) {
+            order <- t.ID
+            return "", nil
+        }
+        release := blockPool(t, s, 1)
+
+        for _, body := range []string{`{"id":"low"}`, `{"id":"high","priority":5}`} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", body); rec.Code != http.StatusAccepted {
+                t.Fatalf("enqueue %s: status %d", body, rec.Code)
+            }
+        }
+        // wait until both tasks sit in the pool queue behind the blocked worker
+        deadline := time.Now().Add(time.Second)
+        for s.pool.QueueLen() < 2 {
+            if time.Now().After(deadline) {
+                t.Fatalf("pool queue length %d, want 2", s.pool.QueueLen())
+            }
+            time.Sleep(5 * time.Millisecond)
+        }
+
+        release()
+        for _, want := range []string{"high", "low"} {
+            select {
+            case got := <-order:
+                if got != want {
+                    t.Errorf("ran %q, want %q", got, want)
+                }
+            case <-time.After(5 * time.Second):
+                t.Fatalf("timed out waiting for %q", want)
+            }
+        }
+    })
+
+    t.Run("out of range priority is rejected", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        for _, body := range []string{`{"id":"a","priority":-1}`, `{"id":"b","priority":10}`} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", body); rec.Code != http.StatusBadRequest {
+                t.Errorf("%s: status %d, want %d", body, rec.Code, http.StatusBadRequest)
+            }
+        }
+    })
+}
+
+func TestIdempotencyKey(t *testing.T) {
+    post := func(s *Server, key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/enqueue", strings.NewReader(body))
+        req.Header.Set("Idempotency-Key", key)
+        rec := httptest.NewRecorder()
+        s.httpServer.Handler.ServeHTTP(rec, req)
+        return rec
+    }
+
+    t.Run("repeated request is enqueued once", func(t *testing.T) {
+        // no queue readers, so every accepted task stays in the jobs channel
+        s := newTestServer(t, 0, 8)
+        for i := 0; i < 2; i++ {
+            if rec := post(s, "k1", `{"id":"t1"}`); rec.Code != http.StatusAccepted {
+                t.Fatalf("request %d: status %d", i, rec.Code)
+            }
+        }
+        if n := len(s.jobs); n != 1 {
+            t.Errorf("jobs queued %d, want 1", n)
+        }
+    })
+
+    t.Run("key reused for another task conflicts", func(t *testing.T) {
+        s := newTestServer(t, 0, 8)
+        _ = post(s, "k1", `{"id":"t1"}`)
+        if rec := post(s, "k1", `{"id":"t2"}`); rec.Code != http.StatusConflict {
+            t.Errorf("status %d, want %d", rec.Code, http.StatusConflict)
+        }
+    })
+
+    t.Run("rejected request does not consume the key", func(t *testing.T) {
+        s := newTestServer(t, 0, 1)
+        _ = post(s, "k0", `{"id":"filler"}`)
+        if rec := post(s, "k1", `{"id":"t1"}`); rec.Code != http.StatusTooManyRequests {
+            t.Fatalf("full queue: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+        }
+        takeJob(s)
+        if rec := post(s, "k1", `{"id":"t1"}`); rec.Code != http.StatusAccepted || len(s.jobs) != 1 {
+            t.Errorf("retry: status %d, jobs %d; want 202 and 1", rec.Code, len(s.jobs))
+        }
+    })
+
+    t.Run("expired key is forgotten", func(t *testing.T) {
+        s := newTestServer(t, 0, 8)
+        s.idemTTL = 10 * time.Millisecond
+        _ = post(s, "k1", `{"id":"t1"}`)
+        time.Sleep(20 * time.Millisecond)
+        // a live key used for another task would be 409
+        if rec := post(s, "k1", `{"id":"t2"}`); rec.Code != http.StatusAccepted {
+            t.Errorf("status %d, want %d after the key expired", rec.Code, http.StatusAccepted)
+        }
+        if n := len(s.jobs); n != 2 {
+            t.Errorf("jobs queued %d, want 2 after the key expired", n)
+        }
+    })
+
+    t.Run("released key reserved again outlives its first expiry", func(t *testing.T) {
+        s := newTestServer(t, 0, 1)
+        s.idemTTL = 50 * time.Millisecond
+        _ = post(s, "k0", `{"id":"filler"}`)
+        if rec := post(s, "k1", `{"id":"t1"}`); rec.Code != http.StatusTooManyRequests {
+            t.Fatalf("full queue: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+        }
+        time.Sleep(30 * time.Millisecond)
+        takeJob(s)
+        if rec := post(s, "k1", `{"id":"t1"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("retry: status %d, want %d", rec.Code, http.StatusAccepted)
+        }
+        // the first reservation has expired by now, the second has not
+        time.Sleep(30 * time.Millisecond)
+        if rec := post(s, "k1", `{"id":"t2"}`); rec.Code != http.StatusConflict {
+            t.Errorf("status %d, want %d while the key is live", rec.Code, http.StatusConflict)
+        }
+    })
+}
+
+func TestCancelTask(t *testing.T) {
+    t.Run("cancelled queued task never runs", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        release := blockPool(t, s, 1)
+
+        for _, id := range []string{"victim", "after"} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`","max_retries":20}`); rec.Code != http.StatusAccepted {
+                t.Fatalf("enqueue %s: status %d", id, rec.Code)
+            }
+        }
+        rec := doRequest(s, http.MethodDelete, "/tasks/victim", "")
+        if rec.Code != http.StatusOK {
+            t.Fatalf("DELETE: status %d, body %q", rec.Code, rec.Body.String())
+        }
+
+        release()
+        // a single reader feeds the pool in order, so once "after" is done
+        // "victim" has already been dequeued
+        waitForState(t, s, "after", StateDone, 20*time.Second)
+        if st := getStatus(t, s, "victim"); st.State != StateCancelled || st.Retries != 0 {
+            t.Errorf("victim: state %q retries %d, want %q and 0", st.State, st.Retries, StateCancelled)
+        }
+    })
+
+    t.Run("running task observes cancellation", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        started := make(chan struct{})
+        observed := make(chan error, 1)
+        s.runner = func(ctx context.Context, _ Task) (string, error) {
+            close(started)
+            <-ctx.Done()
+            observed <- ctx.Err()
+            return "", ctx.Err()
+        }
+
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"long","max_retries":3}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue: status %d", rec.Code)
+        }
+        <-started
+        rec := doRequest(s, http.MethodDelete, "/tasks/long", "")
+        if rec.Code != http.StatusOK {
+            t.Fatalf("DELETE: status %d, body %q", rec.Code, rec.Body.String())
+        }
+
+        select {
+        case err := <-observed:
+            if !errors.Is(err, context.Canceled) {
+                t.Errorf("task context error %v, want %v", err, context.Canceled)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatal("running task did not observe cancellation")
+        }
+        s.pool.WaitIdle()
+        if st := getStatus(t, s, "long"); st.State != StateCancelled || st.Retries != 0 {
+            t.Errorf("long: state %q retries %d, want %q and 0", st.State, st.Retries, StateCancelled)
+        }
+    })
+
+    t.Run("finished task returns 409", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        release := blockPool(t, s, 1)
+        defer release()
+
+        for _, id := range []string{"d", "f"} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+                t.Fatalf("enqueue %s: status %d", id, rec.Code)
+            }
+        }
+        s.setState("d", StateDone)
+        s.setState("f", StateFailed)
+        for _, id := range []string{"d", "f"} {
+            if rec := doRequest(s, http.MethodDelete, "/tasks/"+id, ""); rec.Code != http.StatusConflict {
+                t.Errorf("DELETE %s: status %d, want %d", id, rec.Code, http.StatusConflict)
+            }
+        }
+        if rec := doRequest(s, http.MethodDelete, "/tasks/missing", ""); rec.Code != http.StatusNotFound {
+            t.Errorf("DELETE missing: status %d, want %d", rec.Code, http.StatusNotFound)
+        }
+    })
+}
+
+func TestDeadLetter(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    s.runner = func(context.Context, Task) (string, error) { return "", errors.New("always fails") }
+
+    dead := make(chan Task, 4)
+    s.OnDeadLetter(func(t Task) { dead <- t })
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"bad","payload":"p","max_retries":1}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    st := waitForState(t, s, "bad", StateFailed, 5*time.Second)
+    if st.Retries != 1 {
+        t.Errorf("retries %d, want 1", st.Retries)
+    }
+
+    select {
+    case got := <-dead:
+        if got.ID != "bad" || got.Payload != "p" {
+            t.Errorf("dead letter %+v, want id %q payload %q", got, "bad", "p")
+        }
+    case <-time.After(time.Second):
+        t.Fatal("task never reached the dead-letter handler")
+    }
+    select {
+    case got := <-dead:
+        t.Errorf("unexpected second dead letter %+v", got)
+    case <-time.After(200 * time.Millisecond):
+    }
+}
+
+func TestHandleTasks(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    release := blockPool(t, s, 1)
+    defer release()
+
+    for _, id := range []string{"c", "a", "b", "d"} {
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    s.setState("b", StateRunning)
+    s.setState("c", StateDone)
+    s.setState("d", StateRunning)
+
+    list := func(query string) []TaskStatus {
+        t.Helper()
+        rec := doRequest(s, http.MethodGet, "/tasks"+query, "")
+        if rec.Code != http.StatusOK {
+            t.Fatalf("GET /tasks%s: status %d", query, rec.Code)
+        }
+        var out []TaskStatus
+        if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+            t.Fatalf("decode: %v", err)
+        }
+        return out
+    }
+    ids := func(list []TaskStatus) string {
+        var out []string
+        for _, st := range list {
+            out = append(out, st.ID)
+        }
+        return strings.Join(out, ",")
+    }
+
+    if got := ids(list("")); got != "a,b,c,d" {
+        t.Errorf("all tasks: got %q, want %q", got, "a,b,c,d")
+    }
+    if got := ids(list("?state=running")); got != "b,d" {
+        t.Errorf("running tasks: got %q, want %q", got, "b,d")
+    }
+    if got := ids(list("?state=done")); got != "c" {
+        t.Errorf("done tasks: got %q, want %q", got, "c")
+    }
+    if rec := doRequest(s, http.MethodGet, "/tasks?state=bogus", ""); rec.Code != http.StatusBadRequest {
+        t.Errorf("unknown state: status %d, want %d", rec.Code, http.StatusBadRequest)
+    }
+}
+
+func TestEnqueueErrors(t *testing.T) {
+    t.Run("full queue is 429 with Retry-After", func(t *testing.T) {
+        s := newTestServer(t, 0, 1)
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"filler"}`)
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"t1"}`)
+        if rec.Code != http.StatusTooManyRequests {
+            t.Fatalf("status %d, want %d", rec.Code, http.StatusTooManyRequests)
+        }
+        if body := strings.TrimSpace(rec.Body.String()); body != "queue full" {
+            t.Errorf("body %q, want %q", body, "queue full")
+        }
+        // no task has finished yet, so there is no estimate
+        if ra := rec.Header().Get("Retry-After"); ra != "1" {
+            t.Errorf("Retry-After %q, want %q", ra, "1")
+        }
+    })
+
+    t.Run("Retry-After estimates from queue length and task time", func(t *testing.T) {
+        // one pool worker and no queue readers: the 20 tasks stay queued
+        s := newTestServer(t, 0, 20)
+        for i := 0; i < 2; i++ {
+            _ = s.pool.SubmitWait(func() error {
+                time.Sleep(200 * time.Millisecond)
+                return nil
+            })
+        }
+        for i := 0; i < 20; i++ {
+            _ = doRequest(s, http.MethodPost, "/enqueue", fmt.Sprintf(`{"id":"t%d"}`, i))
+        }
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"over"}`)
+        if rec.Code != http.StatusTooManyRequests {
+            t.Fatalf("status %d, want %d", rec.Code, http.StatusTooManyRequests)
+        }
+        // 20 tasks x ~200ms on one worker
+        ra, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+        if err != nil || ra < 4 || ra > 6 {
+            t.Errorf("Retry-After %q, want about 4 seconds", rec.Header().Get("Retry-After"))
+        }
+    })
+
+    t.Run("stopped pool is 503 without Retry-After", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        s.pool.Stop()
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"t1"}`)
+        if rec.Code != http.StatusServiceUnavailable {
+            t.Fatalf("status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+        }
+        if body := strings.TrimSpace(rec.Body.String()); body != "pool stopped" {
+            t.Errorf("body %q, want %q", body, "pool stopped")
+        }
+        if ra := rec.Header().Get("Retry-After"); ra != "" {
+            t.Errorf("Retry-After %q, want none", ra)
+        }
+        if len(s.jobs) != 0 {
+            t.Errorf("jobs queued %d, want 0", len(s.jobs))
+        }
+        if rec := doRequest(s, http.MethodGet, "/tasks/t1", ""); rec.Code != http.StatusNotFound {
+            t.Errorf("GET /tasks/t1: status %d, want %d", rec.Code, http.StatusNotFound)
+        }
+    })
+
+    t.Run("enqueue returns ErrPoolStopped once the pool stops", func(t *testing.T) {
+        s := newTestServer(t, 0, 8)
+        if err := s.enqueue(context.Background(), Task{ID: "a"}); err != nil {
+            t.Fatalf("enqueue: %v", err)
+        }
+        s.pool.Stop()
+        if err := s.enqueue(context.Background(), Task{ID: "b"}); !errors.Is(err, wpkg.ErrPoolStopped) {
+            t.Errorf("enqueue after Stop: %v, want %v", err, wpkg.ErrPoolStopped)
+        }
+    })
+}
+
+// TestBackpressure runs real pool workers: once the pool queue is full the
+// readers hold back, the jobs channel fills and enqueue answers 429 instead
+// of accepting tasks and failing them.
+func TestBackpressure(t *testing.T) {
+    release := make(chan struct{})
+    runner := func(ctx context.Context, task Task) (string, error) {
+        select {
+        case <-release:
+            return "ok", nil
+        case <-ctx.Done():
+            return "", ctx.Err()
+        }
+    }
+    const workers, queueSize = 2, 4
+    s := newServer(workers, queueSize, newMemoryStore(), runner, nil)
+    t.Cleanup(func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        _ = s.shutdown(ctx)
+    })
+    var once sync.Once
+    unblock := func() { once.Do(func() { close(release) }) }
+    t.Cleanup(unblock)
+
+    // a short wait rides out workers that have not yet started the previous
+    // task; 429 then means QUEUE_SIZE tasks wait behind the busy workers
+    var accepted []string
+    for i := 0; ; i++ {
+        if i > workers+queueSize {
+            t.Fatalf("no 429 after %d accepted tasks", len(accepted))
+        }
+        id := fmt.Sprintf("t%d", i)
+        req := httptest.NewRequest(http.MethodPost, "/enqueue", strings.NewReader(fmt.Sprintf(`{"id":%q}`, id)))
+        req.Header.Set(enqueueWaitHeader, "100ms")
+        rec := httptest.NewRecorder()
+        s.httpServer.Handler.ServeHTTP(rec, req)
+        if rec.Code == http.StatusTooManyRequests {
+            break
+        }
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d, body %q", id, rec.Code, rec.Body.String())
+        }
+        accepted = append(accepted, id)
+    }
+    if len(accepted) != workers+queueSize {
+        t.Errorf("accepted %d tasks, want %d (workers + QUEUE_SIZE)", len(accepted), workers+queueSize)
+    }
+    if rec := doRequest(s, http.MethodGet, "/healthz", ""); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("healthz status %d, want %d with a full queue", rec.Code, http.StatusServiceUnavailable)
+    }
+
+    for _, id := range accepted {
+        if st := getStatus(t, s, id); st.State == StateFailed {
+            t.Fatalf("task %s failed without running: %+v", id, st)
+        }
+    }
+    unblock()
+    for _, id := range accepted {
+        waitForState(t, s, id, StateDone, 5*time.Second)
+    }
+}
+
+func TestEnqueueWait(t *testing.T) {
+    post := func(s *Server, wait, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/enqueue", strings.NewReader(body))
+        req.Header.Set(enqueueWaitHeader, wait)
+        rec := httptest.NewRecorder()
+        s.httpServer.Handler.ServeHTTP(rec, req)
+        return rec
+    }
+
+    t.Run("accepted once a slot frees", func(t *testing.T) {
+        // no queue readers: the test frees the slot itself
+        s := newTestServer(t, 0, 1)
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"filler"}`)
+
+        freed := make(chan Task, 1)
+        go func() {
+            time.Sleep(50 * time.Millisecond)
+            freed <- takeJob(s)
+        }()
+
+        rec := post(s, "2s", `{"id":"t1"}`)
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("status %d, want %d, body %q", rec.Code, http.StatusAccepted, rec.Body.String())
+        }
+        if got := (<-freed).ID; got != "filler" {
+            t.Errorf("freed task %q, want %q", got, "filler")
+        }
+        if got := (<-s.jobs).ID; got != "t1" {
+            t.Errorf("queued task %q, want %q", got, "t1")
+        }
+    })
+
+    t.Run("times out with 429", func(t *testing.T) {
+        s := newTestServer(t, 0, 1)
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"filler"}`)
+
+        start := time.Now()
+        rec := post(s, "50ms", `{"id":"t1"}`)
+        if rec.Code != http.StatusTooManyRequests {
+            t.Fatalf("status %d, want %d", rec.Code, http.StatusTooManyRequests)
+        }
+        if body := strings.TrimSpace(rec.Body.String()); body != "queue full" {
+            t.Errorf("body %q, want %q", body, "queue full")
+        }
+        if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+            t.Errorf("returned after %v, want at least the 50ms wait", elapsed)
+        }
+    })
+
+    t.Run("invalid duration is 400", func(t *testing.T) {
+        s := newTestServer(t, 0, 1)
+        for _, wait := range []string{"soon", "-1s"} {
+            if rec := post(s, wait, `{"id":"t1"}`); rec.Code != http.StatusBadRequest {
+                t.Errorf("%s=%q: status %d, want %d", enqueueWaitHeader, wait, rec.Code, http.StatusBadRequest)
+            }
+        }
+        if len(s.jobs) != 0 {
+            t.Errorf("jobs queued %d, want 0", len(s.jobs))
+        }
+    })
+}
+
+func TestDuplicateEnqueue(t *testing.T) {
+    // newRunner counts runs per task; run n of a task waits for gate if
+    // block(id, n) and then fails if fail(id, n).
+    type counter struct {
+        mu   sync.Mutex
+        runs map[string]int
+    }
+    newRunner := func(c *counter, fail, block func(id string, n int) bool, gate <-chan struct{}) TaskRunner {
+        return func(_ context.Context, t Task) (string, error) {
+            c.mu.Lock()
+            c.runs[t.ID]++
+            n := c.runs[t.ID]
+            c.mu.Unlock()
+            if block(t.ID, n) {
+                <-gate
+            }
+            if fail(t.ID, n) {
+                return "", errors.New("boom")
+            }
+            return "ok", nil
+        }
+    }
+    runs := func(c *counter, id string) int {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+        return c.runs[id]
+    }
+
+    t.Run("queued or running id is rejected with 409", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        c := &counter{runs: make(map[string]int)}
+        gate := make(chan struct{})
+        never := func(string, int) bool { return false }
+        always := func(string, int) bool { return true }
+        s.runner = newRunner(c, never, always, gate)
+
+        for _, id := range []string{"running", "queued"} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+                t.Fatalf("enqueue %s: status %d", id, rec.Code)
+            }
+        }
+        waitForState(t, s, "running", StateRunning, 5*time.Second)
+        if st := getStatus(t, s, "queued"); st.State != StateQueued {
+            t.Fatalf("queued: state %q, want %q", st.State, StateQueued)
+        }
+
+        for _, id := range []string{"running", "queued"} {
+            rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`)
+            if rec.Code != http.StatusConflict {
+                t.Errorf("re-enqueue %s: status %d, want %d", id, rec.Code, http.StatusConflict)
+            }
+        }
+
+        close(gate)
+        waitForState(t, s, "running", StateDone, 5*time.Second)
+        waitForState(t, s, "queued", StateDone, 5*time.Second)
+        for _, id := range []string{"running", "queued"} {
+            if n := runs(c, id); n != 1 {
+                t.Errorf("%s ran %d times, want 1", id, n)
+            }
+        }
+    })
+
+    t.Run("cancelled id is reusable once its job is consumed", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        release := blockPool(t, s, 1)
+
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"c1"}`)
+        if rec := doRequest(s, http.MethodDelete, "/tasks/c1", ""); rec.Code != http.StatusOK {
+            t.Fatalf("DELETE: status %d", rec.Code)
+        }
+        // the cancelled job still waits behind the blocked worker
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"c1"}`); rec.Code != http.StatusConflict {
+            t.Errorf("re-enqueue while queued: status %d, want %d", rec.Code, http.StatusConflict)
+        }
+
+        release()
+        deadline := time.Now().Add(5 * time.Second)
+        for {
+            // generous retries so the simulated failure rate can't fail the rerun
+            rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"c1","max_retries":20}`)
+            if rec.Code == http.StatusAccepted {
+                break
+            }
+            if rec.Code != http.StatusConflict || time.Now().After(deadline) {
+                t.Fatalf("re-enqueue after drain: status %d, want %d", rec.Code, http.StatusAccepted)
+            }
+            time.Sleep(time.Millisecond)
+        }
+        waitForState(t, s, "c1", StateDone, 5*time.Second)
+    })
+
+    t.Run("done or failed id starts over and runs again", func(t *testing.T) {
+        s := newTestServer(t, 2, 8)
+        c := &counter{runs: make(map[string]int)}
+        gate := make(chan struct{})
+        // f1 fails its first run after one retry; the rerun of each task waits on gate
+        fail := func(id string, n int) bool { return id == "f1" && n <= 2 }
+        rerun := map[string]int{"d1": 2, "f1": 3}
+        s.runner = newRunner(c, fail, func(id string, n int) bool { return n == rerun[id] }, gate)
+
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"d1"}`)
+        _ = doRequest(s, http.MethodPost, "/enqueue", `{"id":"f1","max_retries":1}`)
+        waitForState(t, s, "d1", StateDone, 5*time.Second)
+        if st := waitForState(t, s, "f1", StateFailed, 20*time.Second); st.Retries != 1 || st.LastError == "" {
+            t.Fatalf("f1 before rerun: retries %d, last error %q; want 1 and set", st.Retries, st.LastError)
+        }
+
+        for _, body := range []string{`{"id":"d1"}`, `{"id":"f1"}`} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", body); rec.Code != http.StatusAccepted {
+                t.Fatalf("re-enqueue %s: status %d, want %d", body, rec.Code, http.StatusAccepted)
+            }
+        }
+        for _, id := range []string{"d1", "f1"} {
+            st := waitForState(t, s, id, StateRunning, 5*time.Second)
+            if st.Retries != 0 || st.LastError != "" || st.FinishedAt != nil {
+                t.Errorf("%s rerun: retries %d, last error %q, finished %v; want a fresh record",
+                    id, st.Retries, st.LastError, st.FinishedAt)
+            }
+        }
+        if rec := doRequest(s, http.MethodGet, "/results/d1", ""); rec.Code == http.StatusOK {
+            t.Errorf("GET /results/d1 during rerun: status 200, want the old result cleared")
+        }
+
+        close(gate)
+        waitForState(t, s, "d1", StateDone, 5*time.Second)
+        waitForState(t, s, "f1", StateDone, 5*time.Second)
+        if n := runs(c, "d1"); n != 2 {
+            t.Errorf("d1 ran %d times, want 2", n)
+        }
+        if n := runs(c, "f1"); n != 3 {
+            t.Errorf("f1 ran %d times, want 3", n)
+        }
+    })
+}
+
+func TestEnqueuePayloadLimit(t *testing.T) {
+    s := newTestServer(t, 0, 8)
+    s.MaxPayloadBytes = 256
+
+    big := `{"id":"big","payload":"` + strings.Repeat("x", 512) + `"}`
+    if rec := doRequest(s, http.MethodPost, "/enqueue", big); rec.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("oversized body: status %d, want 413", rec.Code)
+    }
+    if rec := doRequest(s, http.MethodPost, "/enqueue/batch", "["+big+"]"); rec.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("oversized batch: status %d, want 413", rec.Code)
+    }
+    if rec := doRequest(s, http.MethodGet, "/tasks/big", ""); rec.Code != http.StatusNotFound {
+        t.Errorf("rejected task should not exist, status %d", rec.Code)
+    }
+    if len(s.jobs) != 0 {
+        t.Errorf("%d jobs queued, want 0", len(s.jobs))
+    }
+
+    s.MaxPayloadBytes = defaultMaxPayloadBytes
+    long := `{"id":"long","payload":"` + strings.Repeat("x", maxTaskPayload+1) + `"}`
+    if rec := doRequest(s, http.MethodPost, "/enqueue", long); rec.Code != http.StatusBadRequest {
+        t.Errorf("oversized payload: status %d, want 400", rec.Code)
+    }
+}
+
+func TestHealth(t *testing.T) {
+    s := newTestServer(t, 0, 2)
+
+    health := func(wantCode int) HealthStatus {
+        t.Helper()
+        rec := doRequest(s, http.MethodGet, "/healthz", "")
+        if rec.Code != wantCode {
+            t.Fatalf("GET /healthz: status %d, want %d", rec.Code, wantCode)
+        }
+        var h HealthStatus
+        if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+            t.Fatalf("decode health: %v", err)
+        }
+        return h
+    }
+
+    if h := health(http.StatusOK); h.QueueLen != 0 || h.QueueCap != 2 || h.ShuttingDown {
+        t.Errorf("idle health %+v", h)
+    }
+
+    for _, id := range []string{"a", "b"} {
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    h := health(http.StatusServiceUnavailable)
+    if h.QueueLen != 2 || h.QueueCap != 2 || h.Workers != s.pool.WorkerCount() || h.Active != 0 || h.ShuttingDown {
+        t.Errorf("saturated health %+v", h)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    _ = s.shutdown(ctx)
+    if h := health(http.StatusServiceUnavailable); !h.ShuttingDown {
+        t.Errorf("health after shutdown %+v, want shutting_down", h)
+    }
+}
+
+func TestLastError(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    s.runner = func(context.Context, Task) (string, error) { return "", errors.New("upstream timeout") }
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"bad","max_retries":1}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    st := waitForState(t, s, "bad", StateFailed, 5*time.Second)
+    if st.LastError != "upstream timeout" {
+        t.Errorf("last_error %q, want %q", st.LastError, "upstream timeout")
+    }
+
+    rec := doRequest(s, http.MethodGet, "/tasks/bad", "")
+    if !strings.Contains(rec.Body.String(), `"last_error":"upstream timeout"`) {
+        t.Errorf("response %q has no last_error field", rec.Body.String())
+    }
+    saved, ok, err := s.store.Get("bad")
+    if err != nil || !ok || saved.LastError != "upstream timeout" {
+        t.Errorf("persisted record %+v (ok=%v, err=%v), want last_error", saved, ok, err)
+    }
+}
+
+func TestResults(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    release := make(chan struct{})
+    s.runner = func(_ context.Context, t Task) (string, error) {
+        if t.ID == "bad" {
+            return "", errors.New("boom")
+        }
+        <-release
+        return "result of " + t.ID, nil
+    }
+
+    for _, id := range []string{"ok", "bad"} {
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    if rec := doRequest(s, http.MethodGet, "/results/ok", ""); rec.Code != http.StatusAccepted {
+        t.Errorf("pending result: status %d, want %d", rec.Code, http.StatusAccepted)
+    }
+
+    close(release)
+    waitForState(t, s, "ok", StateDone, 5*time.Second)
+    rec := doRequest(s, http.MethodGet, "/results/ok", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /results/ok: status %d, body %q", rec.Code, rec.Body.String())
+    }
+    var res TaskResult
+    if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+        t.Fatalf("decode result: %v", err)
+    }
+    if res != (TaskResult{ID: "ok", Result: "result of ok"}) {
+        t.Errorf("result %+v", res)
+    }
+
+    waitForState(t, s, "bad", StateFailed, 5*time.Second)
+    for _, id := range []string{"bad", "missing"} {
+        if rec := doRequest(s, http.MethodGet, "/results/"+id, ""); rec.Code != http.StatusNotFound {
+            t.Errorf("GET /results/%s: status %d, want %d", id, rec.Code, http.StatusNotFound)
+        }
+    }
+}
+
+func TestMetricsJSON(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    release := make(chan struct{})
+    defer close(release)
+    s.runner = func(_ context.Context, t Task) (string, error) {
+        switch t.ID {
+        case "bad":
+            return "", errors.New("boom")
+        case "slow":
+            <-release
+        }
+        return "", nil
+    }
+
+    enqueue := func(id string) {
+        t.Helper()
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    enqueue("ok")
+    enqueue("bad")
+    waitForState(t, s, "ok", StateDone, 5*time.Second)
+    waitForState(t, s, "bad", StateFailed, 5*time.Second)
+    enqueue("slow")
+    waitForState(t, s, "slow", StateRunning, 5*time.Second)
+    enqueue("waiting")
+
+    rec := doRequest(s, http.MethodGet, "/metrics.json", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /metrics.json: status %d", rec.Code)
+    }
+    if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+        t.Errorf("content type %q", ct)
+    }
+    var snap MetricsSnapshot
+    if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+        t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+    }
+    want := map[TaskState]int{StateQueued: 1, StateRunning: 1, StateDone: 1, StateFailed: 1, StateCancelled: 0}
+    for st, n := range want {
+        if got, ok := snap.Tasks[st]; !ok || got != n {
+            t.Errorf("tasks[%s] = %d (present %v), want %d", st, got, ok, n)
+        }
+    }
+    if snap.Pool.Completed != 1 || snap.Pool.Failed != 1 || snap.Pool.Active != 1 {
+        t.Errorf("pool stats %+v, want 1 completed, 1 failed, 1 active", snap.Pool)
+    }
+}
+
+func TestTaskTimestamps(t *testing.T) {
+    s := newTestServer(t, 1, 8)
+    release := make(chan struct{})
+    s.runner = func(_ context.Context, t Task) (string, error) {
+        <-release
+        return "ok", nil
+    }
+
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"t1"}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    st := waitForState(t, s, "t1", StateRunning, 5*time.Second)
+    if st.EnqueuedAt == nil || st.StartedAt == nil || st.FinishedAt != nil {
+        t.Fatalf("running task timestamps: enqueued %v, started %v, finished %v; want only finished unset",
+            st.EnqueuedAt, st.StartedAt, st.FinishedAt)
+    }
+
+    time.Sleep(10 * time.Millisecond)
+    close(release)
+    st = waitForState(t, s, "t1", StateDone, 5*time.Second)
+    if st.EnqueuedAt == nil || st.StartedAt == nil || st.FinishedAt == nil {
+        t.Fatalf("done task timestamps: enqueued %v, started %v, finished %v; want all set",
+            st.EnqueuedAt, st.StartedAt, st.FinishedAt)
+    }
+    if st.StartedAt.Before(*st.EnqueuedAt) || !st.FinishedAt.After(*st.StartedAt) {
+        t.Errorf("timestamps out of order: enqueued %v, started %v, finished %v",
+            st.EnqueuedAt, st.StartedAt, st.FinishedAt)
+    }
+
+    rec, ok, err := s.store.Get("t1")
+    if err != nil || !ok {
+        t.Fatalf("store.Get: ok %v, err %v", ok, err)
+    }
+    if rec.FinishedAt == nil || !rec.FinishedAt.Equal(*st.FinishedAt) {
+        t.Errorf("persisted finished_at %v, want %v", rec.FinishedAt, st.FinishedAt)
+    }
+}
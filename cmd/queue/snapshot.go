@@ -0,0 +1,124 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "log"
+    "os"
+    "sort"
+)
+
+// snapshotEnv names the file that holds tasks still queued at shutdown.
+// When set, shutdown saves them there instead of failing them, and the next
+// newServer re-enqueues them.
+const snapshotEnv = "QUEUE_SNAPSHOT"
+
+// drainJobs empties the jobs channel and returns the tasks it held.
+func (s *Server) drainJobs() []Task {
+    var tasks []Task
+    for {
+        select {
+        case t := <-s.jobs:
+            tasks = append(tasks, t)
+        default:
+            return tasks
+        }
+    }
+}
+
+// takeUnstarted returns the tasks handed to the pool that never started,
+// in enqueue order: StopWaitContext discards the pool queue once its ctx
+// expires. A worker that picks one of them up afterwards skips it.
+func (s *Server) takeUnstarted() []Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    tasks := make([]Task, 0, len(s.submitted))
+    for _, t := range s.submitted {
+        tasks = append(tasks, t)
+    }
+    s.submitted = make(map[string]Task)
+    sort.Slice(tasks, func(i, j int) bool {
+        ti, tj := s.times[tasks[i].ID].enqueued, s.times[tasks[j].ID].enqueued
+        if !ti.Equal(tj) {
+            return ti.Before(tj)
+        }
+        return tasks[i].ID < tasks[j].ID
+    })
+    return tasks
+}
+
+// takeRestored returns the restored tasks that never got a queue slot.
+func (s *Server) takeRestored() []Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    tasks := s.restored
+    s.restored = nil
+    return tasks
+}
+
+// saveSnapshot writes tasks, minus cancelled ones, to the snapshot file.
+// The file is replaced atomically so a crash never leaves it half written.
+func (s *Server) saveSnapshot(tasks []Task) error {
+    keep := make([]Task, 0, len(tasks))
+    s.mu.Lock()
+    for _, t := range tasks {
+        if s.states[t.ID] != StateCancelled {
+            keep = append(keep, t)
+        }
+    }
+    s.mu.Unlock()
+
+    data, err := json.Marshal(keep)
+    if err != nil {
+        return err
+    }
+    tmp := s.snapshotPath + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    if err := os.Rename(tmp, s.snapshotPath); err != nil {
+        _ = os.Remove(tmp)
+        return err
+    }
+    log.Printf("shutdown: saved %d queued tasks to %s", len(keep), s.snapshotPath)
+    return nil
+}
+
+// restoreSnapshot re-enqueues tasks saved by the previous shutdown and
+// removes the file so they run once; feedRestored places them into the jobs
+// channel. Tasks the store already restored are skipped.
+func (s *Server) restoreSnapshot() {
+    if s.snapshotPath == "" {
+        return
+    }
+    data, err := os.ReadFile(s.snapshotPath)
+    if errors.Is(err, os.ErrNotExist) {
+        return
+    }
+    if err != nil {
+        log.Printf("snapshot: read failed error=%v", err)
+        return
+    }
+    var tasks []Task
+    if err := json.Unmarshal(data, &tasks); err != nil {
+        log.Printf("snapshot: decode failed error=%v", err)
+        return
+    }
+
+    s.mu.Lock()
+    for _, t := range tasks {
+        if _, known := s.states[t.ID]; known {
+            continue
+        }
+        s.tasks[t.ID] = t
+        s.retries[t.ID] = 0
+        s.setStateLocked(t.ID, StateQueued)
+        s.restored = append(s.restored, t)
+        log.Printf("snapshot: requeued id=%s", t.ID)
+    }
+    s.mu.Unlock()
+
+    if err := os.Remove(s.snapshotPath); err != nil {
+        log.Printf("snapshot: remove failed error=%v", err)
+    }
+}
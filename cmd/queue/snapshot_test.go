@@ -0,0 +1,235 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+    "time"
+)
+
+func TestShutdownSnapshot(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "snapshot.json")
+    t.Setenv(snapshotEnv, path)
+
+    // no queue readers, so enqueued tasks stay in the jobs channel
+    s := newServer(0, 8, newMemoryStore(), nil, nil)
+    for _, id := range []string{"a", "b", "gone"} {
+        if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue %s: status %d", id, rec.Code)
+        }
+    }
+    if rec := doRequest(s, http.MethodDelete, "/tasks/gone", ""); rec.Code != http.StatusOK {
+        t.Fatalf("cancel: status %d", rec.Code)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    _ = s.shutdown(ctx)
+
+    if st := getStatus(t, s, "a"); st.State != StateQueued {
+        t.Errorf("snapshotted task: state %q, want %q", st.State, StateQueued)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatalf("read snapshot: %v", err)
+    }
+    var saved []Task
+    if err := json.Unmarshal(data, &saved); err != nil {
+        t.Fatalf("decode snapshot: %v", err)
+    }
+    if len(saved) != 2 || saved[0].ID != "a" || saved[1].ID != "b" {
+        t.Fatalf("snapshot %+v, want tasks a and b", saved)
+    }
+
+    restarted := newServer(1, 8, newMemoryStore(), func(context.Context, Task) (string, error) { return "", nil }, nil)
+    t.Cleanup(func() { _ = restarted.shutdown(t.Context()) })
+
+    for _, id := range []string{"a", "b"} {
+        waitForState(t, restarted, id, StateDone, 5*time.Second)
+    }
+    if rec := doRequest(restarted, http.MethodGet, "/tasks/gone", ""); rec.Code != http.StatusNotFound {
+        t.Errorf("cancelled task restored: status %d", rec.Code)
+    }
+    if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("snapshot not removed after restore: %v", err)
+    }
+}
+
+func TestShutdownWithoutSnapshot(t *testing.T) {
+    t.Setenv(snapshotEnv, "")
+
+    s := newServer(0, 8, newMemoryStore(), nil, nil)
+    if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"a"}`); rec.Code != http.StatusAccepted {
+        t.Fatalf("enqueue: status %d", rec.Code)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    _ = s.shutdown(ctx)
+
+    if st := getStatus(t, s, "a"); st.State != StateFailed {
+        t.Errorf("queued task: state %q, want %q", st.State, StateFailed)
+    }
+}
+
+// TestShutdownReclaimsPoolQueue runs the queue readers: tasks they already
+// moved into the pool queue are dropped by the pool when the shutdown
+// deadline passes, and must be snapshotted or failed like the jobs channel.
+func TestShutdownReclaimsPoolQueue(t *testing.T) {
+    setup := func(t *testing.T) (s *Server, release func()) {
+        t.Helper()
+        unblock := make(chan struct{})
+        started := make(chan struct{}, 1)
+        runner := func(ctx context.Context, task Task) (string, error) {
+            started <- struct{}{}
+            <-unblock
+            return "ok", nil
+        }
+        s = newServer(1, 8, newMemoryStore(), runner, nil)
+        for _, id := range []string{"busy", "a", "b"} {
+            if rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"`+id+`"}`); rec.Code != http.StatusAccepted {
+                t.Fatalf("enqueue %s: status %d", id, rec.Code)
+            }
+            if id == "busy" {
+                <-started
+            }
+        }
+        // the reader moves a and b into the pool queue behind busy
+        deadline := time.Now().Add(time.Second)
+        for s.pool.QueueLen() < 2 {
+            if time.Now().After(deadline) {
+                t.Fatalf("pool queue %d, want 2", s.pool.QueueLen())
+            }
+            time.Sleep(time.Millisecond)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+        defer cancel()
+        if err := s.shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+            t.Fatalf("shutdown: %v, want %v", err, context.DeadlineExceeded)
+        }
+        return s, func() { close(unblock) }
+    }
+
+    t.Run("snapshotted", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "snapshot.json")
+        t.Setenv(snapshotEnv, path)
+        s, release := setup(t)
+        defer release()
+
+        data, err := os.ReadFile(path)
+        if err != nil {
+            t.Fatalf("read snapshot: %v", err)
+        }
+        var saved []Task
+        if err := json.Unmarshal(data, &saved); err != nil {
+            t.Fatalf("decode snapshot: %v", err)
+        }
+        if len(saved) != 2 || saved[0].ID != "a" || saved[1].ID != "b" {
+            t.Fatalf("snapshot %+v, want tasks a and b", saved)
+        }
+        if st := getStatus(t, s, "a"); st.State != StateQueued {
+            t.Errorf("snapshotted task: state %q, want %q", st.State, StateQueued)
+        }
+    })
+
+    t.Run("failed without snapshot", func(t *testing.T) {
+        t.Setenv(snapshotEnv, "")
+        s, release := setup(t)
+        defer release()
+
+        for _, id := range []string{"a", "b"} {
+            if st := getStatus(t, s, id); st.State != StateFailed {
+                t.Errorf("task %s: state %q, want %q", id, st.State, StateFailed)
+            }
+        }
+    })
+}
+
+// TestRestoreSnapshotLargerThanQueue restores more tasks than QUEUE_SIZE
+// holds: none is failed, they run as slots free up, and those still waiting
+// at shutdown are saved again.
+func TestRestoreSnapshotLargerThanQueue(t *testing.T) {
+    ids := []string{"t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9"}
+    setup := func(t *testing.T) (s *Server, path string, started <-chan string, release func()) {
+        t.Helper()
+        path = filepath.Join(t.TempDir(), "snapshot.json")
+        t.Setenv(snapshotEnv, path)
+        tasks := make([]Task, len(ids))
+        for i, id := range ids {
+            tasks[i] = Task{ID: id}
+        }
+        data, err := json.Marshal(tasks)
+        if err != nil {
+            t.Fatalf("encode snapshot: %v", err)
+        }
+        if err := os.WriteFile(path, data, 0o600); err != nil {
+            t.Fatalf("write snapshot: %v", err)
+        }
+
+        unblock := make(chan struct{})
+        starts := make(chan string, len(ids))
+        runner := func(ctx context.Context, task Task) (string, error) {
+            starts <- task.ID
+            <-unblock
+            return "ok", nil
+        }
+        s = newServer(1, 2, newMemoryStore(), runner, nil)
+        for _, id := range ids {
+            if st := getStatus(t, s, id); st.State == StateFailed {
+                t.Fatalf("task %s failed on restore: %+v", id, st)
+            }
+        }
+        return s, path, starts, func() { close(unblock) }
+    }
+
+    t.Run("all tasks run", func(t *testing.T) {
+        s, path, _, release := setup(t)
+        t.Cleanup(func() { _ = s.shutdown(t.Context()) })
+        release()
+
+        for _, id := range ids {
+            waitForState(t, s, id, StateDone, 5*time.Second)
+        }
+        if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+            t.Errorf("snapshot not removed after restore: %v", err)
+        }
+    })
+
+    t.Run("unstarted tasks are saved again", func(t *testing.T) {
+        s, path, started, release := setup(t)
+        defer release()
+        if id := <-started; id != "t1" {
+            t.Fatalf("first task %q, want t1", id)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+        defer cancel()
+        _ = s.shutdown(ctx)
+
+        data, err := os.ReadFile(path)
+        if err != nil {
+            t.Fatalf("read snapshot: %v", err)
+        }
+        var saved []Task
+        if err := json.Unmarshal(data, &saved); err != nil {
+            t.Fatalf("decode snapshot: %v", err)
+        }
+        var got []string
+        for _, task := range saved {
+            got = append(got, task.ID)
+        }
+        if want := ids[1:]; !slices.Equal(got, want) {
+            t.Errorf("snapshot %v, want %v", got, want)
+        }
+        for _, id := range ids[1:] {
+            if st := getStatus(t, s, id); st.State != StateQueued {
+                t.Errorf("task %s: state %q, want %q", id, st.State, StateQueued)
+            }
+        }
+    })
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "encoding/json"
+    "sort"
+    "sync"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+// TaskRecord is the persisted state of a task.
+type TaskRecord struct {
+    Task       Task       `json:"task"`
+    State      TaskState  `json:"state"`
+    Retries    int        `json:"retries"`
+    LastError  string     `json:"last_error,omitempty"`
+    Result     string     `json:"result,omitempty"`
+    EnqueuedAt *time.Time `json:"enqueued_at,omitempty"`
+    StartedAt  *time.Time `json:"started_at,omitempty"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// StateStore persists task records so they survive restarts.
+type StateStore interface {
+    Set(rec TaskRecord) error
+    Get(id string) (TaskRecord, bool, error)
+    List() ([]TaskRecord, error)
+    Close() error
+}
+
+// memoryStore keeps records in a map; nothing survives a restart.
+type memoryStore struct {
+    mu      sync.Mutex
+    records map[string]TaskRecord
+}
+
+func newMemoryStore() *memoryStore {
+    return &memoryStore{records: make(map[string]TaskRecord)}
+}
+
+func (m *memoryStore) Set(rec TaskRecord) error {
+    m.mu.Lock()
+    m.records[rec.Task.ID] = rec
+    m.mu.Unlock()
+    return nil
+}
+
+func (m *memoryStore) Get(id string) (TaskRecord, bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    rec, ok := m.records[id]
+    return rec, ok, nil
+}
+
+func (m *memoryStore) List() ([]TaskRecord, error) {
+    m.mu.Lock()
+    list := make([]TaskRecord, 0, len(m.records))
+    for _, rec := range m.records {
+        list = append(list, rec)
+    }
+    m.mu.Unlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].Task.ID < list[j].Task.ID })
+    return list, nil
+}
+
+func (m *memoryStore) Close() error { return nil }
+
+// openStore returns a BoltDB store at path, or an in-memory store when path is empty.
+func openStore(path string) (StateStore, error) {
+    if path == "" {
+        return newMemoryStore(), nil
+    }
+    return openBoltStore(path)
+}
+
+var tasksBucket = []byte("tasks")
+
+// boltStore keeps records as JSON in a BoltDB file, keyed by task ID.
+type boltStore struct {
+    db *bolt.DB
+}
+
+// openBoltStore opens (or creates) the database at path.
+func openBoltStore(path string) (*boltStore, error) {
+    db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists(tasksBucket)
+        return err
+    })
+    if err != nil {
+        _ = db.Close()
+        return nil, err
+    }
+    return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) Set(rec TaskRecord) error {
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    return b.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(tasksBucket).Put([]byte(rec.Task.ID), data)
+    })
+}
+
+func (b *boltStore) Get(id string) (TaskRecord, bool, error) {
+    var rec TaskRecord
+    var ok bool
+    err := b.db.View(func(tx *bolt.Tx) error {
+        data := tx.Bucket(tasksBucket).Get([]byte(id))
+        if data == nil {
+            return nil
+        }
+        ok = true
+        return json.Unmarshal(data, &rec)
+    })
+    return rec, ok, err
+}
+
+// List returns all records ordered by task ID (Bolt keeps keys sorted).
+func (b *boltStore) List() ([]TaskRecord, error) {
+    var list []TaskRecord
+    err := b.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(tasksBucket).ForEach(func(_, data []byte) error {
+            var rec TaskRecord
+            if err := json.Unmarshal(data, &rec); err != nil {
+                return err
+            }
+            list = append(list, rec)
+            return nil
+        })
+    })
+    return list, err
+}
+
+func (b *boltStore) Close() error { return b.db.Close() }
@@ -0,0 +1,58 @@
+package main
+
+import (
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestBoltStorePersistence(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state.db")
+
+    store, err := openBoltStore(path)
+    if err != nil {
+        t.Fatalf("open: %v", err)
+    }
+    want := TaskRecord{Task: Task{ID: "t1", Payload: "p", MaxRetries: 3}, State: StateRunning, Retries: 2}
+    if err := store.Set(want); err != nil {
+        t.Fatalf("set: %v", err)
+    }
+    if err := store.Close(); err != nil {
+        t.Fatalf("close: %v", err)
+    }
+
+    store, err = openBoltStore(path)
+    if err != nil {
+        t.Fatalf("reopen: %v", err)
+    }
+    defer store.Close()
+
+    got, ok, err := store.Get("t1")
+    if err != nil || !ok {
+        t.Fatalf("get: ok=%v err=%v", ok, err)
+    }
+    if got != want {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+    list, err := store.List()
+    if err != nil || len(list) != 1 || list[0] != want {
+        t.Errorf("list: %+v, err=%v", list, err)
+    }
+    if _, ok, _ := store.Get("missing"); ok {
+        t.Error("unexpected record for unknown id")
+    }
+}
+
+func TestServerRestoresUnfinishedTasks(t *testing.T) {
+    store := newMemoryStore()
+    _ = store.Set(TaskRecord{Task: Task{ID: "pending", MaxRetries: 20}, State: StateRunning})
+    _ = store.Set(TaskRecord{Task: Task{ID: "finished"}, State: StateDone})
+
+    s := newServer(1, 8, store, nil, nil)
+    t.Cleanup(func() { _ = s.shutdown(t.Context()) })
+
+    waitForState(t, s, "pending", StateDone, 20*time.Second)
+    if st := getStatus(t, s, "finished"); st.State != StateDone {
+        t.Errorf("finished task: state %q, want %q", st.State, StateDone)
+    }
+}
@@ -1,21 +1,114 @@
-package main
-
-// Task represents an incoming unit of work.
-// Payload is opaque in this demo; only ID and retry config are used.
-type Task struct {
-    ID         string `json:"id"`
-    Payload    string `json:"payload"`
-    MaxRetries int    `json:"max_retries"`
-}
-
-// TaskState is an in-memory processing state for a task.
-type TaskState string
-
-const (
-    StateQueued  TaskState = "queued"
-    StateRunning TaskState = "running"
-    StateDone    TaskState = "done"
-    StateFailed  TaskState = "failed"
-)
-
-
+package main
+
+import (
+    "context"
+    "time"
+
+    wpkg "worker_pool"
+)
+
+// Task represents an incoming unit of work.
+// Payload is opaque in this demo; only ID and retry config are used.
+// CallbackURL, if set, receives a POST with the task's final TaskStatus.
+// Priority ranges from MinPriority to MaxPriority (default 0); queued tasks
+// with a higher priority are run first.
+type Task struct {
+    ID          string `json:"id"`
+    Payload     string `json:"payload"`
+    MaxRetries  int    `json:"max_retries"`
+    CallbackURL string `json:"callback_url,omitempty"`
+    Priority    int    `json:"priority,omitempty"`
+}
+
+// TaskRunner performs a task and returns its output, served from
+// /results/{id} once the task is done. A returned error makes the task retry
+// with backoff until MaxRetries is exhausted. ctx is cancelled when the task
+// is cancelled via DELETE /tasks/{id}; runners should return promptly then.
+type TaskRunner func(ctx context.Context, t Task) (string, error)
+
+// Allowed range of Task.Priority.
+const (
+    MinPriority = 0
+    MaxPriority = 9
+)
+
+// TaskState is an in-memory processing state for a task.
+type TaskState string
+
+const (
+    StateQueued    TaskState = "queued"
+    StateRunning   TaskState = "running"
+    StateDone      TaskState = "done"
+    StateFailed    TaskState = "failed"
+    StateCancelled TaskState = "cancelled"
+)
+
+// valid reports whether st is one of the known task states.
+func (st TaskState) valid() bool {
+    switch st {
+    case StateQueued, StateRunning, StateDone, StateFailed, StateCancelled:
+        return true
+    }
+    return false
+}
+
+
+
+// TaskStatus is the public view of a task's processing state.
+// LastError is the error of the most recent failed attempt, if any.
+// EnqueuedAt is when the task was accepted, StartedAt when its first attempt
+// began and FinishedAt when it reached a final state; each is omitted until
+// set. StartedAt-EnqueuedAt is the queue wait, FinishedAt-StartedAt the
+// execution time including retries.
+type TaskStatus struct {
+    ID         string     `json:"id"`
+    State      TaskState  `json:"state"`
+    Retries    int        `json:"retries"`
+    LastError  string     `json:"last_error,omitempty"`
+    EnqueuedAt *time.Time `json:"enqueued_at,omitempty"`
+    StartedAt  *time.Time `json:"started_at,omitempty"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// TaskResult is the body of GET /results/{id} for a finished task.
+type TaskResult struct {
+    ID     string `json:"id"`
+    Result string `json:"result"`
+}
+
+// EnqueueResult is the per-task outcome of POST /enqueue/batch.
+type EnqueueResult struct {
+    ID       string `json:"id"`
+    Accepted bool   `json:"accepted"`
+    Error    string `json:"error,omitempty"`
+}
+
+// TaskEvent is a task state transition streamed from /events.
+// From is empty for a newly enqueued task.
+type TaskEvent struct {
+    ID   string    `json:"id"`
+    From TaskState `json:"from"`
+    To   TaskState `json:"to"`
+    TS   time.Time `json:"ts"`
+}
+
+// WorkerCount is the body of POST /admin/workers and of its response.
+type WorkerCount struct {
+    Count int `json:"count"`
+}
+
+// HealthStatus is the body of GET /healthz.
+type HealthStatus struct {
+    QueueLen     int  `json:"queue_len"`
+    QueueCap     int  `json:"queue_cap"`
+    Workers      int  `json:"workers"`
+    Active       int  `json:"active"`
+    ShuttingDown bool `json:"shutting_down"`
+}
+
+// MetricsSnapshot is the body of GET /metrics.json: the pool's counters and
+// the number of tasks in each state, every known state included.
+type MetricsSnapshot struct {
+    Pool  wpkg.PoolStats    `json:"pool"`
+    Tasks map[TaskState]int `json:"tasks"`
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "time"
+
+    wpkg "worker_pool"
+)
+
+// webhookRetry controls how failed completion callbacks are retried.
+var webhookRetry = wpkg.RetryOptions{MaxRetries: 2, BaseDelay: 200 * time.Millisecond, Jitter: true}
+
+// webhookClient bounds each callback attempt so a slow receiver can't hold a worker.
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// webhookWorkers and webhookQueueSize size the pool that delivers callbacks.
+// It is separate from the task pool, so callbacks neither take task queue
+// slots nor are rejected because the task queue is full.
+const (
+    webhookWorkers   = 4
+    webhookQueueSize = 1024
+)
+
+// webhookDrainTimeout bounds how long shutdown waits for queued callbacks,
+// on top of the task pool drain.
+const webhookDrainTimeout = 5 * time.Second
+
+// validCallbackURL reports whether raw is an absolute http(s) URL.
+func validCallbackURL(raw string) bool {
+    u, err := url.Parse(raw)
+    return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// notify posts the task's final status to its callback_url, if any. The POST
+// runs on the webhook pool and is retried on network errors and 5xx.
+// Delivery is best-effort: a callback is dropped and logged when the webhook
+// queue is full or shutdown's webhook drain times out.
+func (s *Server) notify(t Task) {
+    if t.CallbackURL == "" {
+        return
+    }
+    s.mu.Lock()
+    status := s.statusLocked(t.ID)
+    s.mu.Unlock()
+
+    body, err := json.Marshal(status)
+    if err != nil {
+        log.Printf("webhook encode failed id=%s error=%v", t.ID, err)
+        return
+    }
+    err = s.webhooks.SubmitRetry(func() error {
+        if err := postWebhook(t.CallbackURL, body); err != nil {
+            log.Printf("webhook failed id=%s url=%s error=%v", t.ID, t.CallbackURL, err)
+            return err
+        }
+        log.Printf("webhook delivered id=%s state=%s", t.ID, status.State)
+        return nil
+    }, webhookRetry)
+    if err != nil {
+        log.Printf("webhook dropped id=%s error=%v", t.ID, err)
+    }
+}
+
+// postWebhook sends one callback attempt. Client errors (4xx) are logged and
+// not retried since repeating the same request won't help.
+func postWebhook(target string, body []byte) error {
+    resp, err := webhookClient.Post(target, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    switch {
+    case resp.StatusCode >= 500:
+        return fmt.Errorf("callback status %d", resp.StatusCode)
+    case resp.StatusCode >= 400:
+        log.Printf("webhook rejected url=%s status=%d", target, resp.StatusCode)
+    }
+    return nil
+}
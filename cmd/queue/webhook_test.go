@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    wpkg "worker_pool"
+)
+
+// callbackServer records every TaskStatus posted to it; the first failFirst
+// requests get a 500.
+func callbackServer(t *testing.T, failFirst int32) (*httptest.Server, <-chan TaskStatus, *atomic.Int32) {
+    t.Helper()
+    got := make(chan TaskStatus, 8)
+    var calls atomic.Int32
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if calls.Add(1) <= failFirst {
+            w.WriteHeader(http.StatusInternalServerError)
+            return
+        }
+        var st TaskStatus
+        if err := json.NewDecoder(r.Body).Decode(&st); err != nil {
+            t.Errorf("decode callback: %v", err)
+        }
+        got <- st
+    }))
+    t.Cleanup(ts.Close)
+    return ts, got, &calls
+}
+
+func TestWebhook(t *testing.T) {
+    t.Run("final state is posted to callback_url", func(t *testing.T) {
+        cb, got, _ := callbackServer(t, 0)
+        s := newTestServer(t, 1, 8)
+        s.runner = func(context.Context, Task) (string, error) { return "", nil }
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"ok","callback_url":"`+cb.URL+`"}`)
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue: status %d", rec.Code)
+        }
+        select {
+        case st := <-got:
+            if st.ID != "ok" || st.State != StateDone || st.Retries != 0 {
+                t.Errorf("callback %+v, want ok/done/0", st)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatal("callback never received")
+        }
+    })
+
+    t.Run("failed task is reported and callback retried on 5xx", func(t *testing.T) {
+        cb, got, calls := callbackServer(t, 1)
+        s := newTestServer(t, 1, 8)
+        s.runner = func(context.Context, Task) (string, error) { return "", errors.New("always fails") }
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"bad","callback_url":"`+cb.URL+`"}`)
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue: status %d", rec.Code)
+        }
+        select {
+        case st := <-got:
+            if st.ID != "bad" || st.State != StateFailed {
+                t.Errorf("callback %+v, want bad/failed", st)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatal("callback never received")
+        }
+        if n := calls.Load(); n != 2 {
+            t.Errorf("callback calls %d, want 2 (one 500, one retry)", n)
+        }
+    })
+
+    t.Run("delivered while the task queue is full", func(t *testing.T) {
+        cb, got, _ := callbackServer(t, 0)
+        s := newTestServer(t, 2, 8)
+        started := make(chan struct{})
+        finish := make(chan struct{})
+        s.runner = func(context.Context, Task) (string, error) {
+            close(started)
+            <-finish
+            return "", nil
+        }
+
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"ok","callback_url":"`+cb.URL+`"}`)
+        if rec.Code != http.StatusAccepted {
+            t.Fatalf("enqueue: status %d", rec.Code)
+        }
+        <-started
+        release := blockPool(t, s, 1)
+        defer release()
+        for {
+            if err := s.pool.Submit(func() error { return nil }); errors.Is(err, wpkg.ErrQueueFull) {
+                break
+            } else if err != nil {
+                t.Fatalf("fill pool queue: %v", err)
+            }
+        }
+        close(finish)
+
+        select {
+        case st := <-got:
+            if st.ID != "ok" || st.State != StateDone {
+                t.Errorf("callback %+v, want ok/done", st)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatal("callback never received")
+        }
+    })
+
+    t.Run("invalid callback_url is rejected", func(t *testing.T) {
+        s := newTestServer(t, 1, 8)
+        rec := doRequest(s, http.MethodPost, "/enqueue", `{"id":"x","callback_url":"not a url"}`)
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("status %d, want %d", rec.Code, http.StatusBadRequest)
+        }
+    })
+}
@@ -0,0 +1,160 @@
+package worker_pool
+
+import "errors"
+
+// ErrUnknownQueue — SubmitTo получил имя очереди, не зарегистрированное через WithQueue
+var ErrUnknownQueue = errors.New("worker pool queue is not registered")
+
+// namedQueue — именованная подочередь, заданная WithQueue
+type namedQueue struct {
+	name   string
+	weight int
+}
+
+// SubmitTo — добавить задачу в именованную очередь, зарегистрированную
+// WithQueue. Воркеры выбирают задачи из непустых очередей пропорционально
+// их весам, поэтому одна очередь не может надолго занять весь пул.
+// Задачи, отправленные без имени (Submit и др.), попадают в очередь
+// по умолчанию с весом 1.
+func (wp *WorkerPool) SubmitTo(queue string, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if !wp.hasQueue(queue) {
+		return ErrUnknownQueue
+	}
+
+	return wp.enqueue(&queueItem{run: wp.wrap(task), queue: queue})
+}
+
+// hasQueue — зарегистрирована ли именованная очередь
+func (wp *WorkerPool) hasQueue(name string) bool {
+	for _, q := range wp.namedQueues {
+		if q.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fairStore — набор подочередей, из которых задачи выдаются по плавному
+// взвешенному round-robin: за каждые sum(weights) выдач очередь с весом w
+// отдаёт w задач, если ей есть что отдать, и выдачи разных очередей
+// перемежаются. Порядок внутри подочереди задаёт её собственное хранилище.
+type fairStore struct {
+	queues []*fairQueue
+	byName map[string]*fairQueue
+	n      int
+}
+
+// fairQueue — подочередь fairStore
+type fairQueue struct {
+	weight  int
+	current int // накопленный кредит плавного round-robin
+	store   itemStore
+}
+
+// newFairStore — очередь по умолчанию ("" с весом 1) и именованные очереди;
+// newStore создаёт хранилище каждой подочереди
+func newFairStore(named []namedQueue, newStore func() itemStore) *fairStore {
+	s := &fairStore{byName: make(map[string]*fairQueue)}
+	add := func(name string, weight int) {
+		q := &fairQueue{weight: weight, store: newStore()}
+		s.queues = append(s.queues, q)
+		s.byName[name] = q
+	}
+	add("", 1)
+	for _, nq := range named {
+		if q, ok := s.byName[nq.name]; ok {
+			q.weight = nq.weight
+			continue
+		}
+		add(nq.name, nq.weight)
+	}
+	return s
+}
+
+func (s *fairStore) push(it *queueItem) {
+	s.byName[it.queue].store.push(it)
+	s.n++
+}
+
+func (s *fairStore) pop() *queueItem {
+	s.n--
+	return s.next(s.queues, func(q *fairQueue) int { return q.store.len() }).store.pop()
+}
+
+// next — выбрать подочередь для следующей выдачи и обновить кредиты.
+// size сообщает, сколько задач осталось в подочереди; у пустых подочередей
+// кредит обнуляется, чтобы простой не копил им приоритет.
+func (s *fairStore) next(queues []*fairQueue, size func(q *fairQueue) int) *fairQueue {
+	var best *fairQueue
+	total := 0
+	for _, q := range queues {
+		if size(q) == 0 {
+			q.current = 0
+			continue
+		}
+		q.current += q.weight
+		total += q.weight
+		if best == nil || q.current > best.current {
+			best = q
+		}
+	}
+	best.current -= total
+	return best
+}
+
+func (s *fairStore) len() int { return s.n }
+
+func (s *fairStore) clear() []*queueItem {
+	var items []*queueItem
+	for _, q := range s.queues {
+		items = append(items, q.store.clear()...)
+		q.current = 0
+	}
+	s.n = 0
+	return items
+}
+
+// oldestQueue — подочередь с самой давней задачей; nil — все пусты
+func (s *fairStore) oldestQueue() *fairQueue {
+	var best *fairQueue
+	for _, q := range s.queues {
+		if it := q.store.oldest(); it != nil && (best == nil || it.seq < best.store.oldest().seq) {
+			best = q
+		}
+	}
+	return best
+}
+
+func (s *fairStore) oldest() *queueItem {
+	if q := s.oldestQueue(); q != nil {
+		return q.store.oldest()
+	}
+	return nil
+}
+
+func (s *fairStore) removeOldest() *queueItem {
+	s.n--
+	return s.oldestQueue().store.removeOldest()
+}
+
+// snapshot — проиграть выдачу на копиях подочередей, не трогая их кредиты
+func (s *fairStore) snapshot() []*queueItem {
+	queues := make([]*fairQueue, len(s.queues))
+	pending := make(map[*fairQueue][]*queueItem, len(s.queues))
+	for i, q := range s.queues {
+		cp := *q
+		queues[i] = &cp
+		pending[&cp] = q.store.snapshot()
+	}
+
+	items := make([]*queueItem, 0, s.n)
+	for len(items) < s.n {
+		q := s.next(queues, func(q *fairQueue) int { return len(pending[q]) })
+		items = append(items, pending[q][0])
+		pending[q] = pending[q][1:]
+	}
+	return items
+}
@@ -0,0 +1,56 @@
+package worker_pool
+
+// TaskHandle — дескриптор задачи SubmitHandle: позволяет узнать, завершилась
+// ли задача, не блокируясь, и получить её результат позже
+type TaskHandle struct {
+	done chan struct{}
+	err  error
+}
+
+// finish — записать результат задачи; вызывается ровно один раз
+func (h *TaskHandle) finish(err error) {
+	h.err = err
+	close(h.done)
+}
+
+// Done — канал, который закрывается, когда задача завершена или отброшена
+func (h *TaskHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Completed — завершена ли задача (в том числе с ошибкой, паникой или
+// отброшенная без запуска)
+func (h *TaskHandle) Completed() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err — результат задачи: её ошибка, *PanicError, ErrPoolStopped или
+// ErrTaskCancelled, если задача отброшена без запуска. До завершения
+// задачи возвращает nil; отличить успех от незавершённости можно
+// по Completed.
+func (h *TaskHandle) Err() error {
+	if !h.Completed() {
+		return nil
+	}
+	return h.err
+}
+
+// SubmitHandle — как SubmitAsync, но вместо канала возвращает TaskHandle,
+// который можно опрашивать сколько угодно раз. Если задача не принята,
+// возвращается ошибка и nil.
+func (wp *WorkerPool) SubmitHandle(task func() error) (*TaskHandle, error) {
+	if task == nil {
+		return nil, ErrNilTask
+	}
+
+	h := &TaskHandle{done: make(chan struct{})}
+	if err := wp.enqueue(&queueItem{run: wp.wrapResult(task, h.finish), drop: h.finish}); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
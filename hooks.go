@@ -0,0 +1,116 @@
+package worker_pool
+
+import "runtime/debug"
+
+// PanicPolicy — что пул делает с паникой в задаче (см. WithPanicPolicy)
+type PanicPolicy int
+
+const (
+	// PanicRecover — восстановить панику и передать её обработчикам OnPanic,
+	// а если их нет — записать в лог; воркер продолжает работу
+	PanicRecover PanicPolicy = iota
+	// PanicPropagate — записать панику со стеком в лог, вызвать обработчики
+	// OnPanic и паниковать снова, роняя процесс
+	PanicPropagate
+	// PanicCallback — восстановить панику и передать её только обработчикам
+	// OnPanic, никогда не записывая в лог; воркер продолжает работу
+	PanicCallback
+	// PanicRestartWorker — обработать панику как PanicRecover, затем завершить
+	// воркер, на котором она случилась, и запустить вместо него новый;
+	// число воркеров пула не меняется
+	PanicRestartWorker
+)
+
+// propagatedPanic — паника, которую пул пробрасывает дальше по PanicPropagate;
+// встретив её, внешние обработчики воркера не восстанавливают её повторно
+type propagatedPanic struct {
+	*PanicError
+}
+
+// taskPanicked — сигнал воркеру от обёртки задачи: задача паниковала,
+// паника уже учтена и передана обработчикам
+type taskPanicked struct{}
+
+// OnError — зарегистрировать обработчик ошибок, возвращённых задачами из Submit.
+// Обработчики вызываются в порядке регистрации; пока нет ни одного,
+// ошибки логируются.
+func (wp *WorkerPool) OnError(handler func(err error)) {
+	if handler == nil {
+		return
+	}
+	wp.hooksMu.Lock()
+	wp.errorHooks = append(wp.errorHooks, handler)
+	wp.hooksMu.Unlock()
+}
+
+// OnPanic — зарегистрировать обработчик паник в задачах.
+// Получает восстановленное значение и стек; пока нет ни одного
+// обработчика, паники логируются.
+func (wp *WorkerPool) OnPanic(handler func(recovered interface{}, stack []byte)) {
+	if handler == nil {
+		return
+	}
+	wp.hooksMu.Lock()
+	wp.panicHooks = append(wp.panicHooks, handler)
+	wp.hooksMu.Unlock()
+}
+
+// handleError — передать ошибку задачи обработчикам или в лог
+func (wp *WorkerPool) handleError(err error) {
+	wp.recordDrain(err)
+
+	wp.hooksMu.RLock()
+	hooks := wp.errorHooks
+	wp.hooksMu.RUnlock()
+
+	if len(hooks) == 0 {
+		wp.logEvent("task_error", err, nil)
+		return
+	}
+	for _, h := range hooks {
+		wp.safeCall(func() { h(err) })
+	}
+}
+
+// handlePanic — передать панику задачи обработчикам или в лог
+// с учётом PanicPolicy
+func (wp *WorkerPool) handlePanic(recovered interface{}, stack []byte) {
+	if p, ok := recovered.(propagatedPanic); ok {
+		// уже обработана ближе к задаче: пробрасываем дальше
+		panic(p)
+	}
+	wp.recordDrain(&PanicError{Value: recovered, Stack: stack})
+
+	wp.hooksMu.RLock()
+	hooks := wp.panicHooks
+	wp.hooksMu.RUnlock()
+
+	if wp.panicPolicy == PanicPropagate || (len(hooks) == 0 && wp.panicPolicy != PanicCallback) {
+		wp.logEvent("task_panic", recovered, stack)
+	}
+	for _, h := range hooks {
+		wp.safeCall(func() { h(recovered, stack) })
+	}
+	if wp.panicPolicy == PanicPropagate {
+		panic(propagatedPanic{&PanicError{Value: recovered, Stack: stack}})
+	}
+}
+
+// recordDrain — запомнить ошибку задачи, если идёт StopWaitErr
+func (wp *WorkerPool) recordDrain(err error) {
+	wp.drainMu.Lock()
+	if wp.draining {
+		wp.drainErrs = append(wp.drainErrs, err)
+	}
+	wp.drainMu.Unlock()
+}
+
+// safeCall — вызвать пользовательский обработчик, не давая его панике уронить воркер
+func (wp *WorkerPool) safeCall(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			wp.logEvent("hook_panic", r, debug.Stack())
+		}
+	}()
+	fn()
+}
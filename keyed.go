@@ -0,0 +1,99 @@
+package worker_pool
+
+import "errors"
+
+// SubmitKeyed — добавить задачу, которая выполнится после всех ранее
+// отправленных задач с тем же ключом (например, события одного
+// пользователя), но параллельно с задачами других ключей. В очереди пула
+// одновременно стоит не больше одной задачи ключа; остальные ждут в очереди
+// ключа, не занимая места в очереди пула и не ограничиваясь её ёмкостью.
+// Поэтому ErrQueueFull (или ожидание по OverflowBlock) возможно, только
+// когда у ключа нет задач в работе. Если задача ключа отброшена без запуска
+// (Stop, CancelAll, вытеснение по OverflowDropOldest), вместе с ней
+// отбрасываются и все ждущие задачи этого ключа. StopWait уже принятые
+// задачи ключа выполняет до конца.
+func (wp *WorkerPool) SubmitKeyed(key string, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	run := wp.wrap(task)
+
+	wp.keyedMu.Lock()
+	if waiting, busy := wp.keyed[key]; busy {
+		defer wp.keyedMu.Unlock()
+		if wp.queue.isClosed() {
+			return ErrPoolStopped
+		}
+		wp.keyed[key] = append(waiting, run)
+		wp.addPending(1)
+		wp.stats.submitted.Add(1)
+		return nil
+	}
+	if wp.keyed == nil {
+		wp.keyed = make(map[string][]func())
+	}
+	wp.keyed[key] = nil
+	wp.keyedMu.Unlock()
+
+	err := wp.enqueue(wp.keyedItem(key, run))
+	if err != nil {
+		// пока задача ставилась, за ней могли встать другие: они приняты
+		// и должны выполниться
+		wp.keyedNext(key)
+	}
+	return err
+}
+
+// keyedItem — задача ключа, по завершении передающая очередь следующей
+func (wp *WorkerPool) keyedItem(key string, run func()) *queueItem {
+	return &queueItem{
+		run: func() {
+			defer wp.keyedNext(key)
+			run()
+		},
+		drop: func(error) { wp.dropKeyed(key) },
+	}
+}
+
+// keyedNext — поставить в очередь пула следующую задачу ключа или
+// освободить ключ, если задач больше нет. Задача уже учтена в pending при
+// приёме, поэтому ставится напрямую в очередь, в том числе закрытую
+// StopWait; при заполненной очереди место ждёт отдельная горутина, а не
+// воркер, вызвавший keyedNext.
+func (wp *WorkerPool) keyedNext(key string) {
+	wp.keyedMu.Lock()
+	waiting := wp.keyed[key]
+	if len(waiting) == 0 {
+		delete(wp.keyed, key)
+		wp.keyedMu.Unlock()
+		return
+	}
+	wp.keyed[key] = waiting[1:]
+	wp.keyedMu.Unlock()
+
+	it := wp.keyedItem(key, waiting[0])
+	err := wp.queue.tryHandoff(it)
+	if errors.Is(err, ErrQueueFull) {
+		go func() {
+			if err := wp.queue.pushHandoff(wp.ctx, it); err != nil {
+				wp.dropItem(it, ErrPoolStopped)
+			}
+		}()
+		return
+	}
+	if err != nil {
+		wp.dropItem(it, err)
+	}
+}
+
+// dropKeyed — отбросить задачи, ждущие в очереди ключа
+func (wp *WorkerPool) dropKeyed(key string) {
+	wp.keyedMu.Lock()
+	waiting := wp.keyed[key]
+	delete(wp.keyed, key)
+	wp.keyedMu.Unlock()
+
+	for range waiting {
+		wp.taskDone()
+	}
+}
@@ -0,0 +1,71 @@
+package worker_pool
+
+import "runtime/debug"
+
+// SubmitLabeled — добавить задачу с меткой для разбивки статистики,
+// например "email" или "report". Задача учитывается и в общих счётчиках
+// Stats, и в счётчиках своей метки, которые возвращает StatsByLabel.
+func (wp *WorkerPool) SubmitLabeled(label string, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	c := wp.labelCounters(label)
+	if err := wp.enqueue(&queueItem{run: wp.wrapLabeled(task, c), label: label}); err != nil {
+		return err
+	}
+	c.submitted.Add(1)
+	return nil
+}
+
+// labelCounters — счётчики метки label; создаются при первом обращении
+func (wp *WorkerPool) labelCounters(label string) *taskCounters {
+	if c, ok := wp.labels.Load(label); ok {
+		return c.(*taskCounters)
+	}
+	c, _ := wp.labels.LoadOrStore(label, &taskCounters{})
+	return c.(*taskCounters)
+}
+
+// wrapLabeled — как wrap, но дополнительно учитывает результат задачи
+// в счётчиках метки c
+func (wp *WorkerPool) wrapLabeled(task func() error, c *taskCounters) func() {
+	task = wp.applyMiddleware(task)
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				wp.stats.panic()
+				c.panic()
+				wp.handlePanic(r, debug.Stack())
+				panic(taskPanicked{})
+			}
+		}()
+		err := task()
+		wp.stats.finish(err)
+		c.finish(err)
+		if err != nil {
+			wp.handleError(err)
+		}
+	}
+}
+
+// StatsByLabel — снимки счётчиков по меткам SubmitLabeled. Заполнены
+// Submitted, Completed, Failed и Panicked; остальные поля относятся
+// к пулу целиком и остаются нулевыми. Метки, под которыми не было
+// принято ни одной задачи, в результат не попадают.
+func (wp *WorkerPool) StatsByLabel() map[string]PoolStats {
+	m := make(map[string]PoolStats)
+	wp.labels.Range(func(k, v interface{}) bool {
+		c := v.(*taskCounters)
+		if n := c.submitted.Load(); n > 0 {
+			m[k.(string)] = PoolStats{
+				Submitted: n,
+				Completed: c.completed.Load(),
+				Failed:    c.failed.Load(),
+				Panicked:  c.panicked.Load(),
+			}
+		}
+		return true
+	})
+	return m
+}
@@ -0,0 +1,90 @@
+package worker_pool
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencySamples — размер выборки, по которой считаются перцентили
+const latencySamples = 1024
+
+// LatencyStats — сводка длительностей выполнения задач с запуска пула.
+// Count, Min, Max и Mean точные; P50 и P95 считаются по равномерной выборке
+// из latencySamples задач (reservoir sampling), поэтому при большом потоке
+// приблизительны.
+type LatencyStats struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+}
+
+// latencyRecorder — накопитель длительностей задач для Latencies
+type latencyRecorder struct {
+	mu      sync.Mutex
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+// observe — учесть задачу, выполнявшуюся d
+func (r *latencyRecorder) observe(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	r.sum += d
+	if r.count == 1 || d < r.min {
+		r.min = d
+	}
+	if d > r.max {
+		r.max = d
+	}
+	if len(r.samples) < latencySamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	// алгоритм R: каждая из count задач остаётся в выборке с равной вероятностью
+	if i := rand.Int64N(r.count); i < latencySamples {
+		r.samples[i] = d
+	}
+}
+
+// stats — сводка накопленных длительностей
+func (r *latencyRecorder) stats() LatencyStats {
+	r.mu.Lock()
+	samples := slices.Clone(r.samples)
+	s := LatencyStats{Count: r.count, Min: r.min, Max: r.max}
+	if r.count > 0 {
+		s.Mean = r.sum / time.Duration(r.count)
+	}
+	r.mu.Unlock()
+
+	if len(samples) == 0 {
+		return s
+	}
+	slices.Sort(samples)
+	s.P50 = percentile(samples, 50)
+	s.P95 = percentile(samples, 95)
+	return s
+}
+
+// percentile — p-й перцентиль отсортированной выборки (ближайший ранг)
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// Latencies — сводка длительностей выполнения задач с запуска пула: число,
+// минимум, максимум, среднее, медиана и 95-й перцентиль. Время меряется
+// воркером вокруг задачи вместе с middleware, включая задачи с ошибкой
+// и паникой; ожидание в очереди не учитывается. Не требует Prometheus.
+func (wp *WorkerPool) Latencies() LatencyStats {
+	return wp.latencies.stats()
+}
@@ -0,0 +1,50 @@
+package worker_pool
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// SubmitLocal — добавить задачу, получающую ресурс воркера, созданный
+// WithWorkerInit (например, соединение с БД). Без WithWorkerInit или при
+// ошибке инициализации задача получает nil.
+func (wp *WorkerPool) SubmitLocal(task func(local interface{}) error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	var local interface{}
+	run := wp.wrap(func() error { return task(local) })
+	return wp.enqueue(&queueItem{runLocal: func(l interface{}) {
+		local = l
+		run()
+	}})
+}
+
+// initWorker — создать ресурс воркера; ok == false, если инициализатора нет
+// или он завершился ошибкой (она уходит в OnError)
+func (wp *WorkerPool) initWorker() (local interface{}, ok bool) {
+	if wp.workerInit == nil {
+		return nil, false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			wp.handlePanic(r, debug.Stack())
+			local, ok = nil, false
+		}
+	}()
+
+	local, err := wp.workerInit()
+	if err != nil {
+		wp.handleError(fmt.Errorf("worker init: %w", err))
+		return nil, false
+	}
+	return local, true
+}
+
+// teardownWorker — освободить ресурс завершающегося воркера
+func (wp *WorkerPool) teardownWorker(local interface{}) {
+	if wp.workerTeardown != nil {
+		wp.safeCall(func() { wp.workerTeardown(local) })
+	}
+}
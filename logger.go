@@ -0,0 +1,54 @@
+package worker_pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Logger — минимальный интерфейс логгера пула; ему удовлетворяет *log.Logger
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// defaultLogger — стандартный логгер пакета log
+func defaultLogger() Logger {
+	return log.Default()
+}
+
+// nopLogger — логгер, отбрасывающий все сообщения
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// logEntry — событие пула в формате WithStructuredLogging
+type logEntry struct {
+	Event string    `json:"event"`           // task_error, task_panic или hook_panic
+	Err   string    `json:"err"`             // ошибка задачи или значение паники
+	Stack string    `json:"stack,omitempty"` // стек паники
+	TS    time.Time `json:"ts"`
+}
+
+// logEvent — записать событие жизненного цикла задачи: текстом вида
+// "task error: ..." или, с WithStructuredLogging, одним JSON-объектом
+func (wp *WorkerPool) logEvent(event string, value interface{}, stack []byte) {
+	if !wp.structuredLog {
+		msg := strings.ReplaceAll(event, "_", " ")
+		if stack != nil {
+			wp.logger.Printf("%s: %v\n%s", msg, value, stack)
+			return
+		}
+		wp.logger.Printf("%s: %v", msg, value)
+		return
+	}
+
+	data, _ := json.Marshal(logEntry{
+		Event: event,
+		Err:   fmt.Sprint(value),
+		Stack: string(stack),
+		TS:    time.Now(),
+	})
+	wp.logger.Printf("%s", data)
+}
@@ -0,0 +1,62 @@
+// Package metrics — Prometheus-метрики для WorkerPool.
+// Вынесен в отдельный пакет, чтобы основной пул не зависел от Prometheus.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	wpkg "worker_pool"
+)
+
+// Collector — счётчики задач пула и датчики его загрузки. Все счётчики
+// читаются из Stats() пула при сборе метрик, поэтому согласованы между собой
+// и с /metrics.json; обработчики OnError/OnPanic не занимаются, и журнал
+// ошибок и паник пула по умолчанию продолжает работать.
+type Collector struct {
+	Submitted prometheus.CounterFunc
+	Completed prometheus.CounterFunc
+	Failed    prometheus.CounterFunc
+	Panicked  prometheus.CounterFunc
+	Retried   prometheus.CounterFunc
+}
+
+// New — создаёт метрики для пула и регистрирует их в reg
+func New(reg prometheus.Registerer, wp *wpkg.WorkerPool) *Collector {
+	stat := func(f func(s wpkg.PoolStats) int64) func() float64 {
+		return func() float64 { return float64(f(wp.Stats())) }
+	}
+	c := &Collector{
+		Submitted: newCounter("tasks_submitted_total", "Tasks accepted by the pool.",
+			stat(func(s wpkg.PoolStats) int64 { return s.Submitted })),
+		Completed: newCounter("tasks_completed_total", "Tasks that finished without error.",
+			stat(func(s wpkg.PoolStats) int64 { return s.Completed })),
+		Failed: newCounter("tasks_failed_total", "Tasks that returned an error.",
+			stat(func(s wpkg.PoolStats) int64 { return s.Failed })),
+		Panicked: newCounter("tasks_panicked_total", "Tasks that panicked.",
+			stat(func(s wpkg.PoolStats) int64 { return s.Panicked })),
+		Retried: newCounter("tasks_retried_total", "Retries scheduled by SubmitRetry.",
+			stat(func(s wpkg.PoolStats) int64 { return s.Retried })),
+	}
+
+	queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "worker_pool",
+		Name:      "queue_depth",
+		Help:      "Tasks waiting in the queue.",
+	}, func() float64 { return float64(wp.QueueLen()) })
+	activeWorkers := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "worker_pool",
+		Name:      "active_workers",
+		Help:      "Workers currently executing a task.",
+	}, func() float64 { return float64(wp.ActiveWorkers()) })
+
+	reg.MustRegister(c.Submitted, c.Completed, c.Failed, c.Panicked, c.Retried, queueDepth, activeWorkers)
+	return c
+}
+
+func newCounter(name, help string, value func() float64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: "worker_pool",
+		Name:      name,
+		Help:      help,
+	}, value)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	wpkg "worker_pool"
+)
+
+func TestCollector(t *testing.T) {
+	t.Run("счётчики отражают выполненные, упавшие и паникующие задачи", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		wp := wpkg.NewWorkerPool(2)
+		c := New(reg, wp)
+
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error { return nil })
+		}
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		_ = wp.Submit(func() error { panic("boom") })
+		wp.StopWait()
+
+		if got := testutil.ToFloat64(c.Submitted); got != 7 {
+			t.Errorf("ожидалось 7 отправленных задач, получили %v", got)
+		}
+		if got := testutil.ToFloat64(c.Completed); got != 5 {
+			t.Errorf("ожидалось 5 выполненных задач, получили %v", got)
+		}
+		if got := testutil.ToFloat64(c.Failed); got != 1 {
+			t.Errorf("ожидалась 1 упавшая задача, получили %v", got)
+		}
+		if got := testutil.ToFloat64(c.Panicked); got != 1 {
+			t.Errorf("ожидалась 1 паника, получили %v", got)
+		}
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("не удалось собрать метрики: %v", err)
+		}
+		found := false
+		for _, mf := range families {
+			if mf.GetName() == "worker_pool_tasks_completed_total" {
+				found = mf.GetMetric()[0].GetCounter().GetValue() == 5
+			}
+		}
+		if !found {
+			t.Error("в реестре нет счётчика выполненных задач с ожидаемым значением")
+		}
+	})
+
+	t.Run("счётчики совпадают со Stats пула", func(t *testing.T) {
+		wp := wpkg.NewWorkerPool(1, wpkg.WithLogger(nil))
+		c := New(prometheus.NewRegistry(), wp)
+
+		attempts := 0
+		_ = wp.SubmitRetry(func() error {
+			if attempts++; attempts < 3 {
+				return errors.New("fail")
+			}
+			return nil
+		}, wpkg.RetryOptions{MaxRetries: 5, BaseDelay: time.Millisecond})
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		wp.WaitIdle()
+		wp.StopWait()
+
+		s := wp.Stats()
+		for name, pair := range map[string][2]float64{
+			"Submitted": {testutil.ToFloat64(c.Submitted), float64(s.Submitted)},
+			"Completed": {testutil.ToFloat64(c.Completed), float64(s.Completed)},
+			"Failed":    {testutil.ToFloat64(c.Failed), float64(s.Failed)},
+			"Retried":   {testutil.ToFloat64(c.Retried), float64(s.Retried)},
+		} {
+			if pair[0] != pair[1] {
+				t.Errorf("%s: метрика %v, в Stats %v", name, pair[0], pair[1])
+			}
+		}
+		if s.Retried != 2 || s.Failed != 1 {
+			t.Errorf("ожидались 2 повтора и 1 упавшая задача, Stats: %+v", s)
+		}
+	})
+
+	t.Run("журнал ошибок пула по умолчанию сохраняется", func(t *testing.T) {
+		var buf bytes.Buffer
+		wp := wpkg.NewWorkerPool(1, wpkg.WithLogger(log.New(&buf, "", 0)))
+		New(prometheus.NewRegistry(), wp)
+
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		wp.StopWait()
+
+		if !strings.Contains(buf.String(), "fail") {
+			t.Errorf("ошибка задачи не попала в журнал: %q", buf.String())
+		}
+	})
+}
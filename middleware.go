@@ -0,0 +1,27 @@
+package worker_pool
+
+// Use — зарегистрировать middleware, оборачивающее каждую задачу, отправленную
+// после регистрации. Middleware применяются как в HTTP: первое
+// зарегистрированное выполняется первым (снаружи), задача пользователя —
+// внутри всей цепочки. Паники и ошибки цепочки обрабатываются так же, как
+// паники и ошибки самой задачи.
+func (wp *WorkerPool) Use(mw func(next func() error) func() error) {
+	if mw == nil {
+		return
+	}
+	wp.hooksMu.Lock()
+	wp.middleware = append(wp.middleware, mw)
+	wp.hooksMu.Unlock()
+}
+
+// applyMiddleware — обернуть задачу зарегистрированными middleware
+func (wp *WorkerPool) applyMiddleware(task func() error) func() error {
+	wp.hooksMu.RLock()
+	chain := wp.middleware
+	wp.hooksMu.RUnlock()
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		task = chain[i](task)
+	}
+	return task
+}
@@ -0,0 +1,26 @@
+package worker_pool
+
+// noErr — адаптировать функцию без результата к задаче пула
+func noErr(task func()) func() error {
+	if task == nil {
+		return nil
+	}
+	return func() error {
+		task()
+		return nil
+	}
+}
+
+// SubmitNoErr — как Submit, но для задачи, не возвращающей ошибку.
+// Паника восстанавливается и передаётся обработчикам OnPanic так же,
+// как у Submit.
+func (wp *WorkerPool) SubmitNoErr(task func()) error {
+	return wp.Submit(noErr(task))
+}
+
+// SubmitWaitNoErr — как SubmitWait, но для задачи, не возвращающей ошибку.
+// Возвращает *PanicError, если задача запаниковала, и ошибки постановки
+// в очередь (ErrPoolStopped, ErrReentrantDeadlock); иначе nil.
+func (wp *WorkerPool) SubmitWaitNoErr(task func()) error {
+	return wp.SubmitWait(noErr(task))
+}
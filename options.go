@@ -0,0 +1,234 @@
+package worker_pool
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Option — настройка пула, применяемая в конструкторе до запуска воркеров
+type Option func(*WorkerPool)
+
+// WithLogger — задаёт логгер для паник и ошибок задач.
+// nil отключает логирование.
+func WithLogger(l Logger) Option {
+	return func(wp *WorkerPool) {
+		if l == nil {
+			l = nopLogger{}
+		}
+		wp.logger = l
+	}
+}
+
+// WithQueueSize — ёмкость очереди задач вместо defaultQueueSize (или
+// queueSize NewWorkerPoolWithQueue). n == 0 — небуферизованная очередь,
+// n < 0 — ёмкость по умолчанию.
+func WithQueueSize(n int) Option {
+	return func(wp *WorkerPool) {
+		if n < 0 {
+			n = defaultQueueSize
+		}
+		wp.queueSize = n
+	}
+}
+
+// WithOnError — зарегистрировать обработчик ошибок задач при создании пула,
+// как OnError
+func WithOnError(handler func(err error)) Option {
+	return func(wp *WorkerPool) {
+		wp.OnError(handler)
+	}
+}
+
+// WithOnPanic — зарегистрировать обработчик паник в задачах при создании
+// пула, как OnPanic
+func WithOnPanic(handler func(recovered interface{}, stack []byte)) Option {
+	return func(wp *WorkerPool) {
+		wp.OnPanic(handler)
+	}
+}
+
+// WithStructuredLogging — писать события задач (ошибки и паники) в логгер
+// JSON-объектами вида {"event":"task_error","err":"...","ts":"..."} вместо
+// текста, чтобы их было проще разбирать в системах сбора логов
+func WithStructuredLogging() Option {
+	return func(wp *WorkerPool) {
+		wp.structuredLog = true
+	}
+}
+
+// WithMaxWorkers — верхняя граница числа воркеров вместо DefaultMaxWorkers.
+// Больший размер в конструкторе или Resize урезается до n с предупреждением
+// в логе. n <= 0 — граница по умолчанию.
+func WithMaxWorkers(n int) Option {
+	return func(wp *WorkerPool) {
+		if n <= 0 {
+			n = DefaultMaxWorkers
+		}
+		wp.maxWorkers = n
+	}
+}
+
+// WithPriorityQueue — выдавать задачи воркерам по приоритету (см. SubmitPriority)
+// вместо порядка поступления
+func WithPriorityQueue() Option {
+	return func(wp *WorkerPool) {
+		wp.priority = true
+	}
+}
+
+// WithPriorityAging — очередь с приоритетами (как WithPriorityQueue),
+// в которой приоритет ожидающей задачи растёт со временем по cfg.
+// Время берётся из часов пула (WithClock). При cfg.Rate <= 0 старения нет.
+func WithPriorityAging(cfg AgingConfig) Option {
+	return func(wp *WorkerPool) {
+		wp.priority = true
+		wp.aging = cfg
+	}
+}
+
+// WithWatchdog — раз в cfg.Interval проверять выполняющиеся задачи и сообщать
+// о тех, что идут дольше cfg.StuckThreshold: вызывать cfg.OnStuck или,
+// без него, писать в лог. Прервать задачу сторож не может — только
+// показать, что воркер занят ею. О каждом запуске задачи сообщается
+// не больше одного раза. cfg.StuckThreshold <= 0 — сторож выключен.
+func WithWatchdog(cfg WatchdogConfig) Option {
+	return func(wp *WorkerPool) {
+		wp.watchdog = nil
+		if cfg.StuckThreshold > 0 {
+			wp.watchdog = newWatchdog(cfg)
+		}
+	}
+}
+
+// WithStrictFIFO — запускать задачи строго в порядке выдачи из очереди
+// (порядке поступления или приоритета) и при нескольких воркерах. Забирает
+// и запускает задачу один свободный воркер за раз; выполняются задачи
+// по-прежнему параллельно и завершаться могут в любом порядке.
+// Без опции порядок выдачи соблюдается, но воркеры могут начать задачи
+// в другом порядке.
+func WithStrictFIFO() Option {
+	return func(wp *WorkerPool) {
+		wp.strictFIFO = true
+	}
+}
+
+// WithPanicPolicy — задать, что делать с паникой в задаче: восстановить
+// (PanicRecover, по умолчанию), уронить процесс (PanicPropagate — например,
+// в разработке, чтобы не прятать ошибки) или только передать в OnPanic
+// (PanicCallback)
+func WithPanicPolicy(p PanicPolicy) Option {
+	return func(wp *WorkerPool) {
+		wp.panicPolicy = p
+	}
+}
+
+// WithOverflowPolicy — задать, что делать с новой задачей, когда очередь
+// заполнена: отклонить её (OverflowDropNewest, по умолчанию), ждать места
+// (OverflowBlock) или вытеснить самую давнюю задачу (OverflowDropOldest)
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(wp *WorkerPool) {
+		wp.overflow = p
+	}
+}
+
+// WithClock — источник времени для отложенных и периодических задач,
+// повторов SubmitRetry и срока жизни SubmitWithTTL; по умолчанию системное
+// время. В тестах с MockClock таймеры срабатывают по Advance, без ожидания.
+func WithClock(c Clock) Option {
+	return func(wp *WorkerPool) {
+		if c == nil {
+			c = realClock{}
+		}
+		wp.clock = c
+	}
+}
+
+// WithMaxConcurrent — выполнять одновременно не больше n задач, даже если
+// воркеров больше: остальные воркеры забирают задачи и ждут свободного места.
+// Так число ожидающих задач отделено от числа выполняемых. Место
+// освобождается и при панике в задаче. n <= 0 — без ограничения.
+func WithMaxConcurrent(n int) Option {
+	return func(wp *WorkerPool) {
+		if n <= 0 {
+			wp.slots = nil
+			return
+		}
+		wp.slots = make(chan struct{}, n)
+	}
+}
+
+// WithQueue — зарегистрировать именованную очередь с весом weight для
+// SubmitTo: при нехватке воркеров задачи выбираются из непустых очередей
+// пропорционально весам (например, по очереди на арендатора). Задачи без
+// имени попадают в очередь по умолчанию с весом 1; ёмкость пула общая для всех
+// очередей. weight < 1 считается равным 1. Без WithQueue пул работает с одной
+// общей очередью, как прежде.
+func WithQueue(name string, weight int) Option {
+	return func(wp *WorkerPool) {
+		wp.namedQueues = append(wp.namedQueues, namedQueue{name: name, weight: max(weight, 1)})
+	}
+}
+
+// WithRateLimit — ограничить запуск задач: не больше rps задач в секунду
+// с всплеском до burst. Задачи принимаются в очередь как обычно, воркер ждёт
+// разрешения лимитера перед выполнением; ожидание прерывается остановкой пула.
+// rps <= 0 — без ограничения.
+func WithRateLimit(rps int, burst int) Option {
+	return func(wp *WorkerPool) {
+		if rps <= 0 {
+			wp.limiter = nil
+			return
+		}
+		wp.limiter = rate.NewLimiter(rate.Limit(rps), max(burst, 1))
+	}
+}
+
+// WithIdleTimeout — завершать воркер, простоявший без задач дольше d, пока
+// запущено больше воркеров, чем задано WithMinWorkers. Новые воркеры
+// запускаются по мере поступления задач, но не больше размера пула.
+// d <= 0 — воркеры не завершаются по простою.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(wp *WorkerPool) {
+		wp.idleTimeout = d
+	}
+}
+
+// WithMinWorkers — число воркеров, ниже которого пул не сжимается
+// по WithIdleTimeout (по умолчанию 0)
+func WithMinWorkers(n int) Option {
+	return func(wp *WorkerPool) {
+		wp.minWorkers = max(n, 0)
+	}
+}
+
+// WithCostBudget — ограничить суммарную стоимость принятых и ещё не завершённых
+// задач SubmitWeighted величиной budget; policy задаёт, ждать ли освобождения
+// бюджета или сразу возвращать ошибку. budget <= 0 — без ограничения.
+func WithCostBudget(budget int, policy BudgetPolicy) Option {
+	return func(wp *WorkerPool) {
+		if budget <= 0 {
+			wp.budget = nil
+			return
+		}
+		wp.budget = newCostBudget(budget, policy)
+	}
+}
+
+// WithWorkerInit — создавать ресурс воркера (соединение, буфер) один раз при
+// запуске каждого воркера; задачи SubmitLocal получают его аргументом.
+// Ошибка или паника инициализации уходят в OnError/OnPanic, а воркер
+// продолжает работу без ресурса.
+func WithWorkerInit(init func() (interface{}, error)) Option {
+	return func(wp *WorkerPool) {
+		wp.workerInit = init
+	}
+}
+
+// WithWorkerTeardown — освобождать ресурс, созданный WithWorkerInit,
+// при выходе воркера
+func WithWorkerTeardown(teardown func(local interface{})) Option {
+	return func(wp *WorkerPool) {
+		wp.workerTeardown = teardown
+	}
+}
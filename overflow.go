@@ -0,0 +1,23 @@
+package worker_pool
+
+// OverflowPolicy — что делают Submit и другие неблокирующие методы, когда
+// очередь заполнена и свободных воркеров нет (см. WithOverflowPolicy).
+// SubmitBatch, SubmitBatchAtomic и методы, которые и так ждут места
+// (SubmitBlocking, SubmitAll, SubmitWait), политика не меняет.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest — отклонить новую задачу с ErrQueueFull;
+	// поведение по умолчанию
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowBlock — ждать свободного места, как SubmitBlocking. Вызов
+	// из задачи того же пула вместо ожидания возвращает ErrReentrantDeadlock:
+	// место может освободить только сам ожидающий воркер.
+	OverflowBlock
+	// OverflowDropOldest — вытеснить самую давнюю задачу очереди (по времени
+	// постановки, независимо от приоритета и именованной очереди) и принять
+	// новую. Вытесненная задача не выполняется, учитывается в Stats().Evicted,
+	// а ожидающие её результата получают ErrQueueFull. Если буфера нет
+	// и вытеснять нечего, новая задача отклоняется с ErrQueueFull.
+	OverflowDropOldest
+)
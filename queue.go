@@ -0,0 +1,551 @@
+package worker_pool
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueItem — задача в очереди пула
+type queueItem struct {
+	run      func()
+	runLocal func(local interface{}) // вместо run: задача SubmitLocal
+	drop     func(err error)         // вызывается с причиной, если задача отброшена, так и не начавшись
+	priority int
+	seq      uint64 // порядковый номер постановки в очередь
+	tag      string // метка SubmitTagged для PendingTags
+	label    string // метка SubmitLabeled для сторожа зависших задач
+	queue    string // именованная очередь SubmitTo; "" — очередь по умолчанию
+
+	enqueuedAt time.Time     // момент постановки в очередь задачи SubmitWithTTL
+	ttl        time.Duration // срок жизни в очереди; 0 — без ограничения
+}
+
+// itemStore — хранилище задач, определяющее порядок их выдачи воркерам
+type itemStore interface {
+	push(it *queueItem)
+	pop() *queueItem
+	len() int
+	clear() []*queueItem
+	snapshot() []*queueItem // копия задач в порядке выдачи
+	oldest() *queueItem     // самая давняя задача по seq; nil — хранилище пусто
+	removeOldest() *queueItem
+}
+
+// fifoStore — задачи выдаются в порядке поступления
+type fifoStore struct {
+	items []*queueItem
+}
+
+func (s *fifoStore) push(it *queueItem) { s.items = append(s.items, it) }
+
+func (s *fifoStore) pop() *queueItem {
+	it := s.items[0]
+	s.items[0] = nil
+	s.items = s.items[1:]
+	return it
+}
+
+func (s *fifoStore) len() int { return len(s.items) }
+
+func (s *fifoStore) snapshot() []*queueItem {
+	return append([]*queueItem(nil), s.items...)
+}
+
+func (s *fifoStore) clear() []*queueItem {
+	items := s.items
+	s.items = nil
+	return items
+}
+
+func (s *fifoStore) oldest() *queueItem {
+	if len(s.items) == 0 {
+		return nil
+	}
+	return s.items[0]
+}
+
+func (s *fifoStore) removeOldest() *queueItem { return s.pop() }
+
+// priorityStore — куча: сначала задачи с большим приоритетом,
+// при равном приоритете — в порядке поступления
+type priorityStore struct {
+	items priorityHeap
+}
+
+func (s *priorityStore) push(it *queueItem) { heap.Push(&s.items, it) }
+
+func (s *priorityStore) pop() *queueItem { return heap.Pop(&s.items).(*queueItem) }
+
+func (s *priorityStore) len() int { return len(s.items) }
+
+func (s *priorityStore) snapshot() []*queueItem {
+	items := append(priorityHeap(nil), s.items...)
+	sort.Slice(items, items.Less)
+	return items
+}
+
+func (s *priorityStore) clear() []*queueItem {
+	items := s.items
+	s.items = nil
+	return items
+}
+
+// oldestIndex — индекс задачи с наименьшим seq; куча упорядочена
+// по приоритету, поэтому нужен полный проход
+func (s *priorityStore) oldestIndex() int {
+	i := -1
+	for j, it := range s.items {
+		if i < 0 || it.seq < s.items[i].seq {
+			i = j
+		}
+	}
+	return i
+}
+
+func (s *priorityStore) oldest() *queueItem {
+	if i := s.oldestIndex(); i >= 0 {
+		return s.items[i]
+	}
+	return nil
+}
+
+func (s *priorityStore) removeOldest() *queueItem {
+	return heap.Remove(&s.items, s.oldestIndex()).(*queueItem)
+}
+
+// priorityHeap — реализация heap.Interface для priorityStore
+type priorityHeap []*queueItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*queueItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
+
+// taskQueue — очередь задач пула под мьютексом. Воркеры ждут задачи на
+// notEmpty, блокирующие отправители ждут места на notFull.
+type taskQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	store    itemStore
+	capacity int
+	seq      uint64
+
+	idle    int  // воркеры, ждущие задачу: им задача передаётся сверх буфера
+	size    int  // заданное число воркеров; лишние воркеры завершаются
+	paused  bool // пул на паузе: воркеры не забирают задачи
+	closed  bool // очередь закрыта: новые задачи не принимаются
+	discard bool // Stop: оставшиеся задачи отброшены, воркеры больше не забирают задачи
+
+	// handoffs — принятые задачи, ждущие места в pushHandoff: пока они
+	// есть, воркеры не завершаются на опустевшей закрытой очереди
+	handoffs int
+
+	// live — число запущенных воркеров; меняется под mu, читается без блокировки.
+	// При idleTimeout > 0 воркер, простоявший дольше таймаута, завершается,
+	// пока live > minLive; новые воркеры запускаются через spawn по мере
+	// поступления задач.
+	live        atomic.Int64
+	minLive     int
+	idleTimeout time.Duration
+	spawn       func()
+}
+
+func newTaskQueue(capacity int, store itemStore, spawn func()) *taskQueue {
+	q := &taskQueue{store: store, capacity: capacity, spawn: spawn}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// spawnable — сколько воркеров можно запустить до заданного размера пула
+func (q *taskQueue) spawnable() int {
+	return max(q.size-int(q.live.Load()), 0)
+}
+
+// free — сколько задач можно принять: место в буфере плюс свободные
+// и ещё не запущенные воркеры
+func (q *taskQueue) free() int {
+	return max(q.capacity+q.idle+q.spawnable()-q.store.len(), 0)
+}
+
+// full — буфер занят и нет свободных воркеров, готовых забрать задачу
+func (q *taskQueue) full() bool {
+	return q.free() == 0
+}
+
+// add — поставить задачу; вызывается под q.mu. Если задач больше, чем
+// свободных воркеров, и пул ещё не достиг заданного размера, запускается
+// новый воркер.
+func (q *taskQueue) add(it *queueItem) {
+	q.seq++
+	it.seq = q.seq
+	q.store.push(it)
+	if q.store.len() > q.idle && q.spawnable() > 0 {
+		q.live.Add(1)
+		q.spawn()
+	}
+	q.notEmpty.Signal()
+}
+
+// tryPush — поставить задачу без ожидания
+func (q *taskQueue) tryPush(it *queueItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrPoolStopped
+	}
+	if q.full() {
+		return ErrQueueFull
+	}
+	q.add(it)
+	return nil
+}
+
+// tryPushEvict — как tryPush, но при заполненной очереди вытеснить самую
+// давнюю задачу и вернуть её (OverflowDropOldest)
+func (q *taskQueue) tryPushEvict(it *queueItem) (evicted *queueItem, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrPoolStopped
+	}
+	if q.full() {
+		if q.store.len() == 0 {
+			return nil, ErrQueueFull
+		}
+		evicted = q.store.removeOldest()
+	}
+	q.add(it)
+	return evicted, nil
+}
+
+// tryPushBatch — поставить сколько поместится задач из items, по порядку.
+// При all задачи ставятся, только если помещаются все.
+func (q *taskQueue) tryPushBatch(items []*queueItem, all bool) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrPoolStopped
+	}
+	free := q.free()
+	if all && free < len(items) {
+		return 0, ErrQueueFull
+	}
+
+	n := min(free, len(items))
+	for _, it := range items[:n] {
+		q.add(it)
+	}
+	if n < len(items) {
+		return n, ErrQueueFull
+	}
+	return n, nil
+}
+
+// tryHandoff — поставить без ожидания задачу, уже принятую пулом
+// (следующую задачу ключа). В отличие от tryPush, очередь, закрытая
+// StopWait, задачу принимает: воркеры дорабатывают её вместе с остальными.
+// При заполненной очереди возвращает ErrQueueFull и резервирует место
+// в handoffs: задачу нужно передать в pushHandoff.
+func (q *taskQueue) tryHandoff(it *queueItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.discard {
+		return ErrPoolStopped
+	}
+	if q.full() {
+		q.handoffs++
+		return ErrQueueFull
+	}
+	q.add(it)
+	return nil
+}
+
+// pushHandoff — дождаться места для задачи, которую не принял tryHandoff
+func (q *taskQueue) pushHandoff(ctx context.Context, it *queueItem) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.notFull.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer func() {
+		q.handoffs--
+		// воркеры, ждущие на закрытой очереди, могут завершиться
+		q.notEmpty.Broadcast()
+	}()
+
+	for {
+		if q.discard {
+			return ErrPoolStopped
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !q.full() {
+			q.add(it)
+			return nil
+		}
+		q.notFull.Wait()
+	}
+}
+
+// push — поставить задачу, дождавшись свободного места или отмены ctx
+func (q *taskQueue) push(ctx context.Context, it *queueItem) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.notFull.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return ErrPoolStopped
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !q.full() {
+			q.add(it)
+			return nil
+		}
+		q.notFull.Wait()
+	}
+}
+
+// available — сколько задач можно поставить без ожидания
+func (q *taskQueue) available() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0
+	}
+	return q.free()
+}
+
+// waitFree — дождаться свободного места, не занимая его, или отмены ctx
+func (q *taskQueue) waitFree(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.notFull.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return ErrPoolStopped
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !q.full() {
+			return nil
+		}
+		q.notFull.Wait()
+	}
+}
+
+// pop — забрать задачу для воркера. ok == false означает, что воркер
+// должен завершиться: пул уменьшен, воркер простоял дольше таймаута
+// или очередь закрыта и пуста. На паузе воркер ждёт, не забирая задачи;
+// закрытие очереди снимает паузу, чтобы StopWait мог её доработать.
+func (q *taskQueue) pop() (it *queueItem, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var idleSince time.Time
+	for {
+		if int(q.live.Load()) > q.size {
+			q.live.Add(-1)
+			if q.store.len() > 0 {
+				// задачу заберёт другой воркер
+				q.notEmpty.Signal()
+			}
+			return nil, false
+		}
+		if q.discard {
+			// Stop начат: задачи в очереди уже отброшены
+			q.live.Add(-1)
+			return nil, false
+		}
+		if q.paused && !q.closed {
+			// на паузе воркер не считается свободным и не завершается по простою
+			q.notEmpty.Wait()
+			idleSince = time.Time{}
+			continue
+		}
+		if q.store.len() > 0 {
+			it = q.store.pop()
+			q.notFull.Broadcast()
+			return it, true
+		}
+		if q.closed && q.handoffs == 0 {
+			q.live.Add(-1)
+			return nil, false
+		}
+
+		if q.idleTimeout <= 0 || int(q.live.Load()) <= q.minLive {
+			q.idle++
+			q.notFull.Broadcast()
+			q.notEmpty.Wait()
+			q.idle--
+			idleSince = time.Time{}
+			continue
+		}
+
+		if idleSince.IsZero() {
+			idleSince = time.Now()
+		}
+		left := q.idleTimeout - time.Since(idleSince)
+		if left <= 0 {
+			q.live.Add(-1)
+			return nil, false
+		}
+		q.idle++
+		q.notFull.Broadcast()
+		// sync.Cond не умеет ждать с таймаутом: будим воркеров по таймеру
+		tm := time.AfterFunc(left, func() {
+			q.mu.Lock()
+			q.notEmpty.Broadcast()
+			q.mu.Unlock()
+		})
+		q.notEmpty.Wait()
+		tm.Stop()
+		q.idle--
+	}
+}
+
+// resize — задать число воркеров n и вернуть, сколько новых воркеров нужно
+// запустить. При уменьшении лишние воркеры выходят при следующем обращении
+// к очереди; увеличение сначала отменяет такие выходы.
+func (q *taskQueue) resize(n int) (spawn int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.size = n
+	spawn = q.spawnable()
+	q.live.Add(int64(spawn))
+	q.notEmpty.Broadcast()
+	return spawn
+}
+
+// setPaused — поставить выдачу задач на паузу или снять с неё
+func (q *taskQueue) setPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused = paused
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// close — перестать принимать задачи; при discard выбросить оставшиеся
+// в очереди и вернуть их
+func (q *taskQueue) close(discard bool) []*queueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	var dropped []*queueItem
+	if discard {
+		q.discard = true
+		dropped = q.store.clear()
+	}
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	return dropped
+}
+
+// clear — выбросить задачи, ждущие в очереди, и вернуть их. Задачи, уже
+// забранные воркерами, не затрагиваются.
+func (q *taskQueue) clear() []*queueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := q.store.clear()
+	q.notFull.Broadcast()
+	return dropped
+}
+
+// isClosed — очередь закрыта для новых задач
+func (q *taskQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// len — число задач в очереди
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.store.len()
+}
+
+// cap — ёмкость буфера очереди
+func (q *taskQueue) cap() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.capacity
+}
+
+// setCap — задать ёмкость буфера; меньше числа задач в очереди нельзя,
+// чтобы не потерять уже принятые задачи
+func (q *taskQueue) setCap(n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrPoolStopped
+	}
+	if n < q.store.len() {
+		return errQueueCapTooSmall
+	}
+	q.capacity = n
+	q.notFull.Broadcast()
+	return nil
+}
+
+// snapshot — задачи, ожидающие в очереди, в порядке выдачи воркерам
+func (q *taskQueue) snapshot() []*queueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.store.snapshot()
+}
@@ -0,0 +1,39 @@
+package worker_pool
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// goroutineID — номер текущей горутины из заголовка её стека
+// ("goroutine 42 [running]:"); в Go нет горутинно-локальных переменных,
+// поэтому воркеры помечаются по этому номеру
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// enterWorker — пометить текущую горутину как воркер пула
+func (wp *WorkerPool) enterWorker() uint64 {
+	id := goroutineID()
+	wp.workerGoroutines.Store(id, struct{}{})
+	return id
+}
+
+// leaveWorker — снять пометку воркера с горутины id
+func (wp *WorkerPool) leaveWorker(id uint64) {
+	wp.workerGoroutines.Delete(id)
+}
+
+// inWorker — вызов сделан из задачи, выполняемой воркером этого пула
+func (wp *WorkerPool) inWorker() bool {
+	_, ok := wp.workerGoroutines.Load(goroutineID())
+	return ok
+}
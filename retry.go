@@ -0,0 +1,95 @@
+package worker_pool
+
+import (
+	"math"
+	"math/rand/v2"
+	"runtime/debug"
+	"time"
+)
+
+// defaultRetryBaseDelay — задержка перед первым повтором, если BaseDelay не задан
+const defaultRetryBaseDelay = 100 * time.Millisecond
+
+// RetryOptions — параметры повторов для SubmitRetry
+type RetryOptions struct {
+	MaxRetries int           // число повторов после первой неудачной попытки
+	BaseDelay  time.Duration // задержка перед первым повтором, удваивается с каждой попыткой
+	MaxDelay   time.Duration // верхняя граница задержки; 0 — без ограничения
+	Jitter     bool          // добавлять к задержке случайную величину до BaseDelay
+
+	// RetryableFunc решает, стоит ли повторять задачу после ошибки err:
+	// false — сдаться сразу, как после последней попытки. nil — повторять
+	// при любой ошибке.
+	RetryableFunc func(err error) bool
+}
+
+// retryable — повторять ли задачу после ошибки err
+func (o RetryOptions) retryable(err error) bool {
+	return o.RetryableFunc == nil || o.RetryableFunc(err)
+}
+
+// backoff — задержка перед повтором номер attempt (с единицы)
+func (o RetryOptions) backoff(attempt int) time.Duration {
+	base := o.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	d := base
+	for i := 1; i < attempt && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if o.Jitter && d < math.MaxInt64-base {
+		d += rand.N(base)
+	}
+	if o.MaxDelay > 0 && d > o.MaxDelay {
+		d = o.MaxDelay
+	}
+	return d
+}
+
+// SubmitRetry — добавить задачу, которая при ошибке ставится в очередь повторно
+// с экспоненциальной задержкой, не более opts.MaxRetries раз; ошибки, для
+// которых opts.RetryableFunc вернул false, не повторяются. Ошибка последней
+// попытки уходит в OnError; паника повтором не считается и уходит в OnPanic.
+// Пока ждёт повтора, задача учитывается в WaitIdle; если пул остановлен,
+// повтор отменяется и в OnError уходит последняя ошибка.
+func (wp *WorkerPool) SubmitRetry(task func() error, opts RetryOptions) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueue(wp.retryItem(wp.applyMiddleware(task), opts, 0))
+}
+
+// retryItem — задача SubmitRetry; attempt — число уже выполненных повторов
+func (wp *WorkerPool) retryItem(task func() error, opts RetryOptions, attempt int) *queueItem {
+	return &queueItem{run: func() {
+		defer func() {
+			if r := recover(); r != nil {
+				wp.stats.panic()
+				wp.handlePanic(r, debug.Stack())
+				panic(taskPanicked{})
+			}
+		}()
+		err := task()
+		if err == nil {
+			wp.stats.finish(nil)
+			return
+		}
+		fail := func() {
+			wp.stats.finish(err)
+			wp.handleError(err)
+		}
+		if attempt >= opts.MaxRetries || !opts.retryable(err) {
+			fail()
+			return
+		}
+
+		next := wp.retryItem(task, opts, attempt+1)
+		if wp.schedule(opts.backoff(attempt+1), next, fail) != nil {
+			fail()
+			return
+		}
+		wp.stats.retried.Add(1)
+	}}
+}
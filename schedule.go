@@ -0,0 +1,143 @@
+package worker_pool
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SubmitAfter — добавить задачу, которая встанет в очередь через d.
+// Пока задача ждёт, она учитывается в WaitIdle; при остановке пула
+// ожидающие задачи отменяются и не выполняются.
+func (wp *WorkerPool) SubmitAfter(d time.Duration, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	if err := wp.schedule(d, &queueItem{run: wp.wrap(task)}, nil); err != nil {
+		return err
+	}
+	wp.stats.submitted.Add(1)
+	return nil
+}
+
+// SubmitAt — добавить задачу, которая встанет в очередь в момент t
+// по часам пула
+func (wp *WorkerPool) SubmitAt(t time.Time, task func() error) error {
+	return wp.SubmitAfter(t.Sub(wp.clock.Now()), task)
+}
+
+// schedule — поставить задачу в очередь через d. dropped, если задан,
+// вызывается, когда задача так и не попала в очередь: таймер отменён
+// остановкой пула или очередь к моменту срабатывания закрыта.
+func (wp *WorkerPool) schedule(d time.Duration, it *queueItem, dropped func()) error {
+	wp.timersMu.Lock()
+	defer wp.timersMu.Unlock()
+
+	if wp.timersClosed {
+		return ErrPoolStopped
+	}
+	if wp.timers == nil {
+		wp.timers = make(map[Timer]func())
+	}
+
+	// задача учитывается в pending до постановки в очередь
+	wp.addPending(1)
+	var tm Timer
+	tm = wp.clock.AfterFunc(d, func() {
+		wp.timersMu.Lock()
+		_, ok := wp.timers[tm]
+		delete(wp.timers, tm)
+		wp.timersMu.Unlock()
+		if !ok {
+			// таймер уже отменён в cancelTimers
+			return
+		}
+
+		// учёт в pending переходит от таймера к очереди
+		if wp.queue.push(wp.ctx, it) != nil {
+			if dropped != nil {
+				dropped()
+			}
+			wp.taskDone()
+		}
+	})
+	wp.timers[tm] = dropped
+	return nil
+}
+
+// cancelTimers — отменить все отложенные задачи и запретить новые
+func (wp *WorkerPool) cancelTimers() {
+	wp.timersMu.Lock()
+	timers := wp.timers
+	wp.timers = nil
+	wp.timersClosed = true
+	wp.timersMu.Unlock()
+
+	for tm, dropped := range timers {
+		tm.Stop()
+		if dropped != nil {
+			dropped()
+		}
+		wp.taskDone()
+	}
+}
+
+// SubmitEvery — выполнять задачу через пул каждые interval, пока не вызвана
+// возвращённая cancel или пул не остановлен. Запуски не перекрываются: если
+// предыдущий ещё в очереди или выполняется, очередной тик пропускается.
+// После cancel новые запуски не начинаются; cancel можно вызывать повторно.
+func (wp *WorkerPool) SubmitEvery(interval time.Duration, task func() error) (cancel func()) {
+	stop := make(chan struct{})
+	var once sync.Once
+	cancel = func() { once.Do(func() { close(stop) }) }
+	if task == nil || interval <= 0 {
+		cancel()
+		return cancel
+	}
+
+	var inFlight atomic.Bool
+	run := func() error {
+		defer inFlight.Store(false)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		return task()
+	}
+
+	go func() {
+		// как у time.Ticker: тики не сдвигаются на время постановки задачи,
+		// а пропущенные не наверстываются
+		next := wp.clock.Now()
+		for {
+			next = next.Add(interval)
+			if now := wp.clock.Now(); next.Before(now) {
+				next = now
+			}
+			select {
+			case <-stop:
+				return
+			case <-wp.ctx.Done():
+				return
+			case <-wp.clock.After(next.Sub(wp.clock.Now())):
+			}
+			if !inFlight.CompareAndSwap(false, true) {
+				continue
+			}
+			// отброшенный из очереди тик (CancelAll, вытеснение
+			// OverflowDropOldest, остановка) не выполнит run, поэтому
+			// признак запуска снимает drop
+			it := &queueItem{run: wp.wrap(run), drop: func(error) { inFlight.Store(false) }}
+			if err := wp.enqueue(it); err != nil {
+				inFlight.Store(false)
+				if errors.Is(err, ErrPoolStopped) {
+					return
+				}
+			}
+		}
+	}()
+	return cancel
+}
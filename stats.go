@@ -0,0 +1,103 @@
+package worker_pool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PoolStats — снимок накопленных счётчиков пула. Возвращается по значению,
+// поэтому вызывающий может хранить и сравнивать снимки.
+type PoolStats struct {
+	Submitted int64 // задачи, принятые пулом; повторы SubmitRetry не учитываются
+	Completed int64 // задачи, выполненные без ошибки
+	Failed    int64 // задачи, вернувшие ошибку (для SubmitRetry — после последней попытки)
+	Panicked  int64 // задачи, завершившиеся паникой
+	Retried   int64 // повторы, запланированные SubmitRetry
+	Expired   int64 // задачи SubmitWithTTL, отброшенные из-за истёкшего срока
+	Evicted   int64 // задачи, вытесненные из очереди по OverflowDropOldest
+	Queued    int   // задачи, ожидающие в очереди в момент снимка
+	Active    int   // воркеры, выполняющие задачу в момент снимка
+
+	// WorkerPanics — число паник по номерам воркеров, на которых они
+	// случились; воркеры без паник не попадают, nil — паник не было
+	WorkerPanics map[int]int64
+}
+
+// taskCounters — атомарные счётчики, из которых собирается PoolStats
+type taskCounters struct {
+	submitted atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	panicked  atomic.Int64
+	retried   atomic.Int64
+	expired   atomic.Int64
+	evicted   atomic.Int64
+
+	workerMu     sync.Mutex
+	workerPanics map[int]int64
+}
+
+// finish — учесть задачу, вернувшую err
+func (c *taskCounters) finish(err error) {
+	if err != nil {
+		c.failed.Add(1)
+		return
+	}
+	c.completed.Add(1)
+}
+
+// panic — учесть задачу, завершившуюся паникой
+func (c *taskCounters) panic() {
+	c.panicked.Add(1)
+}
+
+// workerPanic — учесть панику задачи на воркере id
+func (c *taskCounters) workerPanic(id int) {
+	c.workerMu.Lock()
+	if c.workerPanics == nil {
+		c.workerPanics = make(map[int]int64)
+	}
+	c.workerPanics[id]++
+	c.workerMu.Unlock()
+}
+
+// workerSnapshot — копия счётчиков паник по воркерам
+func (c *taskCounters) workerSnapshot() map[int]int64 {
+	c.workerMu.Lock()
+	defer c.workerMu.Unlock()
+	if c.workerPanics == nil {
+		return nil
+	}
+	m := make(map[int]int64, len(c.workerPanics))
+	for id, n := range c.workerPanics {
+		m[id] = n
+	}
+	return m
+}
+
+// Stats — снимок счётчиков задач пула. Дёшев и подходит для частого опроса;
+// счётчики читаются по отдельности, поэтому при идущих задачах сумма
+// Completed, Failed, Panicked, Expired, Evicted, Queued и Active может ненадолго
+// расходиться с Submitted.
+func (wp *WorkerPool) Stats() PoolStats {
+	return PoolStats{
+		Submitted: wp.stats.submitted.Load(),
+		Completed: wp.stats.completed.Load(),
+		Failed:    wp.stats.failed.Load(),
+		Panicked:  wp.stats.panicked.Load(),
+		Retried:   wp.stats.retried.Load(),
+		Expired:   wp.stats.expired.Load(),
+		Evicted:   wp.stats.evicted.Load(),
+		Queued:    wp.QueueLen(),
+		Active:    wp.ActiveWorkers(),
+
+		WorkerPanics: wp.stats.workerSnapshot(),
+	}
+}
+
+// PanicCount — число задач, завершившихся паникой, с запуска пула; то же,
+// что Stats().Panicked. Паники считаются отдельно от ошибок задач и при
+// любой PanicPolicy, даже если обработчики OnPanic не зарегистрированы.
+func (wp *WorkerPool) PanicCount() int64 {
+	return wp.stats.panicked.Load()
+}
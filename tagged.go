@@ -0,0 +1,24 @@
+package worker_pool
+
+// SubmitTagged — добавить задачу с меткой (например, идентификатором заказа).
+// Пока задача ждёт в очереди, её метка видна в PendingTags.
+func (wp *WorkerPool) SubmitTagged(tag string, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueue(&queueItem{run: wp.wrap(task), tag: tag})
+}
+
+// PendingTags — метки задач SubmitTagged, которые ждут в очереди и ещё
+// не взяты воркером, в порядке их выдачи. Задачи без метки не попадают
+// в список; их общее число с меченными возвращает QueueLen.
+func (wp *WorkerPool) PendingTags() []string {
+	var tags []string
+	for _, it := range wp.queue.snapshot() {
+		if it.tag != "" {
+			tags = append(tags, it.tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,50 @@
+// Package tracing — спаны OpenTelemetry для задач WorkerPool.
+// Вынесен в отдельный пакет, чтобы основной пул не зависел от OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName — имя трейсера, под которым создаются спаны задач
+const instrumentationName = "worker_pool"
+
+// Tracer — создаёт спан на каждое выполнение задачи
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New — создаёт Tracer поверх провайдера tp
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Wrap — оборачивает задачу для SubmitContext: при выполнении в воркере
+// открывается спан label, дочерний к спану из контекста задачи. Ошибка
+// задачи записывается в спан со статусом Error; паника записывается
+// событием и пробрасывается дальше, чтобы её обработал пул.
+func (t *Tracer) Wrap(label string, task func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) (err error) {
+		ctx, span := t.tracer.Start(ctx, label)
+		defer span.End()
+		defer func() {
+			if r := recover(); r != nil {
+				span.AddEvent("panic", trace.WithAttributes(attribute.String("panic.value", fmt.Sprint(r))))
+				span.SetStatus(codes.Error, "task panicked")
+				panic(r)
+			}
+		}()
+
+		err = task(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
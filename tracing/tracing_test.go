@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	wpkg "worker_pool"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tr := New(tp)
+
+	wp := wpkg.NewWorkerPool(2, wpkg.WithLogger(nil))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	_ = wp.SubmitContext(ctx, tr.Wrap("ok", func(context.Context) error { return nil }))
+	_ = wp.SubmitContext(ctx, tr.Wrap("fail", func(context.Context) error { return errors.New("boom") }))
+	_ = wp.SubmitContext(ctx, tr.Wrap("panic", func(context.Context) error { panic("oops") }))
+	wp.StopWait()
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	for _, name := range []string{"ok", "fail", "panic"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Fatalf("нет спана %q", name)
+		}
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("спан %q должен быть дочерним к спану запроса", name)
+		}
+	}
+
+	if got := spans["ok"].Status().Code; got != codes.Unset {
+		t.Errorf("успешная задача: статус %v, ожидался Unset", got)
+	}
+	if st := spans["fail"].Status(); st.Code != codes.Error || st.Description != "boom" {
+		t.Errorf("упавшая задача: статус %+v, ожидался Error с текстом ошибки", st)
+	}
+	if st := spans["panic"].Status(); st.Code != codes.Error {
+		t.Errorf("паника: статус %+v, ожидался Error", st)
+	}
+	if events := spans["panic"].Events(); len(events) == 0 || events[0].Name != "panic" {
+		t.Errorf("паника должна записываться событием, события: %+v", events)
+	}
+}
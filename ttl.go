@@ -0,0 +1,19 @@
+package worker_pool
+
+import "time"
+
+// SubmitWithTTL — добавить задачу со сроком жизни в очереди. Если к моменту,
+// когда воркер забирает задачу, она прождала дольше ttl, задача не
+// выполняется и учитывается в Stats().Expired. ttl <= 0 — срок не ограничен.
+func (wp *WorkerPool) SubmitWithTTL(ttl time.Duration, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueue(&queueItem{run: wp.wrap(task), enqueuedAt: wp.clock.Now(), ttl: ttl})
+}
+
+// expired — задача SubmitWithTTL прождала в очереди дольше своего срока
+func (it *queueItem) expired(c Clock) bool {
+	return it.ttl > 0 && c.Now().Sub(it.enqueuedAt) > it.ttl
+}
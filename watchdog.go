@@ -0,0 +1,113 @@
+package worker_pool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WatchdogConfig — настройки сторожа зависших задач (см. WithWatchdog)
+type WatchdogConfig struct {
+	StuckThreshold time.Duration        // сколько задача может выполняться, прежде чем считаться зависшей
+	Interval       time.Duration        // период проверки; 0 — StuckThreshold/2
+	OnStuck        func(task StuckTask) // nil — запись в лог
+}
+
+// StuckTask — задача, выполняющаяся дольше WatchdogConfig.StuckThreshold
+type StuckTask struct {
+	Worker  int           // номер воркера, как в Stats().WorkerPanics
+	Label   string        // метка SubmitLabeled; "" — без метки
+	Tag     string        // метка SubmitTagged; "" — без метки
+	Started time.Time     // момент запуска по часам пула
+	Running time.Duration // сколько задача выполнялась к моменту проверки
+}
+
+// String — описание зависшей задачи для лога
+func (t StuckTask) String() string {
+	s := fmt.Sprintf("worker %d running for %v", t.Worker, t.Running)
+	if t.Label != "" {
+		s += " label=" + t.Label
+	}
+	if t.Tag != "" {
+		s += " tag=" + t.Tag
+	}
+	return s
+}
+
+// watchdog — выполняющиеся задачи по номеру воркера; о каждой зависшей
+// задаче сообщается один раз за запуск
+type watchdog struct {
+	cfg WatchdogConfig
+
+	mu      sync.Mutex
+	running map[int]*watchedTask
+}
+
+// watchedTask — выполняющаяся задача и признак, что о ней уже сообщили
+type watchedTask struct {
+	task     StuckTask
+	reported bool
+}
+
+func newWatchdog(cfg WatchdogConfig) *watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = max(cfg.StuckThreshold/2, time.Millisecond)
+	}
+	return &watchdog{cfg: cfg, running: make(map[int]*watchedTask)}
+}
+
+// begin — воркер worker начал задачу it в момент now
+func (w *watchdog) begin(worker int, it *queueItem, now time.Time) {
+	w.mu.Lock()
+	w.running[worker] = &watchedTask{task: StuckTask{
+		Worker:  worker,
+		Label:   it.label,
+		Tag:     it.tag,
+		Started: now,
+	}}
+	w.mu.Unlock()
+}
+
+// end — воркер worker завершил задачу
+func (w *watchdog) end(worker int) {
+	w.mu.Lock()
+	delete(w.running, worker)
+	w.mu.Unlock()
+}
+
+// stuck — задачи, зависшие к моменту now, о которых ещё не сообщали
+func (w *watchdog) stuck(now time.Time) []StuckTask {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var stuck []StuckTask
+	for _, wt := range w.running {
+		running := now.Sub(wt.task.Started)
+		if wt.reported || running < w.cfg.StuckThreshold {
+			continue
+		}
+		wt.reported = true
+		t := wt.task
+		t.Running = running
+		stuck = append(stuck, t)
+	}
+	return stuck
+}
+
+// watchStuck — цикл сторожа зависших задач; завершается при остановке пула
+func (wp *WorkerPool) watchStuck() {
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-wp.clock.After(wp.watchdog.cfg.Interval):
+		}
+		for _, t := range wp.watchdog.stuck(wp.clock.Now()) {
+			if h := wp.watchdog.cfg.OnStuck; h != nil {
+				wp.safeCall(func() { h(t) })
+			} else {
+				wp.logEvent("task_stuck", t, nil)
+			}
+		}
+	}
+}
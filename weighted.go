@@ -0,0 +1,115 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// BudgetPolicy — поведение SubmitWeighted, когда бюджет стоимости исчерпан
+type BudgetPolicy int
+
+const (
+	// BudgetReject — сразу вернуть ошибку
+	BudgetReject BudgetPolicy = iota
+	// BudgetBlock — ждать, пока завершатся задачи и освободят бюджет
+	BudgetBlock
+)
+
+var errBudgetExceeded = errors.New("worker pool cost budget exceeded")
+
+// costBudget — взвешенный семафор: сумма стоимостей принятых и ещё
+// не завершённых задач не превышает limit
+type costBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	used   int
+	policy BudgetPolicy
+	closed bool
+}
+
+func newCostBudget(limit int, policy BudgetPolicy) *costBudget {
+	b := &costBudget{limit: limit, policy: policy}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire — занять cost из бюджета. Задача дороже всего бюджета
+// не помещается никогда и отклоняется сразу при любой политике.
+func (b *costBudget) acquire(cost int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if cost > b.limit {
+		return errBudgetExceeded
+	}
+	for {
+		if b.closed {
+			return ErrPoolStopped
+		}
+		if b.used+cost <= b.limit {
+			b.used += cost
+			return nil
+		}
+		if b.policy != BudgetBlock {
+			return errBudgetExceeded
+		}
+		b.cond.Wait()
+	}
+}
+
+// release — вернуть cost в бюджет
+func (b *costBudget) release(cost int) {
+	b.mu.Lock()
+	b.used -= cost
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// close — разбудить ждущих в acquire: пул останавливается
+func (b *costBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// SubmitWeighted — добавить задачу со стоимостью cost (например, размером
+// данных). В пуле, созданном с WithCostBudget, задача принимается, только если
+// сумма стоимостей принятых и ещё не завершённых задач с ней не превысит
+// бюджет; иначе, в зависимости от политики, возвращается ошибка или вызов ждёт
+// освобождения бюджета (и места в очереди). Без WithCostBudget стоимость
+// не учитывается.
+func (wp *WorkerPool) SubmitWeighted(cost int, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if wp.budget == nil || cost <= 0 {
+		return wp.Submit(task)
+	}
+
+	if err := wp.budget.acquire(cost); err != nil {
+		return err
+	}
+	run := wp.wrap(task)
+	it := &queueItem{
+		run: func() {
+			defer wp.budget.release(cost)
+			run()
+		},
+		// отброшенная задача (CancelAll, Stop) возвращает стоимость в бюджет
+		drop: func(error) { wp.budget.release(cost) },
+	}
+
+	var err error
+	if wp.budget.policy == BudgetBlock {
+		err = wp.enqueueWait(context.Background(), it)
+	} else {
+		err = wp.enqueue(it)
+	}
+	if err != nil {
+		wp.budget.release(cost)
+	}
+	return err
+}
@@ -1,145 +1,956 @@
-package worker_pool
-
-import (
-    "context"
-    "errors"
-    "log"
-    "runtime/debug"
-    "sync"
-)
-
-type WorkerPool struct {
-	workers   int
-	taskQueue chan func()
-
-	waitGroup sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-}
-
-// NewWorkerPool — создаёт пул воркеров
-func NewWorkerPool(numberOfWorkers int) *WorkerPool {
-	if numberOfWorkers <= 0 {
-		numberOfWorkers = 1
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	wp := &WorkerPool{
-		workers:   numberOfWorkers,
-		taskQueue: make(chan func(), 100),
-		ctx:       ctx,
-		cancel:    cancel,
-	}
-
-	for i := 0; i < numberOfWorkers; i++ {
-		wp.waitGroup.Add(1)
-		go wp.worker()
-	}
-
-	return wp
-}
-
-// worker — воркер, выполняющий задачи
-func (wp *WorkerPool) worker() {
-	defer wp.waitGroup.Done()
-
-	for {
-		select {
-		case <-wp.ctx.Done():
-			return
-		case task, ok := <-wp.taskQueue:
-			if !ok {
-				return
-			}
-			if task != nil {
-                func() {
-                    defer func() {
-                        if r := recover(); r != nil {
-                            log.Printf("worker recovered panic: %v\n%s", r, debug.Stack())
-                        }
-                    }()
-                    task()
-                }()
-			}
-		}
-	}
-}
-
-// Submit — добавить задачу в пул
-func (wp *WorkerPool) Submit(task func() error) error {
-    if task == nil {
-        return nil
-    }
-
-    wrapped := func() {
-        defer func() {
-            if r := recover(); r != nil {
-                log.Printf("task panic: %v\n%s", r, debug.Stack())
-            }
-        }()
-        if err := task(); err != nil {
-            log.Printf("task error: %v", err)
-        }
-    }
-
-    select {
-    case wp.taskQueue <- wrapped:
-        return nil
-    default:
-        return errors.New("worker pool queue is full")
-    }
-}
-
-// SubmitWait — добавить задачу и дождаться её завершения
-func (wp *WorkerPool) SubmitWait(task func() error) error {
-    if task == nil {
-        return nil
-    }
-
-    done := make(chan error, 1)
-    wrappedTask := func() {
-        defer func() {
-            if r := recover(); r != nil {
-                log.Printf("task panic: %v\n%s", r, debug.Stack())
-                done <- errors.New("task panicked")
-            }
-        }()
-        done <- task()
-    }
-
-    wp.taskQueue <- wrappedTask
-    return <-done
-}
-
-// Stop — выполнить только текущие задачи, отбросив очередь
-func (wp *WorkerPool) Stop() {
-cleanup:
-	for {
-		select {
-		case <-wp.taskQueue:
-			// выбрасываем задачи
-		default:
-			break cleanup
-		}
-	}
-
-	wp.cancel()
-	wp.waitGroup.Wait()
-}
-
-// StopWait — дождаться выполнения всех задач в очереди
-func (wp *WorkerPool) StopWait() {
-	close(wp.taskQueue)
-	wp.waitGroup.Wait()
-}
-
-// IsRunning — проверка, есть ли ещё активные воркеры
-func (wp *WorkerPool) IsRunning() bool {
-	select {
-	case <-wp.ctx.Done():
-		return false
-	default:
-		return true
-	}
-}
+package worker_pool
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "runtime/debug"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "golang.org/x/time/rate"
+)
+
+type WorkerPool struct {
+	workers  atomic.Int64 // текущее число воркеров
+	queue    *taskQueue
+	active   atomic.Int64 // число воркеров, выполняющих задачу в данный момент
+	stats    taskCounters // накопленные счётчики задач для Stats
+	logger   Logger
+	priority bool          // очередь с приоритетами вместо FIFO
+	limiter  *rate.Limiter // ограничение частоты запуска задач; nil — без ограничения
+	slots    chan struct{} // семафор WithMaxConcurrent; nil — без ограничения
+
+	latencies latencyRecorder // длительности выполнения задач для Latencies
+
+	structuredLog bool // WithStructuredLogging: события в лог JSON-объектами
+
+	workerSeq atomic.Int64 // последний выданный номер воркера (см. Stats().WorkerPanics)
+
+	workerGoroutines sync.Map // номера горутин воркеров для обнаружения реентерабельного SubmitWait
+
+	labels sync.Map // метка SubmitLabeled -> *taskCounters для StatsByLabel
+
+	// keyed — очереди ключей SubmitKeyed: ключ присутствует, пока его задача
+	// стоит в очереди пула или выполняется; значение — задачи, ждущие её
+	keyedMu sync.Mutex
+	keyed   map[string][]func()
+
+	idleTimeout time.Duration // простой, после которого воркер завершается; 0 — без ограничения
+	minWorkers  int           // число воркеров, ниже которого пул не сжимается по простою
+	maxWorkers  int           // верхняя граница числа воркеров (WithMaxWorkers)
+
+	strictFIFO  bool         // запускать задачи строго в порядке выдачи из очереди
+	namedQueues []namedQueue // очереди WithQueue; пусто — одна общая очередь
+	panicPolicy PanicPolicy  // что делать с паникой в задаче
+
+	queueSize int // ёмкость очереди (NewWorkerPoolWithQueue, WithQueueSize)
+
+	watchdog *watchdog // сторож зависших задач (WithWatchdog); nil — выключен
+
+	overflow OverflowPolicy // что делать с задачей при заполненной очереди (WithOverflowPolicy)
+
+	budget *costBudget // бюджет стоимости задач SubmitWeighted; nil — без ограничения
+
+	workerInit     func() (interface{}, error) // создаёт ресурс воркера при его запуске
+	workerTeardown func(local interface{})     // освобождает ресурс при выходе воркера
+
+	resizeMu sync.Mutex
+	startMu  sync.Mutex // с WithStrictFIFO: задачу забирает и запускает один воркер за раз
+	stopOnce sync.Once
+
+	// pending — задачи, принятые в очередь и ещё не завершённые;
+	// увеличивается до постановки в очередь, чтобы WaitIdle не пропустил задачу,
+	// которую воркер уже забрал, но ещё не начал выполнять
+	idleMu   sync.Mutex
+	idleCond *sync.Cond
+	pending  int
+	finished uint64 // задачи, выполненные воркерами с запуска пула (для WaitN)
+
+	// timers — отложенные задачи (SubmitAfter, повторы SubmitRetry) и их
+	// обработчики отмены; отменяются при остановке пула
+	timersMu     sync.Mutex
+	timers       map[Timer]func()
+	timersClosed bool
+
+	clock Clock // время для отложенных задач и TTL (WithClock)
+
+	aging AgingConfig // старение приоритетов (WithPriorityAging)
+
+	hooksMu    sync.RWMutex
+	errorHooks []func(err error)
+	panicHooks []func(recovered interface{}, stack []byte)
+	middleware []func(next func() error) func() error
+
+	// ошибки и паники задач, собираемые во время StopWaitErr
+	drainMu   sync.Mutex
+	draining  bool
+	drainErrs []error
+
+	waitGroup sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	stopped chan struct{} // закрывается, когда после остановки вышли все воркеры (WaitStopped)
+}
+
+// defaultQueueSize — ёмкость очереди задач по умолчанию
+const defaultQueueSize = 100
+
+// DefaultMaxWorkers — верхняя граница числа воркеров по умолчанию
+// (см. WithMaxWorkers): защищает от опечатки в конфигурации, которая
+// запустила бы миллионы горутин
+const DefaultMaxWorkers = 4096
+
+// Ошибки пула; сравнивайте их через errors.Is
+var (
+	// ErrPoolStopped — пул остановлен и больше не принимает задачи
+	ErrPoolStopped = errors.New("worker pool is stopped")
+	// ErrQueueFull — в очереди нет места для задачи
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrNilTask — вместо задачи передан nil
+	ErrNilTask = errors.New("worker pool task is nil")
+	// ErrReentrantDeadlock — SubmitWait вызван из задачи того же пула при
+	// заполненной очереди: ожидание места заблокировало бы воркер навсегда
+	ErrReentrantDeadlock = errors.New("worker pool SubmitWait from its own task would deadlock")
+	// ErrTaskCancelled — задача отброшена из очереди через CancelAll,
+	// так и не начавшись
+	ErrTaskCancelled = errors.New("worker pool task was cancelled before it started")
+)
+
+// PanicError — ошибка задачи, завершившейся паникой: хранит восстановленное
+// значение и стек в момент паники
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+var errInvalidWorkerCount = errors.New("worker pool size must be positive")
+
+var errNegativeTimeout = errors.New("worker pool task timeout must not be negative")
+
+var errQueueCapTooSmall = errors.New("worker pool queue capacity is smaller than its length")
+
+// NewWorkerPool — создаёт пул воркеров с очередью ёмкостью defaultQueueSize.
+// numberOfWorkers <= 0 заменяется на 1, а больше DefaultMaxWorkers (или
+// границы WithMaxWorkers) — урезается до неё с предупреждением в логе.
+func NewWorkerPool(numberOfWorkers int, opts ...Option) *WorkerPool {
+	return NewWorkerPoolWithQueue(numberOfWorkers, defaultQueueSize, opts...)
+}
+
+// NewWorkerPoolWithQueue — создаёт пул воркеров с очередью заданной ёмкости.
+// queueSize == 0 — небуферизованная очередь: задача принимается, только если
+// есть свободный воркер; queueSize < 0 — ёмкость по умолчанию. Опция
+// WithQueueSize имеет приоритет над queueSize.
+func NewWorkerPoolWithQueue(numberOfWorkers, queueSize int, opts ...Option) *WorkerPool {
+	if numberOfWorkers <= 0 {
+		numberOfWorkers = 1
+	}
+	if queueSize < 0 {
+		queueSize = defaultQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wp := &WorkerPool{
+		logger:     defaultLogger(),
+		clock:      realClock{},
+		maxWorkers: DefaultMaxWorkers,
+		queueSize:  queueSize,
+		ctx:        ctx,
+		cancel:     cancel,
+		stopped:    make(chan struct{}),
+	}
+	wp.idleCond = sync.NewCond(&wp.idleMu)
+	// остановка пула будит WaitN, которому не дождаться задач
+	context.AfterFunc(ctx, func() {
+		wp.idleMu.Lock()
+		wp.idleCond.Broadcast()
+		wp.idleMu.Unlock()
+	})
+	for _, opt := range opts {
+		opt(wp)
+	}
+	numberOfWorkers = wp.clampWorkers(numberOfWorkers)
+
+	newStore := func() itemStore { return &fifoStore{} }
+	if wp.priority {
+		newStore = func() itemStore { return &priorityStore{} }
+		if wp.aging.Rate > 0 {
+			newStore = func() itemStore { return newAgingStore(wp.aging, wp.clock) }
+		}
+	}
+	store := newStore()
+	if len(wp.namedQueues) > 0 {
+		store = newFairStore(wp.namedQueues, newStore)
+	}
+	wp.queue = newTaskQueue(wp.queueSize, store, wp.spawnWorker)
+	wp.queue.idleTimeout = wp.idleTimeout
+	wp.queue.minLive = wp.minWorkers
+
+	wp.workers.Store(int64(numberOfWorkers))
+	for spawn := wp.queue.resize(numberOfWorkers); spawn > 0; spawn-- {
+		wp.spawnWorker()
+	}
+	if wp.watchdog != nil {
+		go wp.watchStuck()
+	}
+
+	return wp
+}
+
+// clampWorkers — урезать запрошенное число воркеров до maxWorkers,
+// предупредив в логе
+func (wp *WorkerPool) clampWorkers(n int) int {
+	if n > wp.maxWorkers {
+		wp.logger.Printf("worker pool: %d workers requested, clamped to %d", n, wp.maxWorkers)
+		return wp.maxWorkers
+	}
+	return n
+}
+
+// spawnWorker — запустить ещё одного воркера
+func (wp *WorkerPool) spawnWorker() {
+	wp.waitGroup.Add(1)
+	go wp.worker(int(wp.workerSeq.Add(1)))
+}
+
+// worker — воркер, выполняющий задачи; id — его номер для Stats().WorkerPanics
+func (wp *WorkerPool) worker(id int) {
+	defer wp.waitGroup.Done()
+	defer wp.leaveWorker(wp.enterWorker())
+
+	local, ok := wp.initWorker()
+	if ok {
+		defer wp.teardownWorker(local)
+	}
+
+	for {
+		it, ok := wp.next()
+		if !ok {
+			return
+		}
+		start := time.Now()
+		if wp.watchdog != nil {
+			wp.watchdog.begin(id, it, wp.clock.Now())
+		}
+		panicked := func() (panicked bool) {
+			if wp.slots != nil {
+				defer func() { <-wp.slots }()
+			}
+			wp.active.Add(1)
+			defer wp.active.Add(-1)
+			defer func() {
+				if r := recover(); r != nil {
+					panicked = true
+					if _, ok := r.(taskPanicked); !ok {
+						wp.handlePanic(r, debug.Stack())
+					}
+				}
+			}()
+			if wp.strictFIFO {
+				// следующую задачу можно забрать, только когда эта
+				// уже запускается
+				wp.startMu.Unlock()
+			}
+			if it.runLocal != nil {
+				it.runLocal(local)
+			} else {
+				it.run()
+			}
+			return false
+		}()
+		if wp.watchdog != nil {
+			wp.watchdog.end(id)
+		}
+		wp.latencies.observe(time.Since(start))
+		if panicked {
+			wp.stats.workerPanic(id)
+		}
+		wp.taskFinished()
+		if panicked {
+			if wp.panicPolicy == PanicRestartWorker {
+				// новый воркер занимает место этого в очереди, поэтому
+				// размер пула не меняется
+				wp.spawnWorker()
+				return
+			}
+		}
+	}
+}
+
+// next — забрать следующую задачу, дождаться разрешения лимитера и свободного
+// места WithMaxConcurrent (его освобождает воркер после задачи).
+// С WithStrictFIFO весь путь от очереди до запуска проходит один воркер
+// за раз: next возвращает задачу с захваченным startMu, а worker снимает
+// его перед самым запуском, поэтому задачи начинаются в порядке выдачи.
+func (wp *WorkerPool) next() (*queueItem, bool) {
+	if wp.strictFIFO {
+		wp.startMu.Lock()
+	}
+	for {
+		it, ok := wp.queue.pop()
+		if !ok {
+			if wp.strictFIFO {
+				wp.startMu.Unlock()
+			}
+			return nil, false
+		}
+		if it.expired(wp.clock) {
+			// задача устарела, пока ждала в очереди
+			wp.stats.expired.Add(1)
+			wp.dropItem(it, context.DeadlineExceeded)
+			continue
+		}
+		if wp.limiter != nil && wp.limiter.Wait(wp.ctx) != nil {
+			// пул остановлен через Stop: задача не начата и отбрасывается
+			wp.dropItem(it, ErrPoolStopped)
+			continue
+		}
+		if wp.slots != nil {
+			select {
+			case wp.slots <- struct{}{}:
+			case <-wp.ctx.Done():
+				wp.dropItem(it, ErrPoolStopped)
+				continue
+			}
+		}
+		return it, true
+	}
+}
+
+// Submit — добавить задачу в пул
+func (wp *WorkerPool) Submit(task func() error) error {
+    if task == nil {
+        return ErrNilTask
+    }
+
+    return wp.enqueue(&queueItem{run: wp.wrap(task)})
+}
+
+// SubmitPriority — добавить задачу с приоритетом: задачи с большим приоритетом
+// выполняются раньше, при равном — в порядке поступления. Приоритет учитывается
+// только в пуле, созданном с WithPriorityQueue; иначе задача встаёт в общую очередь.
+func (wp *WorkerPool) SubmitPriority(priority int, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueue(&queueItem{run: wp.wrap(task), priority: priority})
+}
+
+// SubmitBatch — добавить пачку задач: ставится столько задач, сколько
+// помещается в очередь, по порядку. accepted — число принятых задач с начала
+// среза (nil-задачи пропускаются и считаются принятыми); если приняты не все,
+// возвращается ошибка переполнения очереди.
+func (wp *WorkerPool) SubmitBatch(tasks []func() error) (accepted int, err error) {
+	return wp.submitBatch(tasks, false)
+}
+
+// SubmitBatchAtomic — добавить пачку задач целиком: либо в очередь помещаются
+// все задачи, либо ни одна
+func (wp *WorkerPool) SubmitBatchAtomic(tasks []func() error) error {
+	_, err := wp.submitBatch(tasks, true)
+	return err
+}
+
+func (wp *WorkerPool) submitBatch(tasks []func() error, all bool) (int, error) {
+	items := make([]*queueItem, 0, len(tasks))
+	for _, task := range tasks {
+		if task != nil {
+			items = append(items, &queueItem{run: wp.wrap(task)})
+		}
+	}
+
+	wp.addPending(len(items))
+	pushed, err := wp.queue.tryPushBatch(items, all)
+	wp.addPending(pushed - len(items))
+	wp.stats.submitted.Add(int64(pushed))
+	if err == nil {
+		return len(tasks), nil
+	}
+
+	// число задач с начала среза, которые приняты или пропущены как nil
+	accepted := 0
+	for _, task := range tasks {
+		if task != nil {
+			if pushed == 0 {
+				break
+			}
+			pushed--
+		}
+		accepted++
+	}
+	return accepted, err
+}
+
+// SubmitBlocking — добавить задачу, дождавшись свободного места в очереди
+func (wp *WorkerPool) SubmitBlocking(task func() error) error {
+	return wp.SubmitBlockingContext(context.Background(), task)
+}
+
+// SubmitBlockingContext — добавить задачу, дождавшись свободного места в очереди.
+// Возвращает ctx.Err(), если контекст отменён раньше, чем место освободилось,
+// и ошибку остановки, если пул останавливается.
+func (wp *WorkerPool) SubmitBlockingContext(ctx context.Context, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueueWait(ctx, &queueItem{run: wp.wrap(task)})
+}
+
+// SubmitPriorityBlockingContext — добавить задачу с приоритетом, как
+// SubmitPriority, но дождавшись свободного места в очереди, как
+// SubmitBlockingContext
+func (wp *WorkerPool) SubmitPriorityBlockingContext(ctx context.Context, priority int, task func() error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+
+	return wp.enqueueWait(ctx, &queueItem{run: wp.wrap(task), priority: priority})
+}
+
+// wrap — обернуть fire-and-forget задачу цепочкой middleware; паники и ошибки
+// уходят в обработчики
+func (wp *WorkerPool) wrap(task func() error) func() {
+	task = wp.applyMiddleware(task)
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				wp.stats.panic()
+				wp.handlePanic(r, debug.Stack())
+				panic(taskPanicked{})
+			}
+		}()
+		err := task()
+		wp.stats.finish(err)
+		if err != nil {
+			wp.handleError(err)
+		}
+	}
+}
+
+// SubmitContext — добавить задачу, получающую контекст.
+// Если ctx уже отменён, задача не ставится в очередь и возвращается ctx.Err();
+// если ctx отменили, пока задача ждала в очереди, воркер её пропускает.
+// Контекст задачи отменяется как вместе с ctx, так и при остановке пула.
+func (wp *WorkerPool) SubmitContext(ctx context.Context, task func(ctx context.Context) error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wp.Submit(func() error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		taskCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(wp.ctx, cancel)
+		defer stop()
+		return task(taskCtx)
+	})
+}
+
+// SubmitWithTimeout — добавить задачу, контекст которой отменяется через d
+// после начала выполнения. Если срок истёк, в OnError попадает
+// context.DeadlineExceeded. Пул не может прервать задачу, игнорирующую
+// контекст: она занимает воркер до возврата, но ошибка всё равно отражает таймаут.
+// d == 0 — без таймаута (контекст отменяется только остановкой пула);
+// при d < 0 задача не принимается и возвращается ошибка.
+func (wp *WorkerPool) SubmitWithTimeout(d time.Duration, task func(ctx context.Context) error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if d < 0 {
+		return errNegativeTimeout
+	}
+
+	return wp.Submit(func() error { return wp.runWithTimeout(d, task) })
+}
+
+// SubmitWaitWithTimeout — как SubmitWithTimeout, но дожидается возврата задачи
+// и возвращает context.DeadlineExceeded, если срок истёк
+func (wp *WorkerPool) SubmitWaitWithTimeout(d time.Duration, task func(ctx context.Context) error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if d < 0 {
+		return errNegativeTimeout
+	}
+
+	return wp.SubmitWait(func() error { return wp.runWithTimeout(d, task) })
+}
+
+// runWithTimeout — выполнить задачу с контекстом, который отменяется через d
+// (d == 0 — без таймаута) или при остановке пула
+func (wp *WorkerPool) runWithTimeout(d time.Duration, task func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(wp.ctx)
+	if d > 0 {
+		ctx, cancel = context.WithTimeout(wp.ctx, d)
+	}
+	defer cancel()
+
+	err := task(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// SubmitWait — добавить задачу и дождаться её завершения.
+// Паника в задаче возвращается как *PanicError. Если пул остановлен до
+// запуска задачи (в том числе Stop, отбросивший очередь), возвращается
+// ErrPoolStopped, если задачу отбросил CancelAll — ErrTaskCancelled. Вызов
+// из задачи того же пула при заполненной очереди ждал бы места, которое может
+// освободить только сам вызывающий воркер, поэтому вместо ожидания
+// возвращается ErrReentrantDeadlock.
+func (wp *WorkerPool) SubmitWait(task func() error) error {
+    if task == nil {
+        return ErrNilTask
+    }
+
+    done, it := wp.resultItem(task)
+    err := wp.enqueue(it)
+    if errors.Is(err, ErrQueueFull) {
+        if wp.inWorker() {
+            return ErrReentrantDeadlock
+        }
+        err = wp.enqueueWait(context.Background(), it)
+    }
+    if err != nil {
+        return err
+    }
+    return <-done
+}
+
+// SubmitAsync — добавить задачу без ожидания и вернуть канал, в который
+// придёт её результат: ошибка задачи, *PanicError, ErrPoolStopped, если
+// задача отброшена остановкой пула, или ErrTaskCancelled после CancelAll.
+// В канале ровно одно значение, и он буферизован, поэтому его можно
+// не читать. Если задача не принята (например, очередь заполнена),
+// возвращается ошибка и nil-канал.
+func (wp *WorkerPool) SubmitAsync(task func() error) (<-chan error, error) {
+	if task == nil {
+		return nil, ErrNilTask
+	}
+
+	done, it := wp.resultItem(task)
+	if err := wp.enqueue(it); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// resultItem — задача, результат которой приходит в канал с буфером на одно
+// значение; отброшенная без запуска задача присылает причину отбрасывания
+func (wp *WorkerPool) resultItem(task func() error) (<-chan error, *queueItem) {
+	done := make(chan error, 1)
+	return done, &queueItem{
+		run:  wp.wrapResult(task, func(err error) { done <- err }),
+		drop: func(err error) { done <- err },
+	}
+}
+
+// SubmitWaitContext — добавить задачу, получающую контекст, и дождаться её
+// завершения, но не дольше, чем живёт ctx. Если ctx отменён раньше, возвращается
+// ctx.Err(), а задача может продолжить выполняться в фоне с отменённым
+// контекстом; её результат отбрасывается. Задача, которая к отмене ctx ещё
+// ждала в очереди, пропускается воркером.
+func (wp *WorkerPool) SubmitWaitContext(ctx context.Context, task func(ctx context.Context) error) error {
+	if task == nil {
+		return ErrNilTask
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// канал буферизован: задача не блокируется, если её результат уже не ждут
+	done, it := wp.resultItem(func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		taskCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(wp.ctx, cancel)
+		defer stop()
+		return task(taskCtx)
+	})
+	if err := wp.enqueueWait(ctx, it); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wrapResult — обернуть задачу так, чтобы её результат передавался в report;
+// паника передаётся как *PanicError
+func (wp *WorkerPool) wrapResult(task func() error, report func(err error)) func() {
+	task = wp.applyMiddleware(task)
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				stack := debug.Stack()
+				wp.stats.panic()
+				wp.handlePanic(r, stack)
+				report(&PanicError{Value: r, Stack: stack})
+				panic(taskPanicked{})
+			}
+		}()
+		err := task()
+		wp.stats.finish(err)
+		report(err)
+	}
+}
+
+// enqueue — поставить задачу в очередь; при заполненной очереди
+// поступить по политике WithOverflowPolicy
+func (wp *WorkerPool) enqueue(it *queueItem) error {
+	wp.addPending(1)
+	var evicted *queueItem
+	var err error
+	if wp.overflow == OverflowDropOldest {
+		evicted, err = wp.queue.tryPushEvict(it)
+	} else {
+		err = wp.queue.tryPush(it)
+	}
+	if err != nil {
+		wp.taskDone()
+		if errors.Is(err, ErrQueueFull) && wp.overflow == OverflowBlock {
+			if wp.inWorker() {
+				return ErrReentrantDeadlock
+			}
+			return wp.enqueueWait(context.Background(), it)
+		}
+		return err
+	}
+	wp.stats.submitted.Add(1)
+	if evicted != nil {
+		wp.stats.evicted.Add(1)
+		wp.dropItem(evicted, ErrQueueFull)
+	}
+	return nil
+}
+
+// enqueueWait — поставить задачу в очередь, дождавшись свободного места
+func (wp *WorkerPool) enqueueWait(ctx context.Context, it *queueItem) error {
+	wp.addPending(1)
+	if err := wp.queue.push(ctx, it); err != nil {
+		wp.taskDone()
+		return err
+	}
+	wp.stats.submitted.Add(1)
+	return nil
+}
+
+// addPending — учесть n задач, которые сейчас будут поставлены в очередь
+// (отрицательное n — снять учёт)
+func (wp *WorkerPool) addPending(n int) {
+	wp.idleMu.Lock()
+	wp.pending += n
+	if wp.pending == 0 {
+		wp.idleCond.Broadcast()
+	}
+	wp.idleMu.Unlock()
+}
+
+// taskFinished — отметить задачу, выполненную воркером: снять её с учёта
+// и разбудить WaitN
+func (wp *WorkerPool) taskFinished() {
+	wp.idleMu.Lock()
+	wp.finished++
+	wp.pending--
+	wp.idleCond.Broadcast()
+	wp.idleMu.Unlock()
+}
+
+// taskDone — отметить задачу завершённой (выполненной или выброшенной из очереди)
+func (wp *WorkerPool) taskDone() {
+	wp.addPending(-1)
+}
+
+// closeQueue — отменить отложенные задачи и ожидание бюджета, запретить приём
+// задач и дождаться завершения идущего Resize, чтобы он не запустил воркер
+// после начала остановки
+func (wp *WorkerPool) closeQueue(discard bool) {
+	wp.cancelTimers()
+	if wp.budget != nil {
+		wp.budget.close()
+	}
+	for _, it := range wp.queue.close(discard) {
+		wp.dropItem(it, ErrPoolStopped)
+	}
+	wp.resizeMu.Lock()
+	wp.resizeMu.Unlock()
+}
+
+// dropItem — снять с учёта задачу, отброшенную без запуска, и сообщить
+// отправителю причину err
+func (wp *WorkerPool) dropItem(it *queueItem, err error) {
+	if it.drop != nil {
+		it.drop(err)
+	}
+	wp.taskDone()
+}
+
+// Stop — выполнить только текущие задачи, отбросив очередь. Под одной
+// блокировкой очередь закрывается для новых задач, её содержимое
+// отбрасывается, а воркеры перестают забирать задачи, поэтому после начала
+// Stop не запускается ни одна задача из очереди, в том числе поставленная
+// таймером повтора. Задачи, которые воркер уже забрал, но ещё ждёт
+// WithRateLimit или WithMaxConcurrent, тоже отбрасываются; выполняющиеся
+// дорабатывают, и Stop возвращается после их завершения.
+// Повторные вызовы Stop и StopWait ничего не делают.
+func (wp *WorkerPool) Stop() {
+	wp.stopOnce.Do(func() {
+		wp.closeQueue(true)
+		wp.cancel()
+		wp.waitGroup.Wait()
+		close(wp.stopped)
+	})
+}
+
+// StopWait — дождаться выполнения всех задач в очереди.
+// Повторные вызовы Stop и StopWait ничего не делают.
+func (wp *WorkerPool) StopWait() {
+	_ = wp.StopWaitContext(context.Background())
+}
+
+// StopWaitErr — как StopWait, но возвращает ошибки и паники задач,
+// выполненных во время остановки, в порядке их появления: всё, что попало бы
+// в OnError и OnPanic. Ошибки SubmitWait возвращаются вызывающему и здесь
+// не учитываются. Паника возвращается как *PanicError.
+func (wp *WorkerPool) StopWaitErr() []error {
+	wp.drainMu.Lock()
+	wp.draining = true
+	wp.drainMu.Unlock()
+
+	wp.StopWait()
+
+	wp.drainMu.Lock()
+	defer wp.drainMu.Unlock()
+	errs := wp.drainErrs
+	wp.draining, wp.drainErrs = false, nil
+	return errs
+}
+
+// StopWaitContext — как StopWait, но ждёт не дольше, чем живёт ctx. Если ctx
+// отменён раньше, чем очередь опустела, оставшиеся в очереди задачи
+// отбрасываются, контекст пула отменяется и возвращается ctx.Err(); зависшие
+// задачи продолжают выполняться в своих воркерах. Повторные вызовы ничего
+// не делают и возвращают nil.
+func (wp *WorkerPool) StopWaitContext(ctx context.Context) error {
+	var err error
+	wp.stopOnce.Do(func() {
+		wp.closeQueue(false)
+
+		done := make(chan struct{})
+		go func() {
+			wp.waitGroup.Wait()
+			close(wp.stopped)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			for _, it := range wp.queue.close(true) {
+				wp.dropItem(it, ErrPoolStopped)
+			}
+			err = ctx.Err()
+		}
+		wp.cancel()
+	})
+	return err
+}
+
+// WaitStopped — дождаться, пока после Stop, StopWait или StopWaitContext
+// завершатся все горутины воркеров. StopWaitContext с истёкшим ctx
+// возвращается, не дожидаясь зависших задач, — WaitStopped дождётся и их.
+// До остановки пула WaitStopped блокируется.
+func (wp *WorkerPool) WaitStopped() {
+	<-wp.stopped
+}
+
+// WaitIdle — дождаться, пока очередь опустеет и все воркеры завершат
+// текущие задачи. В отличие от StopWait пул остаётся рабочим.
+func (wp *WorkerPool) WaitIdle() {
+	wp.idleMu.Lock()
+	for wp.pending > 0 {
+		wp.idleCond.Wait()
+	}
+	wp.idleMu.Unlock()
+}
+
+// Drain — как WaitIdle, но сообщает о ходе ожидания: onProgress вызывается
+// с числом ещё не завершённых задач (в очереди, выполняющихся и отложенных)
+// сразу и затем при каждом его изменении, последний раз — с нулём перед
+// возвратом. Без новых задач значения не возрастают, поэтому подходят для
+// индикатора прогресса. onProgress вызывается без внутренних блокировок
+// пула и может обращаться к нему; пока он выполняется, промежуточные
+// значения могут быть пропущены. nil — то же, что WaitIdle.
+func (wp *WorkerPool) Drain(onProgress func(remaining int)) {
+	wp.idleMu.Lock()
+	defer wp.idleMu.Unlock()
+
+	last := -1
+	for {
+		remaining := wp.pending
+		if remaining != last && onProgress != nil {
+			last = remaining
+			wp.idleMu.Unlock()
+			onProgress(remaining)
+			wp.idleMu.Lock()
+			continue
+		}
+		if remaining == 0 {
+			return
+		}
+		wp.idleCond.Wait()
+	}
+}
+
+// WaitN — дождаться, пока воркеры выполнят n задач, считая с момента вызова.
+// Учитываются любые задачи пула, завершившиеся успешно, с ошибкой или паникой;
+// отброшенные без запуска задачи не считаются. Повторы SubmitRetry считаются
+// отдельными задачами. Возвращает раньше, если пул остановлен.
+func (wp *WorkerPool) WaitN(n int) {
+	wp.idleMu.Lock()
+	defer wp.idleMu.Unlock()
+
+	target := wp.finished + uint64(max(n, 0))
+	for wp.finished < target && wp.ctx.Err() == nil {
+		wp.idleCond.Wait()
+	}
+}
+
+// CancelAll — отбросить все задачи, ждущие в очереди, не останавливая пул,
+// и вернуть их число: например, чтобы сбросить накопившийся затор. Задачи,
+// которые воркер уже забрал (в том числе ждущие WithRateLimit или
+// WithMaxConcurrent), выполняются; отложенные задачи и повторы SubmitRetry,
+// ещё не попавшие в очередь, не затрагиваются. Ожидающие результата
+// отброшенной задачи (SubmitWait, SubmitAsync, SubmitAll) получают
+// ErrTaskCancelled. Новые задачи принимаются как обычно.
+func (wp *WorkerPool) CancelAll() int {
+	dropped := wp.queue.clear()
+	for _, it := range dropped {
+		wp.dropItem(it, ErrTaskCancelled)
+	}
+	return len(dropped)
+}
+
+// Pause — приостановить выполнение задач: воркеры доделывают текущие задачи
+// и ждут Resume, не забирая задачи из очереди. Задачи продолжают приниматься
+// в очередь, пока в ней есть место. Остановка пула снимает паузу.
+func (wp *WorkerPool) Pause() {
+	wp.queue.setPaused(true)
+}
+
+// Resume — возобновить выполнение задач после Pause
+func (wp *WorkerPool) Resume() {
+	wp.queue.setPaused(false)
+}
+
+// Resize — изменить число воркеров. При увеличении запускаются новые воркеры,
+// при уменьшении лишние воркеры завершаются, доделав текущую задачу; задачи
+// в очереди не теряются. n больше границы WithMaxWorkers урезается до неё.
+func (wp *WorkerPool) Resize(n int) error {
+	if n <= 0 {
+		return errInvalidWorkerCount
+	}
+	n = wp.clampWorkers(n)
+
+	wp.resizeMu.Lock()
+	defer wp.resizeMu.Unlock()
+
+	if wp.queue.isClosed() {
+		return ErrPoolStopped
+	}
+
+	wp.workers.Store(int64(n))
+	for spawn := wp.queue.resize(n); spawn > 0; spawn-- {
+		wp.spawnWorker()
+	}
+	return nil
+}
+
+// WorkerCount — заданное число воркеров пула
+func (wp *WorkerPool) WorkerCount() int {
+	return int(wp.workers.Load())
+}
+
+// LiveWorkers — число запущенных воркеров. Может быть меньше WorkerCount,
+// если воркеры завершились по простою (WithIdleTimeout), и ненадолго больше —
+// сразу после уменьшения пула через Resize.
+func (wp *WorkerPool) LiveWorkers() int {
+	return int(wp.queue.live.Load())
+}
+
+// QueueLen — число задач, ожидающих в очереди
+func (wp *WorkerPool) QueueLen() int {
+	return wp.queue.len()
+}
+
+// QueueCap — ёмкость очереди задач
+func (wp *WorkerPool) QueueCap() int {
+	return wp.queue.cap()
+}
+
+// ResizeQueue — изменить ёмкость очереди на лету, например чтобы пережить
+// всплеск нагрузки. Задачи в очереди остаются на местах и сохраняют порядок;
+// при увеличении ожидающие места отправители (SubmitBlocking, OverflowBlock)
+// сразу получают его. Ёмкость меньше текущего числа задач в очереди
+// (в том числе отрицательная) отклоняется; после остановки пула
+// возвращается ErrPoolStopped.
+func (wp *WorkerPool) ResizeQueue(newCap int) error {
+	return wp.queue.setCap(newCap)
+}
+
+// AvailableSlots — сколько задач пул примет прямо сейчас без ожидания:
+// QueueCap() - QueueLen() плюс свободные воркеры, готовые сразу забрать
+// задачу. После остановки — 0.
+func (wp *WorkerPool) AvailableSlots() int {
+	return wp.queue.available()
+}
+
+// WaitForSlot — дождаться, пока в пуле появится место хотя бы для одной
+// задачи (воркер забрал задачу из очереди), не занимая его. Возвращает
+// ctx.Err() при отмене ctx и ErrPoolStopped после остановки пула. Место
+// не резервируется: между WaitForSlot и Submit его может занять другой
+// производитель.
+func (wp *WorkerPool) WaitForSlot(ctx context.Context) error {
+	return wp.queue.waitFree(ctx)
+}
+
+// ActiveWorkers — число воркеров, которые сейчас выполняют задачу
+func (wp *WorkerPool) ActiveWorkers() int {
+	return int(wp.active.Load())
+}
+
+// Done — канал, который закрывается при остановке пула: сразу в Stop,
+// после выполнения очереди в StopWait. Позволяет ждать остановки в select
+// вместо опроса IsRunning.
+func (wp *WorkerPool) Done() <-chan struct{} {
+	return wp.ctx.Done()
+}
+
+// IsRunning — проверка, есть ли ещё активные воркеры
+func (wp *WorkerPool) IsRunning() bool {
+	select {
+	case <-wp.ctx.Done():
+		return false
+	default:
+		return true
+	}
+}
@@ -1,189 +1,4602 @@
-package worker_pool
-
-import (
-	"errors"
-	"sync"
-	"testing"
-	"time"
-)
-
-func TestWorkerPoolQueueBehavior(t *testing.T) {
-	t.Run("все задачи должны выполниться", func(t *testing.T) {
-		wp := NewWorkerPool(3)
-		defer wp.StopWait()
-
-		taskCount := 50
-		completed := make([]bool, taskCount)
-		var mu sync.Mutex
-		var wg sync.WaitGroup
-
-		for i := 0; i < taskCount; i++ {
-			wg.Add(1)
-			taskID := i
-			_ = wp.Submit(func() error {
-				defer wg.Done()
-				time.Sleep(5 * time.Millisecond)
-				mu.Lock()
-				completed[taskID] = true
-				mu.Unlock()
-				return nil
-			})
-		}
-
-		wg.Wait()
-
-		for i, done := range completed {
-			if !done {
-				t.Errorf("Задача %d не выполнена", i)
-			}
-		}
-	})
-
-	t.Run("SubmitWait должен ждать завершения задачи и вернуть ошибку", func(t *testing.T) {
-		wp := NewWorkerPool(1)
-		defer wp.Stop()
-
-		start := time.Now()
-		err := wp.SubmitWait(func() error {
-			time.Sleep(100 * time.Millisecond)
-			return errors.New("boom")
-		})
-		duration := time.Since(start)
-
-		if duration < 90*time.Millisecond {
-			t.Errorf("SubmitWait завершился слишком быстро: %v", duration)
-		}
-		if err == nil || err.Error() != "boom" {
-			t.Errorf("ожидалась ошибка boom, получили: %v", err)
-		}
-	})
-
-	t.Run("порядок выполнения задач FIFO", func(t *testing.T) {
-		wp := NewWorkerPool(1) // один воркер -> последовательное выполнение
-		defer wp.StopWait()
-
-		var order []int
-		var mu sync.Mutex
-		var wg sync.WaitGroup
-
-		for i := 0; i < 10; i++ {
-			wg.Add(1)
-			taskID := i
-			_ = wp.Submit(func() error {
-				defer wg.Done()
-				mu.Lock()
-				order = append(order, taskID)
-				mu.Unlock()
-				return nil
-			})
-		}
-
-		wg.Wait()
-
-		for i := 0; i < len(order); i++ {
-			if order[i] != i {
-				t.Errorf("Ожидался порядок %d, а получен %d (весь порядок: %v)", i, order[i], order)
-				break
-			}
-		}
-	})
-
-	t.Run("StopWait должен дождаться всех задач в очереди", func(t *testing.T) {
-		wp := NewWorkerPool(2)
-
-		taskCount := 10
-		var completed int
-		var mu sync.Mutex
-
-		for i := 0; i < taskCount; i++ {
-			_ = wp.Submit(func() error {
-				time.Sleep(20 * time.Millisecond)
-				mu.Lock()
-				completed++
-				mu.Unlock()
-				return nil
-			})
-		}
-
-		wp.StopWait()
-
-		if completed != taskCount {
-			t.Errorf("Ожидалось %d задач, выполнено %d", taskCount, completed)
-		}
-	})
-
-	t.Run("Stop должен выполнить только текущие задачи и отбросить очередь", func(t *testing.T) {
-		wp := NewWorkerPool(1)
-
-		var completed int
-		var mu sync.Mutex
-
-		// первая задача гарантированно начнёт выполняться
-		_ = wp.Submit(func() error {
-			time.Sleep(100 * time.Millisecond)
-			mu.Lock()
-			completed++
-			mu.Unlock()
-			return nil
-		})
-
-		// эти задачи должны попасть в очередь
-		for i := 0; i < 5; i++ {
-			_ = wp.Submit(func() error {
-				mu.Lock()
-				completed++
-				mu.Unlock()
-				return nil
-			})
-		}
-
-		// подождём, чтобы первая задача начала выполняться
-		time.Sleep(10 * time.Millisecond)
-
-		wp.Stop() // должен выполнить только первую, остальные отбросить
-
-		if completed != 1 {
-			t.Errorf("Stop должен был выполнить только текущую задачу, а выполнено %d", completed)
-		}
-	})
-
-	t.Run("SubmitWait возвращает ошибку при панике задачи", func(t *testing.T) {
-		wp := NewWorkerPool(1)
-		defer wp.Stop()
-
-		err := wp.SubmitWait(func() error {
-			panic("panic inside task")
-		})
-		if err == nil {
-			t.Fatalf("ожидалась ошибка из-за паники")
-		}
-	})
-}
-
-func BenchmarkWorkerPool(b *testing.B) {
-	wp := NewWorkerPool(4)
-	defer wp.StopWait()
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
-			_ = wp.Submit(func() error {
-				time.Sleep(time.Microsecond)
-				return nil
-			})
-		}
-	})
-}
-
-func BenchmarkSubmitWait(b *testing.B) {
-	wp := NewWorkerPool(4)
-	defer wp.StopWait()
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = wp.SubmitWait(func() error {
-			time.Sleep(time.Microsecond)
-			return nil
-		})
-	}
-}
+package worker_pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolQueueBehavior(t *testing.T) {
+	t.Run("все задачи должны выполниться", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		taskCount := 50
+		completed := make([]bool, taskCount)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+
+		for i := 0; i < taskCount; i++ {
+			wg.Add(1)
+			taskID := i
+			_ = wp.Submit(func() error {
+				defer wg.Done()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				completed[taskID] = true
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		wg.Wait()
+
+		for i, done := range completed {
+			if !done {
+				t.Errorf("Задача %d не выполнена", i)
+			}
+		}
+	})
+
+	t.Run("SubmitWait должен ждать завершения задачи и вернуть ошибку", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.Stop()
+
+		start := time.Now()
+		err := wp.SubmitWait(func() error {
+			time.Sleep(100 * time.Millisecond)
+			return errors.New("boom")
+		})
+		duration := time.Since(start)
+
+		if duration < 90*time.Millisecond {
+			t.Errorf("SubmitWait завершился слишком быстро: %v", duration)
+		}
+		if err == nil || err.Error() != "boom" {
+			t.Errorf("ожидалась ошибка boom, получили: %v", err)
+		}
+	})
+
+	t.Run("порядок выполнения задач FIFO", func(t *testing.T) {
+		wp := NewWorkerPool(1) // один воркер -> последовательное выполнение
+		defer wp.StopWait()
+
+		var order []int
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			taskID := i
+			_ = wp.Submit(func() error {
+				defer wg.Done()
+				mu.Lock()
+				order = append(order, taskID)
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		wg.Wait()
+
+		for i := 0; i < len(order); i++ {
+			if order[i] != i {
+				t.Errorf("Ожидался порядок %d, а получен %d (весь порядок: %v)", i, order[i], order)
+				break
+			}
+		}
+	})
+
+	t.Run("StopWait должен дождаться всех задач в очереди", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+
+		taskCount := 10
+		var completed int
+		var mu sync.Mutex
+
+		for i := 0; i < taskCount; i++ {
+			_ = wp.Submit(func() error {
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				completed++
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		wp.StopWait()
+
+		if completed != taskCount {
+			t.Errorf("Ожидалось %d задач, выполнено %d", taskCount, completed)
+		}
+	})
+
+	t.Run("Stop должен выполнить только текущие задачи и отбросить очередь", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		var completed int
+		var mu sync.Mutex
+
+		// первая задача гарантированно начнёт выполняться
+		_ = wp.Submit(func() error {
+			time.Sleep(100 * time.Millisecond)
+			mu.Lock()
+			completed++
+			mu.Unlock()
+			return nil
+		})
+
+		// эти задачи должны попасть в очередь
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error {
+				mu.Lock()
+				completed++
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		// подождём, чтобы первая задача начала выполняться
+		time.Sleep(10 * time.Millisecond)
+
+		wp.Stop() // должен выполнить только первую, остальные отбросить
+
+		if completed != 1 {
+			t.Errorf("Stop должен был выполнить только текущую задачу, а выполнено %d", completed)
+		}
+	})
+
+	t.Run("SubmitWait возвращает ошибку при панике задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.Stop()
+
+		err := wp.SubmitWait(func() error {
+			panic("panic inside task")
+		})
+		if err == nil {
+			t.Fatalf("ожидалась ошибка из-за паники")
+		}
+	})
+}
+
+// blockWorkers — занимает n воркеров пула задачами, которые ждут закрытия release
+func blockWorkers(t *testing.T, wp *WorkerPool, n int) (release func()) {
+	t.Helper()
+
+	started := make(chan struct{}, n)
+	unblock := make(chan struct{})
+	for i := 0; i < n; i++ {
+		if err := wp.SubmitBlocking(func() error {
+			started <- struct{}{}
+			<-unblock
+			return nil
+		}); err != nil {
+			t.Fatalf("не удалось занять воркер: %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { close(unblock) }) }
+}
+
+func TestNewWorkerPoolWithQueue(t *testing.T) {
+	t.Run("очередь принимает ровно queueSize задач", func(t *testing.T) {
+		const workers, queueSize = 2, 5
+		wp := NewWorkerPoolWithQueue(workers, queueSize)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, workers)
+		defer release()
+
+		for i := 0; i < queueSize; i++ {
+			if err := wp.Submit(func() error { return nil }); err != nil {
+				t.Fatalf("задача %d не принята: %v", i, err)
+			}
+		}
+		if err := wp.Submit(func() error { return nil }); err != ErrQueueFull {
+			t.Errorf("ожидалась ошибка переполнения очереди, получили: %v", err)
+		}
+	})
+
+	t.Run("queueSize == 0 — небуферизованная очередь", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0)
+		defer wp.StopWait()
+
+		// задача принимается, как только воркер готов её забрать
+		unblock := make(chan struct{})
+		defer close(unblock)
+		started := make(chan struct{})
+		for wp.Submit(func() error {
+			close(started)
+			<-unblock
+			return nil
+		}) != nil {
+			time.Sleep(time.Millisecond)
+		}
+		<-started
+
+		if err := wp.Submit(func() error { return nil }); err != ErrQueueFull {
+			t.Errorf("ожидалась ошибка переполнения очереди, получили: %v", err)
+		}
+	})
+
+	t.Run("queueSize < 0 — ёмкость по умолчанию", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, -1)
+		defer wp.StopWait()
+
+		if got := wp.QueueCap(); got != defaultQueueSize {
+			t.Errorf("ожидалась ёмкость %d, получили %d", defaultQueueSize, got)
+		}
+	})
+}
+
+func TestWorkerPoolObservability(t *testing.T) {
+	t.Run("ActiveWorkers и QueueLen отражают загрузку пула", func(t *testing.T) {
+		const workers, pending = 3, 4
+		wp := NewWorkerPoolWithQueue(workers, 10)
+		defer wp.StopWait()
+
+		if got := wp.ActiveWorkers(); got != 0 {
+			t.Errorf("до отправки задач ожидалось 0 активных воркеров, получили %d", got)
+		}
+
+		release := blockWorkers(t, wp, workers)
+		for i := 0; i < pending; i++ {
+			_ = wp.Submit(func() error { return nil })
+		}
+
+		if got := wp.ActiveWorkers(); got != workers {
+			t.Errorf("ожидалось %d активных воркеров, получили %d", workers, got)
+		}
+		if got := wp.QueueLen(); got != pending {
+			t.Errorf("ожидалось %d задач в очереди, получили %d", pending, got)
+		}
+		if got := wp.QueueCap(); got != 10 {
+			t.Errorf("ожидалась ёмкость очереди 10, получили %d", got)
+		}
+
+		release()
+	})
+}
+
+func TestSubmitContext(t *testing.T) {
+	t.Run("задача с отменённым контекстом не выполняется", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var ran atomic.Bool
+		err := wp.SubmitContext(ctx, func(ctx context.Context) error {
+			ran.Store(true)
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ожидалась ошибка context.Canceled, получили: %v", err)
+		}
+
+		wp.StopWait()
+		if ran.Load() {
+			t.Error("тело задачи не должно было выполниться")
+		}
+	})
+
+	t.Run("задача, отменённая в очереди, пропускается воркером", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := blockWorkers(t, wp, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var ran atomic.Bool
+		if err := wp.SubmitContext(ctx, func(ctx context.Context) error {
+			ran.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatalf("задача не принята: %v", err)
+		}
+		cancel()
+		release()
+
+		wp.StopWait()
+		if ran.Load() {
+			t.Error("тело задачи не должно было выполниться")
+		}
+	})
+
+	t.Run("остановка пула отменяет контекст задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		started := make(chan struct{})
+		done := make(chan error, 1)
+		_ = wp.SubmitContext(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			done <- ctx.Err()
+			return nil
+		})
+		<-started
+
+		wp.Stop()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("ожидалась ошибка context.Canceled, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("контекст задачи не был отменён при остановке пула")
+		}
+	})
+}
+
+// captureLogger — логгер, сохраняющий все сообщения для проверки в тестах
+type captureLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *captureLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *captureLogger) count(substr string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, m := range l.msgs {
+		if strings.Contains(m, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWithLogger(t *testing.T) {
+	t.Run("паника задачи логируется ровно один раз", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger))
+
+		_ = wp.Submit(func() error {
+			panic("boom")
+		})
+		wp.StopWait()
+
+		if got := logger.count("boom"); got != 1 {
+			t.Errorf("ожидалась одна запись о панике, получили %d: %v", got, logger.msgs)
+		}
+	})
+
+	t.Run("nil-логгер отключает логирование", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+
+		_ = wp.Submit(func() error { panic("boom") })
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		wp.StopWait()
+	})
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("без опций — значения по умолчанию", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		if got := wp.WorkerCount(); got != 3 {
+			t.Errorf("WorkerCount() = %d, ожидалось 3", got)
+		}
+		if got := wp.QueueCap(); got != defaultQueueSize {
+			t.Errorf("QueueCap() = %d, ожидалось %d", got, defaultQueueSize)
+		}
+		if wp.maxWorkers != DefaultMaxWorkers {
+			t.Errorf("maxWorkers = %d, ожидалось %d", wp.maxWorkers, DefaultMaxWorkers)
+		}
+		if wp.panicPolicy != PanicRecover || wp.overflow != OverflowDropNewest {
+			t.Errorf("политики %v и %v, ожидались PanicRecover и OverflowDropNewest", wp.panicPolicy, wp.overflow)
+		}
+		if wp.priority || wp.strictFIFO || wp.limiter != nil || wp.budget != nil {
+			t.Error("без опций не должно быть приоритетов, строгого FIFO, лимита частоты и бюджета")
+		}
+		if _, ok := wp.clock.(realClock); !ok {
+			t.Errorf("часы %T, ожидались realClock", wp.clock)
+		}
+		if len(wp.errorHooks) != 0 || len(wp.panicHooks) != 0 {
+			t.Error("без опций не должно быть обработчиков")
+		}
+	})
+
+	t.Run("WithQueueSize", func(t *testing.T) {
+		cases := []struct {
+			name string
+			wp   *WorkerPool
+			want int
+		}{
+			{"задаёт ёмкость", NewWorkerPool(1, WithQueueSize(5)), 5},
+			{"ноль — небуферизованная очередь", NewWorkerPool(1, WithQueueSize(0)), 0},
+			{"отрицательная — по умолчанию", NewWorkerPool(1, WithQueueSize(-1)), defaultQueueSize},
+			{"важнее аргумента NewWorkerPoolWithQueue", NewWorkerPoolWithQueue(1, 10, WithQueueSize(3)), 3},
+		}
+		for _, tc := range cases {
+			if got := tc.wp.QueueCap(); got != tc.want {
+				t.Errorf("%s: QueueCap() = %d, ожидалось %d", tc.name, got, tc.want)
+			}
+			tc.wp.Stop()
+		}
+	})
+
+	t.Run("WithLogger и WithPanicPolicy", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithPanicPolicy(PanicCallback))
+		defer wp.StopWait()
+
+		if wp.logger != logger {
+			t.Errorf("логгер %T, ожидался переданный", wp.logger)
+		}
+		if wp.panicPolicy != PanicCallback {
+			t.Errorf("политика паник %v, ожидалась PanicCallback", wp.panicPolicy)
+		}
+	})
+
+	t.Run("WithOnError и WithOnPanic", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		panicCh := make(chan interface{}, 1)
+		wp := NewWorkerPool(1,
+			WithOnError(func(err error) { errCh <- err }),
+			WithOnPanic(func(recovered interface{}, _ []byte) { panicCh <- recovered }),
+		)
+
+		wantErr := errors.New("fail")
+		_ = wp.Submit(func() error { return wantErr })
+		_ = wp.Submit(func() error { panic("boom") })
+		wp.StopWait()
+
+		select {
+		case err := <-errCh:
+			if err != wantErr {
+				t.Errorf("OnError получил %v, ожидалось %v", err, wantErr)
+			}
+		default:
+			t.Error("обработчик WithOnError не вызван")
+		}
+		select {
+		case r := <-panicCh:
+			if r != "boom" {
+				t.Errorf("OnPanic получил %v, ожидалось boom", r)
+			}
+		default:
+			t.Error("обработчик WithOnPanic не вызван")
+		}
+	})
+}
+
+func TestHooks(t *testing.T) {
+	t.Run("OnError получает ошибку задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		wantErr := errors.New("fail")
+		got := make(chan error, 1)
+		wp.OnError(func(err error) { got <- err })
+
+		_ = wp.Submit(func() error { return wantErr })
+		wp.StopWait()
+
+		select {
+		case err := <-got:
+			if err != wantErr {
+				t.Errorf("ожидалась ошибка %v, получили %v", wantErr, err)
+			}
+		default:
+			t.Fatal("OnError не был вызван")
+		}
+	})
+
+	t.Run("OnPanic получает значение паники и стек", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		type panicValue struct{ code int }
+		var gotValue interface{}
+		var gotStack []byte
+		wp.OnPanic(func(recovered interface{}, stack []byte) {
+			gotValue, gotStack = recovered, stack
+		})
+
+		_ = wp.Submit(func() error { panic(panicValue{code: 42}) })
+		wp.StopWait()
+
+		if gotValue != (panicValue{code: 42}) {
+			t.Errorf("ожидалось значение паники %v, получили %v", panicValue{code: 42}, gotValue)
+		}
+		if len(gotStack) == 0 {
+			t.Error("ожидался непустой стек")
+		}
+	})
+
+	t.Run("паника в обработчике не роняет воркер", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		wp.OnError(func(err error) { panic("hook panic") })
+
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		err := wp.SubmitWait(func() error { return nil })
+		wp.StopWait()
+
+		if err != nil {
+			t.Errorf("воркер должен продолжить работу, получили ошибку: %v", err)
+		}
+	})
+}
+
+func TestWaitIdle(t *testing.T) {
+	t.Run("WaitIdle дожидается пачки задач, пул остаётся рабочим", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		var completed atomic.Int64
+		submitBatch := func(n int) {
+			for i := 0; i < n; i++ {
+				if err := wp.Submit(func() error {
+					time.Sleep(5 * time.Millisecond)
+					completed.Add(1)
+					return nil
+				}); err != nil {
+					t.Fatalf("задача не принята: %v", err)
+				}
+			}
+		}
+
+		submitBatch(20)
+		wp.WaitIdle()
+		if got := completed.Load(); got != 20 {
+			t.Fatalf("после первой пачки ожидалось 20 задач, выполнено %d", got)
+		}
+
+		submitBatch(10)
+		wp.WaitIdle()
+		if got := completed.Load(); got != 30 {
+			t.Errorf("после второй пачки ожидалось 30 задач, выполнено %d", got)
+		}
+		if wp.ActiveWorkers() != 0 || wp.QueueLen() != 0 {
+			t.Errorf("пул должен простаивать: active=%d queue=%d", wp.ActiveWorkers(), wp.QueueLen())
+		}
+	})
+
+	t.Run("WaitIdle на пустом пуле возвращается сразу", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		wp.WaitIdle()
+	})
+}
+
+func TestResize(t *testing.T) {
+	t.Run("увеличение пула под нагрузкой ускоряет обработку", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		runBatch := func() time.Duration {
+			start := time.Now()
+			for i := 0; i < 10; i++ {
+				_ = wp.Submit(func() error {
+					time.Sleep(20 * time.Millisecond)
+					return nil
+				})
+			}
+			wp.WaitIdle()
+			return time.Since(start)
+		}
+
+		slow := runBatch()
+		if err := wp.Resize(5); err != nil {
+			t.Fatalf("Resize вернул ошибку: %v", err)
+		}
+		if got := wp.WorkerCount(); got != 5 {
+			t.Errorf("ожидалось 5 воркеров, получили %d", got)
+		}
+		fast := runBatch()
+
+		if fast >= slow/2 {
+			t.Errorf("после увеличения пула обработка должна ускориться: до %v, после %v", slow, fast)
+		}
+	})
+
+	t.Run("уменьшение пула не теряет задачи из очереди", func(t *testing.T) {
+		wp := NewWorkerPool(4)
+		defer wp.StopWait()
+
+		var completed atomic.Int64
+		for i := 0; i < 20; i++ {
+			_ = wp.Submit(func() error {
+				time.Sleep(5 * time.Millisecond)
+				completed.Add(1)
+				return nil
+			})
+		}
+
+		if err := wp.Resize(2); err != nil {
+			t.Fatalf("Resize вернул ошибку: %v", err)
+		}
+		if got := wp.WorkerCount(); got != 2 {
+			t.Errorf("ожидалось 2 воркера, получили %d", got)
+		}
+
+		wp.WaitIdle()
+		if got := completed.Load(); got != 20 {
+			t.Errorf("ожидалось 20 выполненных задач, получили %d", got)
+		}
+	})
+
+	t.Run("Resize отклоняет неположительный размер", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		if err := wp.Resize(0); err == nil {
+			t.Error("ожидалась ошибка для n = 0")
+		}
+		if got := wp.WorkerCount(); got != 2 {
+			t.Errorf("размер пула не должен измениться, получили %d", got)
+		}
+	})
+}
+
+func TestSubmitBlocking(t *testing.T) {
+	t.Run("SubmitBlocking ждёт, пока воркер освободит место", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+		if err := wp.Submit(func() error { return nil }); err != nil {
+			t.Fatalf("задача не принята: %v", err)
+		}
+
+		var ran atomic.Bool
+		result := make(chan error, 1)
+		go func() {
+			result <- wp.SubmitBlocking(func() error {
+				ran.Store(true)
+				return nil
+			})
+		}()
+
+		select {
+		case err := <-result:
+			t.Fatalf("SubmitBlocking не должен вернуться при полной очереди, получили: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release()
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Fatalf("ожидалось nil, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitBlocking не разблокировался после освобождения места")
+		}
+
+		wp.WaitIdle()
+		if !ran.Load() {
+			t.Error("задача должна была выполниться")
+		}
+	})
+
+	t.Run("SubmitBlockingContext прерывается по контексту", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0)
+		defer wp.Stop()
+
+		release := blockWorkers(t, wp, 1)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+
+		err := wp.SubmitBlockingContext(ctx, func() error { return nil })
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась ошибка context.DeadlineExceeded, получили: %v", err)
+		}
+	})
+
+	t.Run("SubmitBlocking возвращает ошибку при остановке пула", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0)
+		release := blockWorkers(t, wp, 1)
+
+		result := make(chan error, 1)
+		go func() {
+			result <- wp.SubmitBlocking(func() error { return nil })
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			release()
+		}()
+		wp.StopWait()
+
+		select {
+		case err := <-result:
+			if err != ErrPoolStopped {
+				t.Errorf("ожидалась ошибка остановки пула, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitBlocking завис после остановки пула")
+		}
+	})
+
+	t.Run("SubmitPriorityBlockingContext ждёт места в очереди", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1, WithPriorityQueue())
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+		var mu sync.Mutex
+		var order []int
+		record := func(p int) func() error {
+			return func() error {
+				mu.Lock()
+				order = append(order, p)
+				mu.Unlock()
+				return nil
+			}
+		}
+		if err := wp.SubmitPriority(1, record(1)); err != nil {
+			t.Fatalf("задача не принята: %v", err)
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			result <- wp.SubmitPriorityBlockingContext(context.Background(), 5, record(5))
+		}()
+		select {
+		case err := <-result:
+			t.Fatalf("SubmitPriorityBlockingContext не должен вернуться при полной очереди, получили: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release()
+		if err := <-result; err != nil {
+			t.Fatalf("ожидалось nil, получили: %v", err)
+		}
+		wp.WaitIdle()
+		mu.Lock()
+		defer mu.Unlock()
+		if len(order) != 2 {
+			t.Fatalf("выполнено %v, ожидались обе задачи", order)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		release = blockWorkers(t, wp, 1)
+		defer release()
+		_ = wp.Submit(func() error { return nil })
+		if err := wp.SubmitPriorityBlockingContext(ctx, 5, record(5)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась ошибка context.DeadlineExceeded, получили: %v", err)
+		}
+	})
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Run("повторный Stop безопасен", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.Stop()
+		wp.Stop()
+	})
+
+	t.Run("Stop после StopWait безопасен", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.StopWait()
+		wp.Stop()
+		wp.StopWait()
+
+		if wp.IsRunning() {
+			t.Error("после StopWait пул не должен считаться работающим")
+		}
+	})
+
+	t.Run("Submit после StopWait возвращает ErrPoolStopped", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.StopWait()
+
+		if err := wp.Submit(func() error { return nil }); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+		if err := wp.SubmitWait(func() error { return nil }); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped от SubmitWait, получили: %v", err)
+		}
+	})
+
+	t.Run("Submit после Stop возвращает ErrPoolStopped", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.Stop()
+
+		if err := wp.Submit(func() error { return nil }); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+		if err := wp.Resize(4); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped от Resize, получили: %v", err)
+		}
+	})
+}
+
+func TestSubmitWithTimeout(t *testing.T) {
+	t.Run("задача, не уложившаяся в срок, возвращает DeadlineExceeded", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		err := wp.SubmitWaitWithTimeout(20*time.Millisecond, func(ctx context.Context) error {
+			time.Sleep(60 * time.Millisecond) // контекст игнорируется
+			return nil
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась ошибка context.DeadlineExceeded, получили: %v", err)
+		}
+	})
+
+	t.Run("кооперативная задача прерывается по сроку", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		start := time.Now()
+		err := wp.SubmitWaitWithTimeout(20*time.Millisecond, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась ошибка context.DeadlineExceeded, получили: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("задача должна была прерваться по сроку, прошло %v", elapsed)
+		}
+	})
+
+	t.Run("нулевой таймаут — без ограничения", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		err := wp.SubmitWaitWithTimeout(0, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(30 * time.Millisecond):
+				return nil
+			}
+		})
+		if err != nil {
+			t.Errorf("задача должна была выполниться до конца, получили: %v", err)
+		}
+	})
+
+	t.Run("отрицательный таймаут отклоняется сразу", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		var ran atomic.Bool
+		task := func(ctx context.Context) error { ran.Store(true); return nil }
+		if err := wp.SubmitWaitWithTimeout(-time.Second, task); err != errNegativeTimeout {
+			t.Errorf("SubmitWaitWithTimeout: ожидалась errNegativeTimeout, получили: %v", err)
+		}
+		if err := wp.SubmitWithTimeout(-1, task); err != errNegativeTimeout {
+			t.Errorf("SubmitWithTimeout: ожидалась errNegativeTimeout, получили: %v", err)
+		}
+		wp.WaitIdle()
+		if ran.Load() {
+			t.Error("задача с отрицательным таймаутом не должна выполняться")
+		}
+		if n := wp.Stats().Submitted; n != 0 {
+			t.Errorf("Submitted = %d, ожидалось 0", n)
+		}
+	})
+
+	t.Run("SubmitWithTimeout передаёт таймаут в OnError", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		got := make(chan error, 1)
+		wp.OnError(func(err error) { got <- err })
+
+		_ = wp.SubmitWithTimeout(10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+		wp.StopWait()
+
+		select {
+		case err := <-got:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("ожидалась ошибка context.DeadlineExceeded, получили: %v", err)
+			}
+		default:
+			t.Fatal("OnError не был вызван")
+		}
+	})
+}
+
+func TestSubmitPriority(t *testing.T) {
+	t.Run("задача с высоким приоритетом обгоняет ожидающие", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithPriorityQueue())
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+
+		var order []int
+		var mu sync.Mutex
+		record := func(id int) func() error {
+			return func() error {
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+				return nil
+			}
+		}
+
+		for i := 1; i <= 3; i++ {
+			_ = wp.SubmitPriority(0, record(i))
+		}
+		_ = wp.SubmitPriority(10, record(100))
+
+		release()
+		wp.WaitIdle()
+
+		want := []int{100, 1, 2, 3}
+		if fmt.Sprint(order) != fmt.Sprint(want) {
+			t.Errorf("ожидался порядок %v, получили %v", want, order)
+		}
+	})
+
+	t.Run("без WithPriorityQueue сохраняется FIFO", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+
+		var order []int
+		var mu sync.Mutex
+		for i, priority := range []int{0, 10, 5} {
+			id := i
+			_ = wp.SubmitPriority(priority, func() error {
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		release()
+		wp.WaitIdle()
+
+		want := []int{0, 1, 2}
+		if fmt.Sprint(order) != fmt.Sprint(want) {
+			t.Errorf("ожидался порядок %v, получили %v", want, order)
+		}
+	})
+}
+
+func TestSubmitBatch(t *testing.T) {
+	t.Run("пачка больше очереди принимается частично", func(t *testing.T) {
+		const queueSize = 5
+		wp := NewWorkerPoolWithQueue(1, queueSize)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+
+		var completed atomic.Int64
+		tasks := make([]func() error, 8)
+		for i := range tasks {
+			tasks[i] = func() error {
+				completed.Add(1)
+				return nil
+			}
+		}
+
+		accepted, err := wp.SubmitBatch(tasks)
+		if accepted != queueSize {
+			t.Errorf("ожидалось %d принятых задач, получили %d", queueSize, accepted)
+		}
+		if err != ErrQueueFull {
+			t.Errorf("ожидалась ошибка переполнения очереди, получили: %v", err)
+		}
+
+		release()
+		wp.WaitIdle()
+		if got := completed.Load(); got != queueSize {
+			t.Errorf("ожидалось %d выполненных задач, получили %d", queueSize, got)
+		}
+	})
+
+	t.Run("SubmitBatchAtomic не ставит ничего, если пачка не помещается", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 3)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+		defer release()
+
+		_ = wp.Submit(func() error { return nil })
+
+		tasks := []func() error{
+			func() error { return nil },
+			func() error { return nil },
+			func() error { return nil },
+		}
+		if err := wp.SubmitBatchAtomic(tasks); err != ErrQueueFull {
+			t.Errorf("ожидалась ошибка переполнения очереди, получили: %v", err)
+		}
+		if got := wp.QueueLen(); got != 1 {
+			t.Errorf("очередь не должна измениться, в ней %d задач", got)
+		}
+		if err := wp.SubmitBatchAtomic(tasks[:2]); err != nil {
+			t.Errorf("пачка из двух задач должна поместиться, получили: %v", err)
+		}
+	})
+}
+
+func TestSubmitAll(t *testing.T) {
+	t.Run("Wait возвращает ошибки задач по индексам", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		tasks := make([]func() error, 10)
+		for i := range tasks {
+			id := i
+			tasks[i] = func() error {
+				if id%2 == 1 {
+					return fmt.Errorf("task %d failed", id)
+				}
+				return nil
+			}
+		}
+
+		errs := wp.SubmitAll(tasks).Wait()
+		if len(errs) != len(tasks) {
+			t.Fatalf("ожидалось %d ошибок, получили %d", len(tasks), len(errs))
+		}
+		for i, err := range errs {
+			if i%2 == 0 && err != nil {
+				t.Errorf("задача %d должна была завершиться успешно, получили: %v", i, err)
+			}
+			if i%2 == 1 && (err == nil || err.Error() != fmt.Sprintf("task %d failed", i)) {
+				t.Errorf("задача %d: ожидалась её ошибка, получили: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("паника задачи становится ошибкой", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		errs := wp.SubmitAll([]func() error{
+			func() error { return nil },
+			func() error { panic("boom") },
+		}).Wait()
+
+		if errs[0] != nil || errs[1] == nil {
+			t.Errorf("ожидалась ошибка только у второй задачи, получили: %v", errs)
+		}
+	})
+
+	t.Run("пачка больше очереди выполняется целиком", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(2, 2)
+		defer wp.StopWait()
+
+		var completed atomic.Int64
+		tasks := make([]func() error, 20)
+		for i := range tasks {
+			tasks[i] = func() error {
+				completed.Add(1)
+				return nil
+			}
+		}
+
+		wp.SubmitAll(tasks).Wait()
+		if got := completed.Load(); got != 20 {
+			t.Errorf("ожидалось 20 выполненных задач, получили %d", got)
+		}
+	})
+}
+
+func TestSubmitRetry(t *testing.T) {
+	opts := RetryOptions{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: true}
+
+	t.Run("задача, упавшая дважды, выполняется три раза", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		var errs atomic.Int64
+		wp.OnError(func(error) { errs.Add(1) })
+
+		var attempts atomic.Int64
+		err := wp.SubmitRetry(func() error {
+			if attempts.Add(1) <= 2 {
+				return errors.New("temporary")
+			}
+			return nil
+		}, opts)
+		if err != nil {
+			t.Fatalf("SubmitRetry вернул ошибку: %v", err)
+		}
+
+		wp.WaitIdle()
+		if got := attempts.Load(); got != 3 {
+			t.Errorf("ожидалось 3 попытки, получили %d", got)
+		}
+		if got := errs.Load(); got != 0 {
+			t.Errorf("успешный повтор не должен попадать в OnError, вызовов: %d", got)
+		}
+	})
+
+	t.Run("постоянно падающая задача выполняется MaxRetries+1 раз", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		final := errors.New("permanent")
+		var reported []error
+		var mu sync.Mutex
+		wp.OnError(func(err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		})
+
+		var attempts atomic.Int64
+		_ = wp.SubmitRetry(func() error {
+			attempts.Add(1)
+			return final
+		}, opts)
+
+		wp.WaitIdle()
+		if got := attempts.Load(); got != int64(opts.MaxRetries+1) {
+			t.Errorf("ожидалось %d попыток, получили %d", opts.MaxRetries+1, got)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(reported) != 1 || !errors.Is(reported[0], final) {
+			t.Errorf("в OnError ожидалась одна итоговая ошибка, получили: %v", reported)
+		}
+	})
+
+	t.Run("задержка растёт экспоненциально до MaxDelay", func(t *testing.T) {
+		o := RetryOptions{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+		want := []time.Duration{10, 20, 40, 50, 50}
+		for i, w := range want {
+			if got := o.backoff(i + 1); got != w*time.Millisecond {
+				t.Errorf("попытка %d: ожидалась задержка %v, получили %v", i+1, w*time.Millisecond, got)
+			}
+		}
+	})
+
+	t.Run("RetryableFunc отделяет постоянные ошибки от временных", func(t *testing.T) {
+		errPermanent := errors.New("validation failed")
+		errTransient := errors.New("network timeout")
+		o := opts
+		o.RetryableFunc = func(err error) bool { return !errors.Is(err, errPermanent) }
+
+		cases := []struct {
+			name string
+			err  error
+			want int64
+		}{
+			{"постоянная выполняется один раз", errPermanent, 1},
+			{"временная повторяется", errTransient, int64(opts.MaxRetries + 1)},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				wp := NewWorkerPool(2)
+				defer wp.StopWait()
+
+				var reported []error
+				var mu sync.Mutex
+				wp.OnError(func(err error) {
+					mu.Lock()
+					reported = append(reported, err)
+					mu.Unlock()
+				})
+
+				var attempts atomic.Int64
+				_ = wp.SubmitRetry(func() error {
+					attempts.Add(1)
+					return tc.err
+				}, o)
+
+				wp.WaitIdle()
+				if got := attempts.Load(); got != tc.want {
+					t.Errorf("ожидалось %d попыток, получили %d", tc.want, got)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if len(reported) != 1 || !errors.Is(reported[0], tc.err) {
+					t.Errorf("в OnError ожидалась одна итоговая ошибка, получили: %v", reported)
+				}
+			})
+		}
+	})
+}
+
+func TestWithRateLimit(t *testing.T) {
+	t.Run("запуск задач ограничен частотой", func(t *testing.T) {
+		wp := NewWorkerPool(4, WithRateLimit(2, 1))
+		defer wp.StopWait()
+
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			if err := wp.Submit(func() error { return nil }); err != nil {
+				t.Fatalf("Submit вернул ошибку: %v", err)
+			}
+		}
+		wp.WaitIdle()
+
+		// первая задача стартует сразу, остальные девять — раз в 500 мс
+		if elapsed := time.Since(start); elapsed < 4400*time.Millisecond {
+			t.Errorf("10 задач при 2 rps выполнились за %v, ожидалось не меньше ~4.5с", elapsed)
+		}
+	})
+
+	t.Run("Stop не ждёт лимитер", func(t *testing.T) {
+		wp := NewWorkerPool(2, WithRateLimit(1, 1))
+
+		var ran atomic.Int64
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error {
+				ran.Add(1)
+				return nil
+			})
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Stop заблокирован ожиданием лимитера")
+		}
+		if got := ran.Load(); got >= 5 {
+			t.Errorf("ожидалось, что часть задач будет отброшена, выполнено %d", got)
+		}
+	})
+}
+
+func TestSubmitAfter(t *testing.T) {
+	t.Run("задача не запускается раньше задержки", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		start := time.Now()
+		ranAt := make(chan time.Duration, 1)
+		if err := wp.SubmitAfter(100*time.Millisecond, func() error {
+			ranAt <- time.Since(start)
+			return nil
+		}); err != nil {
+			t.Fatalf("SubmitAfter вернул ошибку: %v", err)
+		}
+
+		wp.WaitIdle()
+		select {
+		case elapsed := <-ranAt:
+			if elapsed < 100*time.Millisecond {
+				t.Errorf("задача запустилась через %v, раньше задержки 100мс", elapsed)
+			}
+		default:
+			t.Fatal("WaitIdle вернулся до выполнения отложенной задачи")
+		}
+	})
+
+	t.Run("SubmitAt запускает задачу в заданный момент", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		at := time.Now().Add(50 * time.Millisecond)
+		var ranAt time.Time
+		_ = wp.SubmitAt(at, func() error {
+			ranAt = time.Now()
+			return nil
+		})
+		wp.WaitIdle()
+		if ranAt.Before(at) {
+			t.Errorf("задача запустилась в %v, раньше %v", ranAt, at)
+		}
+	})
+
+	t.Run("остановка пула отменяет ожидающие задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		var ran atomic.Bool
+		_ = wp.SubmitAfter(50*time.Millisecond, func() error {
+			ran.Store(true)
+			return nil
+		})
+		wp.StopWait()
+		wp.WaitIdle()
+
+		time.Sleep(100 * time.Millisecond)
+		if ran.Load() {
+			t.Error("отложенная задача выполнилась после остановки пула")
+		}
+		if err := wp.SubmitAfter(time.Millisecond, func() error { return nil }); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped после остановки, получили: %v", err)
+		}
+	})
+}
+
+func TestSubmitEvery(t *testing.T) {
+	t.Run("после cancel задача больше не выполняется", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		var runs atomic.Int64
+		cancel := wp.SubmitEvery(50*time.Millisecond, func() error {
+			runs.Add(1)
+			return nil
+		})
+
+		deadline := time.Now().Add(2 * time.Second)
+		for runs.Load() < 3 {
+			if time.Now().After(deadline) {
+				t.Fatalf("за 2с задача выполнилась только %d раз", runs.Load())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		cancel()
+		wp.WaitIdle()
+
+		after := runs.Load()
+		time.Sleep(200 * time.Millisecond)
+		if got := runs.Load(); got != after {
+			t.Errorf("после cancel задача выполнилась ещё %d раз", got-after)
+		}
+	})
+
+	t.Run("запуски не перекрываются", func(t *testing.T) {
+		wp := NewWorkerPool(4)
+		defer wp.StopWait()
+
+		var running, overlaps, runs atomic.Int64
+		cancel := wp.SubmitEvery(10*time.Millisecond, func() error {
+			if running.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			time.Sleep(50 * time.Millisecond)
+			running.Add(-1)
+			runs.Add(1)
+			return nil
+		})
+		time.Sleep(300 * time.Millisecond)
+		cancel()
+		wp.WaitIdle()
+
+		if overlaps.Load() != 0 {
+			t.Errorf("обнаружено %d перекрывающихся запусков", overlaps.Load())
+		}
+		if runs.Load() == 0 {
+			t.Error("задача ни разу не выполнилась")
+		}
+	})
+
+	t.Run("отброшенный из очереди тик не останавливает запуски", func(t *testing.T) {
+		clock := NewMockClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		wp := NewWorkerPool(1, WithClock(clock))
+		defer wp.StopWait()
+
+		var runs atomic.Int64
+		wp.Pause()
+		cancel := wp.SubmitEvery(time.Minute, func() error {
+			runs.Add(1)
+			return nil
+		})
+		defer cancel()
+
+		tick := func() {
+			t.Helper()
+			for clock.Pending() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			clock.Advance(time.Minute)
+			deadline := time.Now().Add(time.Second)
+			for wp.QueueLen() == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("очередной тик не попал в очередь")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		tick()
+		if n := wp.CancelAll(); n != 1 {
+			t.Fatalf("CancelAll отбросил %d задач, ожидалась 1", n)
+		}
+		tick()
+		wp.Resume()
+		wp.WaitIdle()
+		if got := runs.Load(); got != 1 {
+			t.Errorf("ожидался 1 запуск после CancelAll, получили %d", got)
+		}
+	})
+
+	t.Run("остановка пула прекращает запуски", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		var runs atomic.Int64
+		defer wp.SubmitEvery(10*time.Millisecond, func() error {
+			runs.Add(1)
+			return nil
+		})()
+
+		time.Sleep(50 * time.Millisecond)
+		wp.Stop()
+		after := runs.Load()
+		time.Sleep(50 * time.Millisecond)
+		if got := runs.Load(); got != after {
+			t.Errorf("после Stop задача выполнилась ещё %d раз", got-after)
+		}
+	})
+}
+
+func TestUse(t *testing.T) {
+	t.Run("middleware выполняются снаружи внутрь, ошибка проходит по цепочке", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		var mu sync.Mutex
+		var order []string
+		record := func(s string) {
+			mu.Lock()
+			order = append(order, s)
+			mu.Unlock()
+		}
+		var seen []error
+		for _, name := range []string{"outer", "inner"} {
+			wp.Use(func(next func() error) func() error {
+				return func() error {
+					record(name + " before")
+					err := next()
+					record(name + " after")
+					mu.Lock()
+					seen = append(seen, err)
+					mu.Unlock()
+					return err
+				}
+			})
+		}
+
+		want := errors.New("task failed")
+		err := wp.SubmitWait(func() error {
+			record("task")
+			return want
+		})
+		if !errors.Is(err, want) {
+			t.Errorf("ожидалась ошибка задачи, получили: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		got := strings.Join(order, ", ")
+		if exp := "outer before, inner before, task, inner after, outer after"; got != exp {
+			t.Errorf("порядок выполнения %q, ожидался %q", got, exp)
+		}
+		if len(seen) != 2 || !errors.Is(seen[0], want) || !errors.Is(seen[1], want) {
+			t.Errorf("каждое middleware должно увидеть ошибку задачи, получили: %v", seen)
+		}
+	})
+
+	t.Run("паника в middleware перехватывается", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		var panics atomic.Int64
+		wp.OnPanic(func(interface{}, []byte) { panics.Add(1) })
+		wp.Use(func(next func() error) func() error {
+			return func() error { panic("middleware") }
+		})
+
+		_ = wp.Submit(func() error { return nil })
+		wp.WaitIdle()
+		if got := panics.Load(); got != 1 {
+			t.Errorf("ожидалась одна паника в OnPanic, получили %d", got)
+		}
+		if err := wp.SubmitWait(func() error { return nil }); err == nil {
+			t.Error("SubmitWait должен вернуть ошибку при панике в middleware")
+		}
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	waitLive := func(t *testing.T, wp *WorkerPool, want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for wp.LiveWorkers() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("ожидалось %d запущенных воркеров, получили %d", want, wp.LiveWorkers())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("простаивающие воркеры завершаются до минимума", func(t *testing.T) {
+		wp := NewWorkerPool(4, WithIdleTimeout(30*time.Millisecond), WithMinWorkers(1))
+		defer wp.StopWait()
+
+		if got := wp.LiveWorkers(); got != 4 {
+			t.Fatalf("сразу после создания ожидалось 4 воркера, получили %d", got)
+		}
+		waitLive(t, wp, 1)
+		time.Sleep(100 * time.Millisecond)
+		if got := wp.LiveWorkers(); got != 1 {
+			t.Errorf("пул не должен сжиматься ниже минимума, получили %d", got)
+		}
+		if got := wp.WorkerCount(); got != 4 {
+			t.Errorf("заданный размер пула не должен меняться, получили %d", got)
+		}
+	})
+
+	t.Run("воркеры запускаются заново при поступлении задач", func(t *testing.T) {
+		wp := NewWorkerPool(3, WithIdleTimeout(20*time.Millisecond))
+		defer wp.StopWait()
+		waitLive(t, wp, 0)
+
+		release := blockWorkers(t, wp, 3)
+		if got := wp.LiveWorkers(); got != 3 {
+			t.Errorf("ожидалось 3 запущенных воркера под нагрузкой, получили %d", got)
+		}
+		release()
+		waitLive(t, wp, 0)
+	})
+
+	t.Run("небуферизованная очередь принимает задачу без запущенных воркеров", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0, WithIdleTimeout(10*time.Millisecond))
+		defer wp.StopWait()
+		waitLive(t, wp, 0)
+
+		if err := wp.SubmitWait(func() error { return nil }); err != nil {
+			t.Errorf("задача не выполнена: %v", err)
+		}
+		if err := wp.Submit(func() error { return nil }); err != nil {
+			t.Errorf("Submit вернул ошибку: %v", err)
+		}
+	})
+}
+
+func TestNewAutoScalingPool(t *testing.T) {
+	waitWorkers := func(t *testing.T, wp *WorkerPool, want int) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for wp.WorkerCount() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("ожидалось %d воркеров, получили %d", want, wp.WorkerCount())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	wp := NewAutoScalingPool(1, 4, ScaleConfig{Interval: 10 * time.Millisecond, HighWater: 2, Samples: 2})
+	defer wp.StopWait()
+
+	if got := wp.WorkerCount(); got != 1 {
+		t.Fatalf("ожидался 1 воркер при старте, получили %d", got)
+	}
+
+	release := make(chan struct{})
+	for i := 0; i < 50; i++ {
+		if err := wp.Submit(func() error {
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatalf("Submit вернул ошибку: %v", err)
+		}
+	}
+	waitWorkers(t, wp, 4)
+
+	time.Sleep(50 * time.Millisecond)
+	if got := wp.WorkerCount(); got > 4 {
+		t.Errorf("пул вырос выше максимума: %d", got)
+	}
+
+	close(release)
+	wp.WaitIdle()
+	waitWorkers(t, wp, 1)
+}
+
+func TestStopWaitContext(t *testing.T) {
+	t.Run("возвращает ошибку дедлайна, не дожидаясь зависшей задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		release := blockWorkers(t, wp, 1)
+		var queuedRan atomic.Bool
+		_ = wp.Submit(func() error {
+			queuedRan.Store(true)
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := wp.StopWaitContext(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась context.DeadlineExceeded, получили: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("StopWaitContext вернулся через %v", elapsed)
+		}
+		if wp.IsRunning() {
+			t.Error("пул должен быть остановлен")
+		}
+		if err := wp.Submit(func() error { return nil }); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+
+		release()
+		time.Sleep(20 * time.Millisecond)
+		if queuedRan.Load() {
+			t.Error("задачи из очереди должны быть отброшены по дедлайну")
+		}
+	})
+
+	t.Run("дожидается очереди, если успевает", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+
+		var completed atomic.Int64
+		for i := 0; i < 10; i++ {
+			_ = wp.Submit(func() error {
+				time.Sleep(5 * time.Millisecond)
+				completed.Add(1)
+				return nil
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := wp.StopWaitContext(ctx); err != nil {
+			t.Errorf("ожидался nil, получили: %v", err)
+		}
+		if got := completed.Load(); got != 10 {
+			t.Errorf("ожидалось 10 выполненных задач, получили %d", got)
+		}
+		if err := wp.StopWaitContext(ctx); err != nil {
+			t.Errorf("повторный вызов должен вернуть nil, получили: %v", err)
+		}
+	})
+}
+
+func TestPauseResume(t *testing.T) {
+	t.Run("на паузе задачи копятся в очереди и выполняются после Resume", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		wp.Pause()
+		var completed atomic.Int64
+		for i := 0; i < 10; i++ {
+			if err := wp.Submit(func() error {
+				completed.Add(1)
+				return nil
+			}); err != nil {
+				t.Fatalf("Submit на паузе вернул ошибку: %v", err)
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if got := completed.Load(); got != 0 {
+			t.Errorf("на паузе выполнено %d задач", got)
+		}
+		if got := wp.QueueLen(); got != 10 {
+			t.Errorf("ожидалось 10 задач в очереди, получили %d", got)
+		}
+
+		wp.Resume()
+		wp.WaitIdle()
+		if got := completed.Load(); got != 10 {
+			t.Errorf("после Resume ожидалось 10 выполненных задач, получили %d", got)
+		}
+	})
+
+	t.Run("текущая задача доделывается на паузе", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+		wp.Pause()
+		var ran atomic.Bool
+		_ = wp.Submit(func() error {
+			ran.Store(true)
+			return nil
+		})
+		release()
+
+		time.Sleep(50 * time.Millisecond)
+		if got := wp.ActiveWorkers(); got != 0 {
+			t.Errorf("текущая задача должна завершиться, активных воркеров: %d", got)
+		}
+		if ran.Load() {
+			t.Error("новая задача не должна запускаться на паузе")
+		}
+		wp.Resume()
+	})
+
+	t.Run("StopWait на паузе дорабатывает очередь", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.Pause()
+
+		var completed atomic.Int64
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error {
+				completed.Add(1)
+				return nil
+			})
+		}
+		wp.StopWait()
+		if got := completed.Load(); got != 5 {
+			t.Errorf("ожидалось 5 выполненных задач, получили %d", got)
+		}
+	})
+}
+
+func TestStopWaitErr(t *testing.T) {
+	t.Run("возвращает ошибки и паники задач из очереди", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+
+		release := blockWorkers(t, wp, 1)
+		failure := errors.New("task failed")
+		_ = wp.Submit(func() error { panic("boom") })
+		_ = wp.Submit(func() error { return failure })
+		_ = wp.Submit(func() error { return nil })
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			release()
+		}()
+		errs := wp.StopWaitErr()
+
+		if len(errs) != 2 {
+			t.Fatalf("ожидалось 2 ошибки, получили %d: %v", len(errs), errs)
+		}
+		if !strings.Contains(errs[0].Error(), "boom") {
+			t.Errorf("первая ошибка должна описывать панику, получили: %v", errs[0])
+		}
+		if !errors.Is(errs[1], failure) {
+			t.Errorf("вторая ошибка должна быть ошибкой задачи, получили: %v", errs[1])
+		}
+	})
+
+	t.Run("без ошибок возвращает пустой список", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		_ = wp.Submit(func() error { return nil })
+		if errs := wp.StopWaitErr(); len(errs) != 0 {
+			t.Errorf("ожидался пустой список, получили: %v", errs)
+		}
+	})
+}
+
+func TestSubmitWeighted(t *testing.T) {
+	t.Run("задача сверх бюджета отклоняется, пока бюджет не освободится", func(t *testing.T) {
+		wp := NewWorkerPool(4, WithCostBudget(10, BudgetReject))
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			if err := wp.SubmitWeighted(4, func() error {
+				<-release
+				return nil
+			}); err != nil {
+				t.Fatalf("небольшая задача %d отклонена: %v", i, err)
+			}
+		}
+
+		third := func() error { return nil }
+		if err := wp.SubmitWeighted(5, third); err == nil {
+			t.Fatal("задача, не помещающаяся в остаток бюджета, должна быть отклонена")
+		}
+		if err := wp.Submit(third); err != nil {
+			t.Errorf("задача без стоимости не должна учитывать бюджет: %v", err)
+		}
+
+		close(release)
+		wp.WaitIdle()
+		if err := wp.SubmitWeighted(5, third); err != nil {
+			t.Errorf("после освобождения бюджета задача должна быть принята: %v", err)
+		}
+		if err := wp.SubmitWeighted(11, third); err == nil {
+			t.Error("задача дороже всего бюджета должна отклоняться")
+		}
+	})
+
+	t.Run("BudgetBlock ждёт освобождения бюджета", func(t *testing.T) {
+		wp := NewWorkerPool(2, WithCostBudget(10, BudgetBlock))
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		_ = wp.SubmitWeighted(8, func() error {
+			<-release
+			return nil
+		})
+
+		result := make(chan error, 1)
+		go func() { result <- wp.SubmitWeighted(5, func() error { return nil }) }()
+		select {
+		case err := <-result:
+			t.Fatalf("SubmitWeighted должен ждать бюджет, вернул: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Errorf("ожидалась успешная постановка, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitWeighted не дождался освобождения бюджета")
+		}
+	})
+
+	t.Run("остановка пула прерывает ожидание бюджета", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithCostBudget(1, BudgetBlock))
+		release := make(chan struct{})
+		_ = wp.SubmitWeighted(1, func() error {
+			<-release
+			return nil
+		})
+
+		result := make(chan error, 1)
+		go func() { result <- wp.SubmitWeighted(1, func() error { return nil }) }()
+		time.Sleep(20 * time.Millisecond)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+		wp.StopWait()
+
+		if err := <-result; !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+	})
+}
+
+func TestPanicError(t *testing.T) {
+	type panicValue struct{ code int }
+
+	t.Run("SubmitWait возвращает PanicError со значением и стеком", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		err := wp.SubmitWait(func() error { panic(panicValue{code: 42}) })
+
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("ожидалась *PanicError, получили %T: %v", err, err)
+		}
+		if v, ok := pe.Value.(panicValue); !ok || v.code != 42 {
+			t.Errorf("ожидалось значение паники {42}, получили %#v", pe.Value)
+		}
+		if len(pe.Stack) == 0 {
+			t.Error("стек паники пуст")
+		}
+		if !strings.Contains(pe.Error(), "42") {
+			t.Errorf("текст ошибки должен содержать значение паники: %q", pe.Error())
+		}
+	})
+
+	t.Run("обычная ошибка задачи не становится PanicError", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		err := wp.SubmitWait(func() error { return errors.New("plain") })
+		var pe *PanicError
+		if err == nil || errors.As(err, &pe) {
+			t.Errorf("ожидалась обычная ошибка, получили %T: %v", err, err)
+		}
+	})
+}
+
+func TestDone(t *testing.T) {
+	t.Run("канал закрывается при Stop", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+
+		select {
+		case <-wp.Done():
+			t.Fatal("Done закрыт у работающего пула")
+		default:
+		}
+
+		go wp.Stop()
+		select {
+		case <-wp.Done():
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("Done не закрылся после Stop")
+		}
+	})
+
+	t.Run("StopWait закрывает канал после выполнения очереди", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		var completed atomic.Int64
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error {
+				time.Sleep(5 * time.Millisecond)
+				completed.Add(1)
+				return nil
+			})
+		}
+		go wp.StopWait()
+
+		<-wp.Done()
+		if got := completed.Load(); got != 5 {
+			t.Errorf("Done закрылся до выполнения очереди: выполнено %d из 5", got)
+		}
+	})
+}
+
+func TestWorkerInit(t *testing.T) {
+	t.Run("инициализатор вызывается один раз на воркер", func(t *testing.T) {
+		var inits, teardowns atomic.Int64
+		wp := NewWorkerPool(3,
+			WithWorkerInit(func() (interface{}, error) {
+				return int(inits.Add(1)), nil
+			}),
+			WithWorkerTeardown(func(interface{}) { teardowns.Add(1) }),
+		)
+
+		var mu sync.Mutex
+		seen := make(map[int]bool)
+		for i := 0; i < 50; i++ {
+			if err := wp.SubmitLocal(func(local interface{}) error {
+				mu.Lock()
+				seen[local.(int)] = true
+				mu.Unlock()
+				return nil
+			}); err != nil {
+				t.Fatalf("SubmitLocal вернул ошибку: %v", err)
+			}
+		}
+		wp.StopWait()
+
+		if got := inits.Load(); got != 3 {
+			t.Errorf("ожидалось 3 вызова инициализатора, получили %d", got)
+		}
+		if got := teardowns.Load(); got != 3 {
+			t.Errorf("ожидалось 3 вызова teardown, получили %d", got)
+		}
+		for id := range seen {
+			if id < 1 || id > 3 {
+				t.Errorf("задача получила неизвестный ресурс %d", id)
+			}
+		}
+	})
+
+	t.Run("ошибка инициализации уходит в OnError, задача получает nil", func(t *testing.T) {
+		var teardowns atomic.Int64
+		wp := NewWorkerPool(1,
+			WithLogger(nil),
+			WithWorkerInit(func() (interface{}, error) { return nil, errors.New("no db") }),
+			WithWorkerTeardown(func(interface{}) { teardowns.Add(1) }),
+		)
+
+		var local interface{} = "not called"
+		_ = wp.SubmitLocal(func(l interface{}) error {
+			local = l
+			return nil
+		})
+		wp.StopWait()
+
+		if local != nil {
+			t.Errorf("ожидался nil вместо ресурса, получили %v", local)
+		}
+		if got := teardowns.Load(); got != 0 {
+			t.Errorf("teardown не должен вызываться без ресурса, вызовов: %d", got)
+		}
+	})
+}
+
+func TestMap(t *testing.T) {
+	t.Run("результаты и ошибки выровнены по индексам", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		items := []int{1, 2, 3, 4, 5}
+		results, errs := Map(wp, items, func(n int) (int, error) {
+			if n == 3 {
+				return 0, fmt.Errorf("bad item %d", n)
+			}
+			return n * n, nil
+		})
+
+		if len(results) != len(items) || len(errs) != len(items) {
+			t.Fatalf("ожидалось по %d результатов и ошибок, получили %d и %d", len(items), len(results), len(errs))
+		}
+		for i, n := range items {
+			if n == 3 {
+				if errs[i] == nil || errs[i].Error() != "bad item 3" {
+					t.Errorf("элемент %d: ожидалась ошибка, получили %v", i, errs[i])
+				}
+				if results[i] != 0 {
+					t.Errorf("элемент %d: при ошибке ожидался нулевой результат, получили %d", i, results[i])
+				}
+				continue
+			}
+			if errs[i] != nil || results[i] != n*n {
+				t.Errorf("элемент %d: ожидалось %d без ошибки, получили %d, %v", i, n*n, results[i], errs[i])
+			}
+		}
+	})
+
+	t.Run("пустой срез", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		results, errs := Map(wp, []string{}, func(s string) (int, error) { return len(s), nil })
+		if len(results) != 0 || len(errs) != 0 {
+			t.Errorf("ожидались пустые срезы, получили %v и %v", results, errs)
+		}
+	})
+
+	t.Run("остановка пула возвращает готовые результаты", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{}, 10)
+
+		items := []int{0, 1, 2, 3, 4, 5, 6, 7}
+		type mapResult struct {
+			results []int
+			errs    []error
+		}
+		resCh := make(chan mapResult, 1)
+		go func() {
+			results, errs := Map(wp, items, func(n int) (int, error) {
+				if n < 2 {
+					return n + 100, nil
+				}
+				started <- struct{}{}
+				<-release
+				return n + 100, nil
+			})
+			resCh <- mapResult{results, errs}
+		}()
+
+		// оба воркера заняты долгими элементами, остальные ждут в очереди
+		for range 2 {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatal("долгие элементы не начались")
+			}
+		}
+		// Stop ждёт начатых задач, поэтому — в отдельной горутине
+		go wp.Stop()
+
+		var res mapResult
+		select {
+		case res = <-resCh:
+		case <-time.After(time.Second):
+			t.Fatal("Map завис после остановки пула")
+		}
+
+		for i, n := range items {
+			if n < 2 {
+				if res.errs[i] != nil || res.results[i] != n+100 {
+					t.Errorf("элемент %d: ожидалось %d без ошибки, получили %d, %v", i, n+100, res.results[i], res.errs[i])
+				}
+				continue
+			}
+			if !errors.Is(res.errs[i], ErrPoolStopped) || res.results[i] != 0 {
+				t.Errorf("элемент %d: ожидались ErrPoolStopped и нулевой результат, получили %d, %v", i, res.results[i], res.errs[i])
+			}
+		}
+	})
+}
+
+func TestSubmitWaitStopped(t *testing.T) {
+	t.Run("SubmitWait после Stop возвращается сразу", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.Stop()
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- wp.SubmitWait(func() error { return nil }) }()
+
+		select {
+		case err := <-errCh:
+			if err != ErrPoolStopped {
+				t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitWait завис на остановленном пуле")
+		}
+	})
+
+	t.Run("Stop отбрасывает задачу из очереди и будит SubmitWait", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- wp.SubmitWait(func() error { return nil }) }()
+		for wp.QueueLen() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case err := <-errCh:
+			if err != ErrPoolStopped {
+				t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitWait завис после Stop")
+		}
+		close(release)
+		<-stopped
+	})
+
+	t.Run("Stop будит SubmitWait в хвосте заполненной очереди", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 2)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- wp.SubmitWait(func() error { return nil }) }()
+		for wp.QueueLen() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case err := <-errCh:
+			if err != ErrPoolStopped {
+				t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitWait из хвоста очереди завис после Stop")
+		}
+		close(release)
+		<-stopped
+	})
+
+	t.Run("Stop будит SubmitWait, ждущий места в очереди", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- wp.SubmitWait(func() error { return nil }) }()
+		time.Sleep(20 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case err := <-errCh:
+			if err != ErrPoolStopped {
+				t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("SubmitWait, ждущий места, завис после Stop")
+		}
+		close(release)
+		<-stopped
+	})
+}
+
+func TestStats(t *testing.T) {
+	t.Run("счётчики успешных, упавших и запаниковавших задач", func(t *testing.T) {
+		wp := NewWorkerPool(3, WithLogger(nil))
+		defer wp.StopWait()
+
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error { return nil })
+		}
+		for i := 0; i < 3; i++ {
+			_ = wp.Submit(func() error { return errors.New("fail") })
+		}
+		for i := 0; i < 2; i++ {
+			_ = wp.Submit(func() error { panic("boom") })
+		}
+		_ = wp.SubmitWait(func() error { return errors.New("fail") })
+		wp.WaitIdle()
+
+		got := wp.Stats()
+		var workerPanics int64
+		for _, n := range got.WorkerPanics {
+			workerPanics += n
+		}
+		if workerPanics != 2 {
+			t.Errorf("ожидалось 2 паники по воркерам, получили %v", got.WorkerPanics)
+		}
+		got.WorkerPanics = nil
+		want := PoolStats{Submitted: 11, Completed: 5, Failed: 4, Panicked: 2}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ожидалось %+v, получили %+v", want, got)
+		}
+	})
+
+	t.Run("повторы SubmitRetry не считаются новыми задачами", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		var calls atomic.Int32
+		_ = wp.SubmitRetry(func() error {
+			if calls.Add(1) < 3 {
+				return errors.New("fail")
+			}
+			return nil
+		}, RetryOptions{MaxRetries: 5, BaseDelay: time.Millisecond})
+		wp.WaitIdle()
+
+		want := PoolStats{Submitted: 1, Completed: 1, Retried: 2}
+		if got := wp.Stats(); !reflect.DeepEqual(got, want) {
+			t.Errorf("ожидалось %+v, получили %+v", want, got)
+		}
+	})
+
+	t.Run("очередь и активные воркеры в снимке", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		s := wp.Stats()
+		close(release)
+		wp.StopWait()
+
+		if s.Queued != 1 || s.Active != 1 {
+			t.Errorf("ожидалось Queued=1 Active=1, получили %+v", s)
+		}
+	})
+}
+
+func TestStrictFIFO(t *testing.T) {
+	t.Run("задача начинается только после запуска предыдущей", func(t *testing.T) {
+		// первые строки задач могут выполниться в любом порядке: воркер
+		// уже запустил задачу, но ещё не дошёл до её кода. Поэтому запуск
+		// предыдущей задачи проверяется по сторожу, который воркер
+		// отмечает до запуска
+		wp := NewWorkerPool(4, WithStrictFIFO(), WithWatchdog(WatchdogConfig{StuckThreshold: time.Hour}))
+		defer wp.StopWait()
+
+		begun := func(label string) bool {
+			wp.watchdog.mu.Lock()
+			defer wp.watchdog.mu.Unlock()
+			for _, wt := range wp.watchdog.running {
+				if wt.task.Label == label {
+					return true
+				}
+			}
+			return false
+		}
+
+		const n = 40
+		var finished [n]atomic.Bool
+		var mu sync.Mutex
+		var early []int
+		var wg sync.WaitGroup
+
+		wp.Pause()
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			_ = wp.SubmitLabeled(strconv.Itoa(i), func() error {
+				defer wg.Done()
+				if i > 0 && !finished[i-1].Load() && !begun(strconv.Itoa(i-1)) {
+					mu.Lock()
+					early = append(early, i)
+					mu.Unlock()
+				}
+
+				// более ранние задачи работают дольше и завершаются позже
+				time.Sleep(time.Duration(4-i%4) * 2 * time.Millisecond)
+				finished[i].Store(true)
+				return nil
+			})
+		}
+		wp.Resume()
+		wg.Wait()
+
+		if len(early) > 0 {
+			t.Errorf("задачи начались раньше предыдущих: %v", early)
+		}
+	})
+}
+
+func TestSentinelErrors(t *testing.T) {
+	t.Run("переполненная очередь возвращает ErrQueueFull", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		err := wp.Submit(func() error { return nil })
+		close(release)
+		wp.StopWait()
+
+		if !errors.Is(err, ErrQueueFull) {
+			t.Errorf("ожидалась ErrQueueFull, получили: %v", err)
+		}
+	})
+
+	t.Run("nil вместо задачи возвращает ErrNilTask", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		if err := wp.Submit(nil); !errors.Is(err, ErrNilTask) {
+			t.Errorf("Submit: ожидалась ErrNilTask, получили: %v", err)
+		}
+		if err := wp.SubmitWait(nil); !errors.Is(err, ErrNilTask) {
+			t.Errorf("SubmitWait: ожидалась ErrNilTask, получили: %v", err)
+		}
+		if errs := wp.SubmitAll([]func() error{nil}).Wait(); !errors.Is(errs[0], ErrNilTask) {
+			t.Errorf("SubmitAll: ожидалась ErrNilTask, получили: %v", errs[0])
+		}
+	})
+
+	t.Run("остановленный пул возвращает ErrPoolStopped", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		wp.StopWait()
+
+		if err := wp.Submit(func() error { return nil }); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+	})
+}
+
+func TestPendingTags(t *testing.T) {
+	t.Run("очередь меченых задач в порядке поступления", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.SubmitTagged("busy", func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		for _, tag := range []string{"a", "b", "c"} {
+			_ = wp.SubmitTagged(tag, func() error { return nil })
+		}
+		_ = wp.Submit(func() error { return nil })
+
+		got := wp.PendingTags()
+		close(release)
+		wp.StopWait()
+
+		if want := []string{"a", "b", "c"}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ожидалось %v, получили %v", want, got)
+		}
+		if tags := wp.PendingTags(); len(tags) != 0 {
+			t.Errorf("после остановки очередь должна быть пуста, получили %v", tags)
+		}
+	})
+}
+
+func TestPanicPolicy(t *testing.T) {
+	t.Run("PanicRecover: воркер переживает панику и выполняет следующие задачи", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithPanicPolicy(PanicRecover))
+		defer wp.StopWait()
+
+		_ = wp.Submit(func() error { panic("boom") })
+		for i := 0; i < 3; i++ {
+			if err := wp.SubmitWait(func() error { return nil }); err != nil {
+				t.Fatalf("задача %d после паники: %v", i, err)
+			}
+		}
+		if got := logger.count("boom"); got != 1 {
+			t.Errorf("без обработчиков паника должна попасть в лог один раз, получили %d", got)
+		}
+	})
+
+	t.Run("PanicCallback: паника уходит в OnPanic без записи в лог", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithPanicPolicy(PanicCallback))
+		defer wp.StopWait()
+
+		panics := make(chan interface{}, 1)
+		wp.OnPanic(func(recovered interface{}, stack []byte) { panics <- recovered })
+
+		_ = wp.Submit(func() error { panic("boom") })
+		select {
+		case r := <-panics:
+			if r != "boom" {
+				t.Errorf("ожидалось значение boom, получили %v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("обработчик OnPanic не вызван")
+		}
+		if err := wp.SubmitWait(func() error { return nil }); err != nil {
+			t.Errorf("воркер должен продолжить работу, получили ошибку: %v", err)
+		}
+		if got := logger.count("boom"); got != 0 {
+			t.Errorf("при PanicCallback паника не должна попадать в лог, получили %d записей", got)
+		}
+	})
+}
+
+func TestSubmitWaitContext(t *testing.T) {
+	t.Run("отмена контекста прерывает ожидание медленной задачи", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		finished := make(chan struct{})
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- wp.SubmitWaitContext(ctx, func(taskCtx context.Context) error {
+				close(started)
+				defer close(finished)
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			})
+		}()
+
+		<-started
+		cancel()
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("ожидалась context.Canceled, получили: %v", err)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("SubmitWaitContext не вернулся сразу после отмены контекста")
+		}
+		<-finished
+	})
+
+	t.Run("возвращает ошибку задачи и передаёт ей контекст", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "v")
+		err := wp.SubmitWaitContext(ctx, func(taskCtx context.Context) error {
+			if taskCtx.Value(key{}) != "v" {
+				return errors.New("no value")
+			}
+			return errors.New("task error")
+		})
+		if err == nil || err.Error() != "task error" {
+			t.Errorf("ожидалась ошибка задачи, получили: %v", err)
+		}
+	})
+
+	t.Run("отменённый контекст не ставит задачу", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var ran atomic.Bool
+		err := wp.SubmitWaitContext(ctx, func(context.Context) error {
+			ran.Store(true)
+			return nil
+		})
+		wp.WaitIdle()
+		if !errors.Is(err, context.Canceled) || ran.Load() {
+			t.Errorf("ожидалась context.Canceled без запуска задачи, получили %v, запуск: %v", err, ran.Load())
+		}
+	})
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	t.Run("одновременно выполняется не больше n задач", func(t *testing.T) {
+		wp := NewWorkerPool(8, WithMaxConcurrent(2), WithLogger(nil))
+		defer wp.StopWait()
+
+		var running, peak atomic.Int32
+		for i := 0; i < 40; i++ {
+			_ = wp.Submit(func() error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				if i%10 == 0 {
+					panic("boom")
+				}
+				return nil
+			})
+		}
+		wp.WaitIdle()
+
+		if p := peak.Load(); p > 2 {
+			t.Errorf("одновременно выполнялось %d задач, ожидалось не больше 2", p)
+		}
+		if p := peak.Load(); p < 2 {
+			t.Errorf("ожидалось 2 параллельные задачи, получили %d", p)
+		}
+		if active := wp.ActiveWorkers(); active != 0 {
+			t.Errorf("после паник место не освободилось: активных воркеров %d", active)
+		}
+	})
+}
+
+func TestWaitN(t *testing.T) {
+	t.Run("возвращается только после выполнения n задач", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		var finished atomic.Int32
+		for i := 0; i < 5; i++ {
+			_ = wp.Submit(func() error {
+				<-release
+				finished.Add(1)
+				return nil
+			})
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wp.WaitN(5)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("WaitN вернулся до выполнения задач")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("WaitN не дождался выполнения задач")
+		}
+		if got := finished.Load(); got != 5 {
+			t.Errorf("ожидалось 5 выполненных задач, получили %d", got)
+		}
+	})
+
+	t.Run("остановка пула прерывает ожидание", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		done := make(chan struct{})
+		go func() {
+			wp.WaitN(1)
+			close(done)
+		}()
+		wp.Stop()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("WaitN завис на остановленном пуле")
+		}
+	})
+}
+
+func TestSubmitAsync(t *testing.T) {
+	t.Run("результаты двух задач приходят в свои каналы", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		first, err := wp.SubmitAsync(func() error {
+			time.Sleep(20 * time.Millisecond)
+			return errors.New("first")
+		})
+		if err != nil {
+			t.Fatalf("не удалось добавить первую задачу: %v", err)
+		}
+		second, err := wp.SubmitAsync(func() error { panic("second") })
+		if err != nil {
+			t.Fatalf("не удалось добавить вторую задачу: %v", err)
+		}
+
+		var gotFirst, gotSecond bool
+		for !gotFirst || !gotSecond {
+			select {
+			case err := <-first:
+				if err == nil || err.Error() != "first" {
+					t.Errorf("первая задача: ожидалась ошибка first, получили %v", err)
+				}
+				gotFirst = true
+			case err := <-second:
+				var pe *PanicError
+				if !errors.As(err, &pe) || pe.Value != "second" {
+					t.Errorf("вторая задача: ожидалась PanicError, получили %v", err)
+				}
+				gotSecond = true
+			case <-time.After(time.Second):
+				t.Fatal("не дождались результатов задач")
+			}
+		}
+	})
+
+	t.Run("переполненная очередь возвращает ошибку сразу", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		res, err := wp.SubmitAsync(func() error { return nil })
+		close(release)
+		wp.StopWait()
+
+		if !errors.Is(err, ErrQueueFull) || res != nil {
+			t.Errorf("ожидалась ErrQueueFull и nil-канал, получили %v, %v", err, res)
+		}
+	})
+}
+
+func TestPanicCount(t *testing.T) {
+	t.Run("паника в Submit учитывается отдельно от ошибок", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		_ = wp.Submit(func() error { return errors.New("fail") })
+		_ = wp.Submit(func() error { panic("boom") })
+		wp.WaitIdle()
+
+		if got := wp.PanicCount(); got != 1 {
+			t.Errorf("ожидалась 1 паника, получили %d", got)
+		}
+		if got := wp.Stats().Failed; got != 1 {
+			t.Errorf("паника не должна считаться ошибкой: Failed = %d", got)
+		}
+	})
+}
+
+func TestNamedQueues(t *testing.T) {
+	t.Run("задачи выбираются пропорционально весам 3:1", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 100, WithQueue("a", 3), WithQueue("b", 1))
+		defer wp.StopWait()
+
+		var mu sync.Mutex
+		var order []string
+		wp.Pause()
+		for i := 0; i < 40; i++ {
+			for _, q := range []string{"a", "b"} {
+				if err := wp.SubmitTo(q, func() error {
+					mu.Lock()
+					order = append(order, q)
+					mu.Unlock()
+					return nil
+				}); err != nil {
+					t.Fatalf("SubmitTo(%q): %v", q, err)
+				}
+			}
+		}
+		wp.Resume()
+		wp.WaitIdle()
+
+		// пока обе очереди не пусты, на каждые 4 задачи приходится 3 из "a"
+		counts := map[string]int{}
+		for _, q := range order[:40] {
+			counts[q]++
+		}
+		if counts["a"] < 28 || counts["a"] > 32 {
+			t.Errorf("ожидалось около 30 задач из a среди первых 40, получили %v (порядок: %v)", counts, order)
+		}
+		if len(order) != 80 {
+			t.Errorf("ожидалось 80 выполненных задач, получили %d", len(order))
+		}
+	})
+
+	t.Run("незарегистрированная очередь", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithQueue("a", 1))
+		defer wp.StopWait()
+
+		if err := wp.SubmitTo("x", func() error { return nil }); !errors.Is(err, ErrUnknownQueue) {
+			t.Errorf("ожидалась ErrUnknownQueue, получили: %v", err)
+		}
+		plain := NewWorkerPool(1)
+		defer plain.StopWait()
+		if err := plain.SubmitTo("a", func() error { return nil }); !errors.Is(err, ErrUnknownQueue) {
+			t.Errorf("без WithQueue ожидалась ErrUnknownQueue, получили: %v", err)
+		}
+	})
+
+	t.Run("PendingTags отражает порядок выдачи по весам", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithQueue("a", 2))
+		defer wp.StopWait()
+
+		wp.Pause()
+		for _, tag := range []string{"d1", "d2"} {
+			_ = wp.SubmitTagged(tag, func() error { return nil })
+		}
+		for _, tag := range []string{"a1", "a2", "a3", "a4"} {
+			_ = wp.enqueue(&queueItem{run: func() {}, tag: tag, queue: "a"})
+		}
+		got := wp.PendingTags()
+		wp.Resume()
+
+		if want := []string{"a1", "d1", "a2", "a3", "d2", "a4"}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ожидалось %v, получили %v", want, got)
+		}
+	})
+}
+
+func TestRestartWorkerOnPanic(t *testing.T) {
+	t.Run("воркер с паникой заменяется новым", func(t *testing.T) {
+		var inits atomic.Int32
+		wp := NewWorkerPool(1,
+			WithLogger(nil),
+			WithPanicPolicy(PanicRestartWorker),
+			WithWorkerInit(func() (interface{}, error) {
+				return inits.Add(1), nil
+			}),
+		)
+		defer wp.StopWait()
+
+		if err := wp.SubmitWait(func() error { panic("boom") }); err == nil {
+			t.Fatal("ожидалась ошибка паники")
+		}
+
+		var local atomic.Value
+		if err := wp.SubmitLocal(func(l interface{}) error {
+			local.Store(l)
+			return nil
+		}); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		wp.WaitIdle()
+
+		if got := local.Load(); got != int32(2) {
+			t.Errorf("следующую задачу должен выполнить новый воркер, ресурс %v", got)
+		}
+		if got := wp.WorkerCount(); got != 1 {
+			t.Errorf("ожидался 1 воркер, получили %d", got)
+		}
+		if got := wp.LiveWorkers(); got != 1 {
+			t.Errorf("ожидался 1 живой воркер, получили %d", got)
+		}
+		if got := wp.Stats().WorkerPanics; !reflect.DeepEqual(got, map[int]int64{1: 1}) {
+			t.Errorf("ожидалась 1 паника на воркере 1, получили %v", got)
+		}
+	})
+
+	t.Run("без политики воркер продолжает работу", func(t *testing.T) {
+		var inits atomic.Int32
+		wp := NewWorkerPool(1,
+			WithLogger(nil),
+			WithWorkerInit(func() (interface{}, error) {
+				return inits.Add(1), nil
+			}),
+		)
+		defer wp.StopWait()
+
+		for i := 0; i < 3; i++ {
+			_ = wp.Submit(func() error { panic("boom") })
+		}
+		wp.WaitIdle()
+
+		if got := inits.Load(); got != 1 {
+			t.Errorf("воркер не должен перезапускаться, инициализаций %d", got)
+		}
+		if got := wp.Stats().WorkerPanics; !reflect.DeepEqual(got, map[int]int64{1: 3}) {
+			t.Errorf("ожидалось 3 паники на воркере 1, получили %v", got)
+		}
+	})
+}
+
+func TestSubmitWithTTL(t *testing.T) {
+	t.Run("устаревшая задача отбрасывается", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		var ran atomic.Bool
+		if err := wp.SubmitWithTTL(10*time.Millisecond, func() error {
+			ran.Store(true)
+			return nil
+		}); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+		close(release)
+		wp.WaitIdle()
+
+		if ran.Load() {
+			t.Error("устаревшая задача не должна выполняться")
+		}
+		if s := wp.Stats(); s.Expired != 1 || s.Completed != 1 {
+			t.Errorf("ожидались Expired=1 и Completed=1, получили %+v", s)
+		}
+	})
+
+	t.Run("свежая задача выполняется", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		var ran atomic.Bool
+		_ = wp.SubmitWithTTL(time.Minute, func() error {
+			ran.Store(true)
+			return nil
+		})
+		wp.WaitIdle()
+
+		if !ran.Load() {
+			t.Error("задача должна выполниться")
+		}
+		if got := wp.Stats().Expired; got != 0 {
+			t.Errorf("ожидалось Expired=0, получили %d", got)
+		}
+	})
+
+	t.Run("nil-задача", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		defer wp.StopWait()
+
+		if err := wp.SubmitWithTTL(time.Second, nil); !errors.Is(err, ErrNilTask) {
+			t.Errorf("ожидалась ErrNilTask, получили %v", err)
+		}
+	})
+}
+
+func TestSubmitWaitReentrant(t *testing.T) {
+	t.Run("из задачи при заполненной очереди возвращается ErrReentrantDeadlock", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		defer wp.StopWait()
+
+		result := make(chan error, 1)
+		_ = wp.Submit(func() error {
+			if err := wp.Submit(func() error { return nil }); err != nil {
+				result <- fmt.Errorf("заполнение очереди: %w", err)
+				return nil
+			}
+			result <- wp.SubmitWait(func() error { return nil })
+			return nil
+		})
+
+		select {
+		case err := <-result:
+			if !errors.Is(err, ErrReentrantDeadlock) {
+				t.Errorf("ожидалась ErrReentrantDeadlock, получили %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("SubmitWait из задачи завис")
+		}
+	})
+
+	t.Run("из задачи при свободном месте задача выполняется", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(2, 1)
+		defer wp.StopWait()
+
+		result := make(chan error, 1)
+		_ = wp.Submit(func() error {
+			result <- wp.SubmitWait(func() error { return nil })
+			return nil
+		})
+
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Errorf("неожиданная ошибка: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("SubmitWait из задачи завис")
+		}
+	})
+
+	t.Run("вне пула SubmitWait ждёт места в очереди", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+		_ = wp.Submit(func() error { return nil })
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+		if err := wp.SubmitWait(func() error { return nil }); err != nil {
+			t.Errorf("неожиданная ошибка: %v", err)
+		}
+	})
+}
+
+func TestStructuredLogging(t *testing.T) {
+	t.Run("ошибка задачи пишется JSON-объектом", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithStructuredLogging())
+		_ = wp.Submit(func() error { return errors.New("boom") })
+		wp.StopWait()
+
+		if len(logger.msgs) != 1 {
+			t.Fatalf("ожидалась 1 запись, получили %q", logger.msgs)
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(logger.msgs[0]), &entry); err != nil {
+			t.Fatalf("запись не JSON: %v (%q)", err, logger.msgs[0])
+		}
+		if entry["event"] != "task_error" || entry["err"] != "boom" {
+			t.Errorf("неожиданные поля: %v", entry)
+		}
+		ts, _ := entry["ts"].(string)
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			t.Errorf("некорректное время %q: %v", ts, err)
+		}
+	})
+
+	t.Run("паника пишется со стеком", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithStructuredLogging())
+		_ = wp.Submit(func() error { panic("oops") })
+		wp.StopWait()
+
+		if len(logger.msgs) != 1 {
+			t.Fatalf("ожидалась 1 запись, получили %q", logger.msgs)
+		}
+		var entry logEntry
+		if err := json.Unmarshal([]byte(logger.msgs[0]), &entry); err != nil {
+			t.Fatalf("запись не JSON: %v (%q)", err, logger.msgs[0])
+		}
+		if entry.Event != "task_panic" || entry.Err != "oops" || entry.Stack == "" {
+			t.Errorf("неожиданная запись: %+v", entry)
+		}
+	})
+
+	t.Run("по умолчанию текст", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger))
+		_ = wp.Submit(func() error { return errors.New("boom") })
+		wp.StopWait()
+
+		if len(logger.msgs) != 1 || logger.msgs[0] != "task error: boom" {
+			t.Errorf("ожидалась текстовая запись, получили %q", logger.msgs)
+		}
+	})
+}
+
+func TestWaitForSlot(t *testing.T) {
+	t.Run("освобождается, когда воркер забирает задачу", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 1)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		var finished atomic.Bool
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			finished.Store(true)
+			return nil
+		})
+		<-started
+		if err := wp.Submit(func() error { return nil }); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if got := wp.AvailableSlots(); got != 0 {
+			t.Fatalf("ожидалось 0 свободных мест, получили %d", got)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- wp.WaitForSlot(context.Background()) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("WaitForSlot вернулся при заполненной очереди: %v", err)
+		case <-time.After(30 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("неожиданная ошибка: %v", err)
+			}
+			if !finished.Load() {
+				t.Error("WaitForSlot вернулся раньше завершения задачи")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("WaitForSlot не вернулся после освобождения места")
+		}
+	})
+
+	t.Run("отмена контекста", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{})
+		_ = wp.SubmitBlocking(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := wp.WaitForSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ожидалась context.DeadlineExceeded, получили %v", err)
+		}
+	})
+
+	t.Run("свободные места и остановка", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(2, 3)
+		// два простаивающих воркера сверх трёх мест в буфере
+		deadline := time.Now().Add(2 * time.Second)
+		for wp.AvailableSlots() != 5 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := wp.AvailableSlots(); got != 5 {
+			t.Fatalf("ожидалось 5 свободных мест, получили %d", got)
+		}
+		if err := wp.WaitForSlot(context.Background()); err != nil {
+			t.Errorf("неожиданная ошибка: %v", err)
+		}
+
+		wp.StopWait()
+		if got := wp.AvailableSlots(); got != 0 {
+			t.Errorf("после остановки ожидалось 0 мест, получили %d", got)
+		}
+		if err := wp.WaitForSlot(context.Background()); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped, получили %v", err)
+		}
+	})
+}
+
+func TestStopDiscardsQueue(t *testing.T) {
+	t.Run("Stop выполняет только текущую задачу и отбрасывает очередь", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var completed atomic.Int32
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			completed.Add(1)
+			return nil
+		})
+		<-started
+
+		results := make([]<-chan error, 5)
+		for i := range results {
+			ch, err := wp.SubmitAsync(func() error {
+				completed.Add(1)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			results[i] = ch
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+		// контекст пула отменяется уже после того, как очередь отброшена
+		<-wp.Done()
+		if err := wp.Submit(func() error { return nil }); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("после начала Stop ожидалась ErrPoolStopped, получили %v", err)
+		}
+		select {
+		case <-stopped:
+			t.Fatal("Stop вернулся, не дождавшись текущей задачи")
+		default:
+		}
+
+		close(release)
+		<-stopped
+
+		if got := completed.Load(); got != 1 {
+			t.Errorf("Stop должен был выполнить только текущую задачу, а выполнено %d", got)
+		}
+		for i, ch := range results {
+			if err := <-ch; !errors.Is(err, ErrPoolStopped) {
+				t.Errorf("задача %d: ожидалась ErrPoolStopped, получили %v", i, err)
+			}
+		}
+		if got := wp.QueueLen(); got != 0 {
+			t.Errorf("очередь должна быть пуста, в ней %d задач", got)
+		}
+	})
+}
+
+func TestSubmitNoErr(t *testing.T) {
+	t.Run("функция без ошибки выполняется", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		var count atomic.Int32
+		for i := 0; i < 3; i++ {
+			if err := wp.SubmitNoErr(func() { count.Add(1) }); err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+		}
+		if err := wp.SubmitWaitNoErr(func() { count.Add(1) }); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		wp.WaitIdle()
+
+		if got := count.Load(); got != 4 {
+			t.Errorf("ожидалось 4 выполнения, получили %d", got)
+		}
+		if got := wp.Stats().Completed; got != 4 {
+			t.Errorf("ожидалось Completed=4, получили %d", got)
+		}
+	})
+
+	t.Run("паника восстанавливается", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+		defer wp.StopWait()
+
+		var panics atomic.Int32
+		wp.OnPanic(func(interface{}, []byte) { panics.Add(1) })
+
+		_ = wp.SubmitNoErr(func() { panic("boom") })
+		err := wp.SubmitWaitNoErr(func() { panic("boom") })
+		var pe *PanicError
+		if !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Errorf("ожидалась *PanicError, получили %v", err)
+		}
+		wp.WaitIdle()
+
+		if got := panics.Load(); got != 2 {
+			t.Errorf("ожидалось 2 паники в OnPanic, получили %d", got)
+		}
+		if err := wp.SubmitWaitNoErr(func() {}); err != nil {
+			t.Errorf("воркер должен продолжить работу, получили %v", err)
+		}
+	})
+
+	t.Run("nil-задача и остановленный пул", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		if err := wp.SubmitNoErr(nil); !errors.Is(err, ErrNilTask) {
+			t.Errorf("ожидалась ErrNilTask, получили %v", err)
+		}
+		if err := wp.SubmitWaitNoErr(nil); !errors.Is(err, ErrNilTask) {
+			t.Errorf("ожидалась ErrNilTask, получили %v", err)
+		}
+		wp.StopWait()
+		if err := wp.SubmitNoErr(func() {}); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("ожидалась ErrPoolStopped, получили %v", err)
+		}
+	})
+}
+
+func TestMaxWorkers(t *testing.T) {
+	t.Run("огромное число воркеров урезается до DefaultMaxWorkers", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1<<30, WithLogger(logger))
+		defer wp.StopWait()
+
+		if got := wp.WorkerCount(); got != DefaultMaxWorkers {
+			t.Errorf("ожидалось %d воркеров, получили %d", DefaultMaxWorkers, got)
+		}
+		if logger.count("clamped to 4096") != 1 {
+			t.Errorf("ожидалось предупреждение в логе, получили %q", logger.msgs)
+		}
+	})
+
+	t.Run("граница WithMaxWorkers действует и в Resize", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(100, WithLogger(logger), WithMaxWorkers(8))
+		defer wp.StopWait()
+
+		if got := wp.WorkerCount(); got != 8 {
+			t.Errorf("ожидалось 8 воркеров, получили %d", got)
+		}
+		if err := wp.Resize(1000); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if got := wp.WorkerCount(); got != 8 {
+			t.Errorf("после Resize ожидалось 8 воркеров, получили %d", got)
+		}
+		if got := logger.count("clamped to 8"); got != 2 {
+			t.Errorf("ожидалось 2 предупреждения, получили %q", logger.msgs)
+		}
+	})
+
+	t.Run("ноль и отрицательные значения по-прежнему дают одного воркера", func(t *testing.T) {
+		for _, n := range []int{0, -5} {
+			wp := NewWorkerPool(n)
+			if got := wp.WorkerCount(); got != 1 {
+				t.Errorf("NewWorkerPool(%d): ожидался 1 воркер, получили %d", n, got)
+			}
+			wp.StopWait()
+		}
+	})
+}
+
+func TestLatencies(t *testing.T) {
+	t.Run("сводка по задачам с известной длительностью", func(t *testing.T) {
+		wp := NewWorkerPool(4)
+		defer wp.StopWait()
+
+		if got := wp.Latencies(); got != (LatencyStats{}) {
+			t.Errorf("до задач ожидалась пустая сводка, получили %+v", got)
+		}
+
+		durations := []time.Duration{10, 20, 20, 30, 40, 50, 60, 80}
+		for _, d := range durations {
+			d := d * time.Millisecond
+			_ = wp.Submit(func() error {
+				time.Sleep(d)
+				return nil
+			})
+		}
+		wp.WaitIdle()
+
+		s := wp.Latencies()
+		if s.Count != int64(len(durations)) {
+			t.Fatalf("ожидалось Count=%d, получили %d", len(durations), s.Count)
+		}
+		// среднее 38.75 мс; сон может только затянуться
+		if s.Mean < 38*time.Millisecond || s.Mean > 80*time.Millisecond {
+			t.Errorf("среднее %s вне ожидаемого диапазона", s.Mean)
+		}
+		if s.Max < 80*time.Millisecond || s.Max > 200*time.Millisecond {
+			t.Errorf("максимум %s вне ожидаемого диапазона", s.Max)
+		}
+		if s.Min < 10*time.Millisecond || s.Min > s.P50 || s.P50 > s.P95 || s.P95 > s.Max {
+			t.Errorf("нарушен порядок min <= p50 <= p95 <= max: %+v", s)
+		}
+	})
+
+	t.Run("перцентили по выборке", func(t *testing.T) {
+		var r latencyRecorder
+		for i := 1; i <= 100; i++ {
+			r.observe(time.Duration(i) * time.Millisecond)
+		}
+		s := r.stats()
+		want := LatencyStats{
+			Count: 100,
+			Min:   time.Millisecond,
+			Max:   100 * time.Millisecond,
+			Mean:  50500 * time.Microsecond,
+			P50:   50 * time.Millisecond,
+			P95:   95 * time.Millisecond,
+		}
+		if s != want {
+			t.Errorf("ожидалось %+v, получили %+v", want, s)
+		}
+	})
+
+	t.Run("выборка не растёт сверх предела", func(t *testing.T) {
+		var r latencyRecorder
+		for i := 0; i < 3*latencySamples; i++ {
+			r.observe(time.Millisecond)
+		}
+		if len(r.samples) != latencySamples {
+			t.Errorf("ожидалось %d образцов, получили %d", latencySamples, len(r.samples))
+		}
+		if s := r.stats(); s.Count != 3*latencySamples || s.P95 != time.Millisecond {
+			t.Errorf("неожиданная сводка %+v", s)
+		}
+	})
+}
+
+func TestSubmitDuringStopWait(t *testing.T) {
+	t.Run("поздние Submit получают ErrPoolStopped без паники", func(t *testing.T) {
+		for round := 0; round < 20; round++ {
+			wp := NewWorkerPoolWithQueue(4, 16)
+
+			var accepted, executed, rejected atomic.Int64
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					for {
+						var err error
+						if g%2 == 0 {
+							err = wp.Submit(func() error {
+								executed.Add(1)
+								return nil
+							})
+						} else {
+							err = wp.SubmitWait(func() error {
+								executed.Add(1)
+								return nil
+							})
+						}
+						switch {
+						case err == nil:
+							accepted.Add(1)
+						case errors.Is(err, ErrPoolStopped):
+							rejected.Add(1)
+							return
+						case errors.Is(err, ErrQueueFull):
+						default:
+							t.Errorf("неожиданная ошибка: %v", err)
+							return
+						}
+					}
+				}()
+			}
+
+			close(start)
+			wp.StopWait()
+			wg.Wait()
+
+			if got := rejected.Load(); got != 8 {
+				t.Errorf("раунд %d: ErrPoolStopped получили %d горутин из 8", round, got)
+			}
+			// StopWait дорабатывает всё, что пул принял до остановки
+			if a, e := accepted.Load(), executed.Load(); a != e {
+				t.Errorf("раунд %d: принято %d задач, выполнено %d", round, a, e)
+			}
+		}
+	})
+}
+
+func TestSubmitLabeled(t *testing.T) {
+	t.Run("счётчики меток ведутся независимо", func(t *testing.T) {
+		wp := NewWorkerPool(3, WithLogger(nil))
+
+		for i := 0; i < 4; i++ {
+			if err := wp.SubmitLabeled("email", func() error { return nil }); err != nil {
+				t.Fatalf("SubmitLabeled вернул ошибку: %v", err)
+			}
+		}
+		_ = wp.SubmitLabeled("email", func() error { return errors.New("smtp") })
+		_ = wp.SubmitLabeled("report", func() error { return errors.New("fail") })
+		_ = wp.SubmitLabeled("report", func() error { panic("boom") })
+		_ = wp.Submit(func() error { return nil })
+		wp.StopWait()
+
+		got := wp.StatsByLabel()
+		want := map[string]PoolStats{
+			"email":  {Submitted: 5, Completed: 4, Failed: 1},
+			"report": {Submitted: 2, Failed: 1, Panicked: 1},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("StatsByLabel = %+v, ожидалось %+v", got, want)
+		}
+
+		stats := wp.Stats()
+		if stats.Submitted != 8 || stats.Completed != 5 || stats.Failed != 2 || stats.Panicked != 1 {
+			t.Errorf("общие счётчики не совпадают: %+v", stats)
+		}
+	})
+
+	t.Run("nil-задача и отклонённая задача не учитываются", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		if err := wp.SubmitLabeled("email", nil); err != ErrNilTask {
+			t.Errorf("ожидалась ErrNilTask, получили: %v", err)
+		}
+		wp.Stop()
+		if err := wp.SubmitLabeled("email", func() error { return nil }); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+		if got := wp.StatsByLabel(); len(got) != 0 {
+			t.Errorf("ожидался пустой результат, получили: %+v", got)
+		}
+	})
+}
+
+func TestMapReduce(t *testing.T) {
+	sum := func(xs []int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}
+	add := func(a, b int) int { return a + b }
+
+	t.Run("сумма большого среза совпадает с последовательной", func(t *testing.T) {
+		wp := NewWorkerPool(4)
+		defer wp.StopWait()
+
+		items := make([]int, 100003)
+		for i := range items {
+			items[i] = i * 7 % 1000
+		}
+
+		for _, chunk := range []int{1000, 7, 100003, 200000, 0} {
+			got, err := MapReduce(wp, items, chunk, sum, add)
+			if want := sum(items); err != nil || got != want {
+				t.Errorf("chunkSize=%d: получили %d, %v, ожидалось %d", chunk, got, err, want)
+			}
+		}
+	})
+
+	t.Run("куски сворачиваются по порядку", func(t *testing.T) {
+		wp := NewWorkerPool(3)
+		defer wp.StopWait()
+
+		words := []string{"a", "b", "c", "d", "e", "f", "g"}
+		got, err := MapReduce(wp, words, 3,
+			func(xs []string) string { return strings.Join(xs, "") },
+			func(a, b string) string { return a + "|" + b })
+		if err != nil || got != "abc|def|g" {
+			t.Errorf("получили %q, %v, ожидалось %q", got, err, "abc|def|g")
+		}
+	})
+
+	t.Run("пустой ввод", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		called := false
+		got, err := MapReduce(wp, nil, 10, func(xs []int) int { called = true; return sum(xs) }, add)
+		if err != nil || got != 0 || called {
+			t.Errorf("ожидался 0 без вызова mapFn, получили %d, %v (mapFn вызван: %v)", got, err, called)
+		}
+	})
+
+	t.Run("паника в куске возвращается ошибкой", func(t *testing.T) {
+		wp := NewWorkerPool(2, WithLogger(nil))
+		defer wp.StopWait()
+
+		got, err := MapReduce(wp, []int{1, 2, 3, 4}, 2, func(xs []int) int {
+			if xs[0] == 3 {
+				panic("boom")
+			}
+			return sum(xs)
+		}, add)
+		var pe *PanicError
+		if !errors.As(err, &pe) || got != 0 {
+			t.Errorf("ожидались 0 и *PanicError, получили %d, %v", got, err)
+		}
+	})
+
+	t.Run("остановка пула возвращает ErrPoolStopped", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		defer close(release)
+
+		type result struct {
+			sum int
+			err error
+		}
+		resCh := make(chan result, 1)
+		go func() {
+			got, err := MapReduce(wp, []int{1, 2, 3, 4, 5, 6}, 1, func(xs []int) int {
+				started <- struct{}{}
+				<-release
+				return sum(xs)
+			}, add)
+			resCh <- result{got, err}
+		}()
+
+		for range 2 {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatal("куски не начались")
+			}
+		}
+		// Stop ждёт начатых задач, поэтому — в отдельной горутине
+		go wp.Stop()
+
+		select {
+		case res := <-resCh:
+			if !errors.Is(res.err, ErrPoolStopped) || res.sum != 0 {
+				t.Errorf("ожидались 0 и ErrPoolStopped, получили %d, %v", res.sum, res.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("MapReduce завис после остановки пула")
+		}
+	})
+}
+
+func TestCancelAll(t *testing.T) {
+	t.Run("отбрасывает очередь за занятыми воркерами", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(2, 10)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		var started sync.WaitGroup
+		started.Add(2)
+		for i := 0; i < 2; i++ {
+			_ = wp.Submit(func() error {
+				started.Done()
+				<-release
+				return nil
+			})
+		}
+		started.Wait()
+
+		var ran atomic.Int32
+		for i := 0; i < 5; i++ {
+			if err := wp.Submit(func() error { ran.Add(1); return nil }); err != nil {
+				t.Fatalf("Submit вернул ошибку: %v", err)
+			}
+		}
+		waitErr := make(chan error, 1)
+		go func() { waitErr <- wp.SubmitWait(func() error { ran.Add(1); return nil }) }()
+		for wp.QueueLen() < 6 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if n := wp.CancelAll(); n != 6 {
+			t.Errorf("CancelAll вернул %d, ожидалось 6", n)
+		}
+		if err := <-waitErr; err != ErrTaskCancelled {
+			t.Errorf("SubmitWait: ожидалась ErrTaskCancelled, получили: %v", err)
+		}
+		if n := wp.QueueLen(); n != 0 {
+			t.Errorf("в очереди осталось %d задач", n)
+		}
+
+		close(release)
+		wp.WaitIdle()
+		if n := ran.Load(); n != 0 {
+			t.Errorf("выполнено %d отброшенных задач", n)
+		}
+
+		if err := wp.SubmitWait(func() error { return nil }); err != nil {
+			t.Errorf("пул не принимает задачи после CancelAll: %v", err)
+		}
+	})
+
+	t.Run("возвращает бюджет отброшенных задач", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 10, WithCostBudget(10, BudgetReject))
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		if err := wp.SubmitWeighted(10, func() error { return nil }); err != nil {
+			t.Fatalf("SubmitWeighted вернул ошибку: %v", err)
+		}
+		if n := wp.CancelAll(); n != 1 {
+			t.Errorf("CancelAll вернул %d, ожидалось 1", n)
+		}
+		if err := wp.SubmitWeighted(10, func() error { return nil }); err != nil {
+			t.Errorf("бюджет не вернулся после CancelAll: %v", err)
+		}
+		close(release)
+	})
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("прогресс не возрастает и доходит до нуля", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(4, 20)
+		defer wp.StopWait()
+
+		var ran atomic.Int32
+		for i := 0; i < 20; i++ {
+			if err := wp.Submit(func() error {
+				time.Sleep(10 * time.Millisecond)
+				ran.Add(1)
+				return nil
+			}); err != nil {
+				t.Fatalf("Submit вернул ошибку: %v", err)
+			}
+		}
+
+		var counts []int
+		wp.Drain(func(remaining int) {
+			// пул доступен из обработчика: внутренние блокировки не удерживаются
+			_ = wp.Stats()
+			counts = append(counts, remaining)
+		})
+
+		if n := ran.Load(); n != 20 {
+			t.Errorf("Drain вернулся после %d задач из 20", n)
+		}
+		if len(counts) < 2 {
+			t.Fatalf("ожидалось несколько вызовов onProgress, получили: %v", counts)
+		}
+		if counts[0] > 20 || counts[len(counts)-1] != 0 {
+			t.Errorf("ожидались значения от не более 20 до 0, получили: %v", counts)
+		}
+		for i := 1; i < len(counts); i++ {
+			if counts[i] >= counts[i-1] {
+				t.Fatalf("значения должны убывать: %v", counts)
+			}
+		}
+	})
+
+	t.Run("без задач и без обработчика", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		var counts []int
+		wp.Drain(func(remaining int) { counts = append(counts, remaining) })
+		if !reflect.DeepEqual(counts, []int{0}) {
+			t.Errorf("ожидался один вызов с 0, получили: %v", counts)
+		}
+		wp.Drain(nil)
+	})
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	// setup — пул с одним занятым воркером и очередью на две задачи;
+	// возвращает журнал выполненных задач и функцию, освобождающую воркер
+	setup := func(t *testing.T, opts ...Option) (wp *WorkerPool, task func(name string) func() error, ran func() []string, release func()) {
+		t.Helper()
+		wp = NewWorkerPoolWithQueue(1, 2, opts...)
+		t.Cleanup(wp.StopWait)
+
+		var mu sync.Mutex
+		var log []string
+		task = func(name string) func() error {
+			return func() error {
+				mu.Lock()
+				log = append(log, name)
+				mu.Unlock()
+				return nil
+			}
+		}
+		ran = func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), log...)
+		}
+
+		unblock := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.Submit(func() error {
+			close(started)
+			<-unblock
+			return nil
+		})
+		<-started
+		return wp, task, ran, func() { close(unblock) }
+	}
+
+	t.Run("DropNewest отклоняет новую задачу", func(t *testing.T) {
+		wp, task, ran, release := setup(t)
+		for _, name := range []string{"a", "b"} {
+			if err := wp.Submit(task(name)); err != nil {
+				t.Fatalf("Submit(%s) вернул ошибку: %v", name, err)
+			}
+		}
+		if err := wp.Submit(task("c")); err != ErrQueueFull {
+			t.Errorf("ожидалась ErrQueueFull, получили: %v", err)
+		}
+		release()
+		wp.WaitIdle()
+		if got := ran(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("выполнены %v, ожидались [a b]", got)
+		}
+	})
+
+	t.Run("DropOldest вытесняет самую давнюю задачу", func(t *testing.T) {
+		wp, task, ran, release := setup(t, WithOverflowPolicy(OverflowDropOldest))
+		evicted, err := wp.SubmitAsync(task("a"))
+		if err != nil {
+			t.Fatalf("SubmitAsync вернул ошибку: %v", err)
+		}
+		for _, name := range []string{"b", "c", "d"} {
+			if err := wp.Submit(task(name)); err != nil {
+				t.Fatalf("Submit(%s) вернул ошибку: %v", name, err)
+			}
+		}
+		if err := <-evicted; err != ErrQueueFull {
+			t.Errorf("вытесненная задача: ожидалась ErrQueueFull, получили: %v", err)
+		}
+		release()
+		wp.WaitIdle()
+		if got := ran(); !reflect.DeepEqual(got, []string{"c", "d"}) {
+			t.Errorf("выполнены %v, ожидались [c d]", got)
+		}
+		if n := wp.Stats().Evicted; n != 2 {
+			t.Errorf("Evicted = %d, ожидалось 2", n)
+		}
+	})
+
+	t.Run("DropOldest в приоритетной очереди вытесняет давнюю, а не младшую", func(t *testing.T) {
+		wp, task, ran, release := setup(t, WithPriorityQueue(), WithOverflowPolicy(OverflowDropOldest))
+		_ = wp.SubmitPriority(9, task("old-high"))
+		_ = wp.SubmitPriority(1, task("low"))
+		_ = wp.SubmitPriority(5, task("new"))
+		release()
+		wp.WaitIdle()
+		if got := ran(); !reflect.DeepEqual(got, []string{"new", "low"}) {
+			t.Errorf("выполнены %v, ожидались [new low]", got)
+		}
+	})
+
+	t.Run("Block ждёт места", func(t *testing.T) {
+		wp, task, ran, release := setup(t, WithOverflowPolicy(OverflowBlock))
+		for _, name := range []string{"a", "b"} {
+			_ = wp.Submit(task(name))
+		}
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- wp.Submit(task("c")) }()
+		select {
+		case err := <-errCh:
+			t.Fatalf("Submit вернулся при заполненной очереди: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release()
+		if err := <-errCh; err != nil {
+			t.Fatalf("Submit вернул ошибку: %v", err)
+		}
+		wp.WaitIdle()
+		if got := ran(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("выполнены %v, ожидались [a b c]", got)
+		}
+	})
+
+	t.Run("Block из задачи того же пула не зависает", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 0, WithOverflowPolicy(OverflowBlock))
+		defer wp.StopWait()
+
+		if err := wp.SubmitWait(func() error {
+			return wp.Submit(func() error { return nil })
+		}); err != ErrReentrantDeadlock {
+			t.Errorf("ожидалась ErrReentrantDeadlock, получили: %v", err)
+		}
+	})
+}
+
+func TestSubmitKeyed(t *testing.T) {
+	t.Run("порядок внутри ключа, параллельность между ключами", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(4, 4)
+		defer wp.StopWait()
+
+		var mu sync.Mutex
+		order := map[string][]int{}
+		active := map[string]int{}
+		running, maxRunning := 0, 0
+
+		for i := 0; i < 10; i++ {
+			for _, key := range []string{"alice", "bob"} {
+				if err := wp.SubmitKeyed(key, func() error {
+					mu.Lock()
+					active[key]++
+					if active[key] > 1 {
+						t.Errorf("задачи ключа %s выполняются одновременно", key)
+					}
+					running++
+					maxRunning = max(maxRunning, running)
+					order[key] = append(order[key], i)
+					mu.Unlock()
+
+					time.Sleep(5 * time.Millisecond)
+
+					mu.Lock()
+					active[key]--
+					running--
+					mu.Unlock()
+					return nil
+				}); err != nil {
+					t.Fatalf("SubmitKeyed(%s, %d) вернул ошибку: %v", key, i, err)
+				}
+			}
+		}
+		wp.WaitIdle()
+
+		want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+		for _, key := range []string{"alice", "bob"} {
+			if !reflect.DeepEqual(order[key], want) {
+				t.Errorf("порядок задач %s: %v, ожидался %v", key, order[key], want)
+			}
+		}
+		if maxRunning < 2 {
+			t.Errorf("задачи разных ключей не выполнялись параллельно")
+		}
+		if n := wp.Stats().Submitted; n != 20 {
+			t.Errorf("Submitted = %d, ожидалось 20", n)
+		}
+	})
+
+	t.Run("паника не останавливает очередь ключа", func(t *testing.T) {
+		wp := NewWorkerPool(2, WithLogger(nil))
+		defer wp.StopWait()
+
+		var ran atomic.Int32
+		_ = wp.SubmitKeyed("k", func() error { panic("boom") })
+		_ = wp.SubmitKeyed("k", func() error { ran.Add(1); return nil })
+		wp.WaitIdle()
+		if ran.Load() != 1 {
+			t.Error("задача после паники не выполнилась")
+		}
+	})
+
+	t.Run("StopWait выполняет ждущие задачи ключа", func(t *testing.T) {
+		// очередь на одну задачу занята задачей другого ключа: следующая
+		// задача "a" ждёт места уже после закрытия очереди
+		wp := NewWorkerPoolWithQueue(1, 1)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.SubmitKeyed("a", func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		var mu sync.Mutex
+		var order []string
+		record := func(s string) func() error {
+			return func() error {
+				mu.Lock()
+				order = append(order, s)
+				mu.Unlock()
+				return nil
+			}
+		}
+		if err := wp.SubmitKeyed("b", record("b")); err != nil {
+			t.Fatalf("SubmitKeyed вернул ошибку: %v", err)
+		}
+		for i := 1; i <= 3; i++ {
+			if err := wp.SubmitKeyed("a", record(fmt.Sprintf("a%d", i))); err != nil {
+				t.Fatalf("SubmitKeyed вернул ошибку: %v", err)
+			}
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.StopWait()
+			close(stopped)
+		}()
+		for !wp.queue.isClosed() {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("StopWait не завершился")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		var keyA []string
+		for _, s := range order {
+			if s != "b" {
+				keyA = append(keyA, s)
+			}
+		}
+		if len(order) != 4 || strings.Join(keyA, ",") != "a1,a2,a3" {
+			t.Errorf("после StopWait выполнены %v, ожидались b и a1..a3 по порядку", order)
+		}
+	})
+
+	t.Run("Stop отбрасывает ждущие задачи ключа", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		_ = wp.SubmitKeyed("k", func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		var ran atomic.Int32
+		for i := 0; i < 3; i++ {
+			_ = wp.SubmitKeyed("k", func() error { ran.Add(1); return nil })
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+		for wp.IsRunning() {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		<-stopped
+
+		if n := ran.Load(); n != 0 {
+			t.Errorf("после Stop выполнено %d задач ключа", n)
+		}
+		if err := wp.SubmitKeyed("k", func() error { return nil }); err != ErrPoolStopped {
+			t.Errorf("ожидалась ErrPoolStopped, получили: %v", err)
+		}
+		wp.WaitIdle()
+	})
+}
+
+func TestResizeQueue(t *testing.T) {
+	t.Run("увеличение очереди без потери задач и порядка", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 3)
+		defer wp.StopWait()
+		release := blockWorkers(t, wp, 1)
+
+		var mu sync.Mutex
+		var order []int
+		record := func(i int) func() error {
+			return func() error {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return nil
+			}
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := wp.Submit(record(i)); err != nil {
+				t.Fatalf("Submit(%d) вернул ошибку: %v", i, err)
+			}
+		}
+		if err := wp.Submit(record(-1)); err != ErrQueueFull {
+			t.Fatalf("ожидалась ErrQueueFull, получили: %v", err)
+		}
+
+		blocked := make(chan error, 1)
+		go func() { blocked <- wp.SubmitBlocking(record(3)) }()
+		time.Sleep(20 * time.Millisecond)
+
+		if err := wp.ResizeQueue(2); err != errQueueCapTooSmall {
+			t.Errorf("уменьшение ниже длины очереди: ожидалась errQueueCapTooSmall, получили: %v", err)
+		}
+		if err := wp.ResizeQueue(6); err != nil {
+			t.Fatalf("ResizeQueue вернул ошибку: %v", err)
+		}
+		if err := <-blocked; err != nil {
+			t.Fatalf("SubmitBlocking вернул ошибку: %v", err)
+		}
+		if c := wp.QueueCap(); c != 6 {
+			t.Errorf("QueueCap = %d, ожидалось 6", c)
+		}
+		for i := 4; i < 6; i++ {
+			if err := wp.Submit(record(i)); err != nil {
+				t.Fatalf("Submit(%d) после увеличения вернул ошибку: %v", i, err)
+			}
+		}
+
+		release()
+		wp.WaitIdle()
+		if want := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(order, want) {
+			t.Errorf("порядок выполнения %v, ожидался %v", order, want)
+		}
+	})
+
+	t.Run("уменьшение и ошибки", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 5)
+		if err := wp.ResizeQueue(1); err != nil || wp.QueueCap() != 1 {
+			t.Errorf("уменьшение пустой очереди: ошибка %v, ёмкость %d", err, wp.QueueCap())
+		}
+		if err := wp.ResizeQueue(-1); err != errQueueCapTooSmall {
+			t.Errorf("отрицательная ёмкость: ожидалась errQueueCapTooSmall, получили: %v", err)
+		}
+		wp.Stop()
+		if err := wp.ResizeQueue(10); err != ErrPoolStopped {
+			t.Errorf("после Stop ожидалась ErrPoolStopped, получили: %v", err)
+		}
+	})
+}
+
+func TestMockClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("SubmitAfter срабатывает ровно в срок", func(t *testing.T) {
+		clock := NewMockClock(start)
+		wp := NewWorkerPool(1, WithClock(clock))
+		defer wp.StopWait()
+
+		firedAt := make(chan time.Time, 1)
+		if err := wp.SubmitAfter(10*time.Second, func() error {
+			firedAt <- clock.Now()
+			return nil
+		}); err != nil {
+			t.Fatalf("SubmitAfter вернул ошибку: %v", err)
+		}
+
+		clock.Advance(10*time.Second - time.Nanosecond)
+		if n := wp.QueueLen(); n != 0 || clock.Pending() != 1 {
+			t.Fatalf("задача поставлена до срока: в очереди %d, таймеров %d", n, clock.Pending())
+		}
+		select {
+		case at := <-firedAt:
+			t.Fatalf("задача выполнилась до срока, в %v", at)
+		default:
+		}
+
+		clock.Advance(time.Nanosecond)
+		select {
+		case at := <-firedAt:
+			if want := start.Add(10 * time.Second); !at.Equal(want) {
+				t.Errorf("задача выполнилась в %v, ожидалось %v", at, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("задача не выполнилась после наступления срока")
+		}
+	})
+
+	t.Run("SubmitAt отсчитывает срок по часам пула", func(t *testing.T) {
+		clock := NewMockClock(start)
+		wp := NewWorkerPool(1, WithClock(clock))
+		defer wp.StopWait()
+
+		firedAt := make(chan time.Time, 1)
+		// start далеко в прошлом по системным часам: с time.Until задача
+		// встала бы в очередь сразу
+		if err := wp.SubmitAt(start.Add(time.Hour), func() error {
+			firedAt <- clock.Now()
+			return nil
+		}); err != nil {
+			t.Fatalf("SubmitAt вернул ошибку: %v", err)
+		}
+		if clock.Pending() != 1 {
+			t.Fatalf("ожидался 1 таймер MockClock, получили %d", clock.Pending())
+		}
+
+		clock.Advance(time.Hour - time.Nanosecond)
+		select {
+		case at := <-firedAt:
+			t.Fatalf("задача выполнилась до срока, в %v", at)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		clock.Advance(time.Nanosecond)
+		select {
+		case at := <-firedAt:
+			if want := start.Add(time.Hour); !at.Equal(want) {
+				t.Errorf("задача выполнилась в %v, ожидалось %v", at, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("задача не выполнилась после наступления срока")
+		}
+	})
+
+	t.Run("SubmitEvery тикает по Advance", func(t *testing.T) {
+		clock := NewMockClock(start)
+		wp := NewWorkerPool(1, WithClock(clock))
+		defer wp.StopWait()
+
+		var runs atomic.Int32
+		cancel := wp.SubmitEvery(time.Minute, func() error {
+			runs.Add(1)
+			return nil
+		})
+		defer cancel()
+
+		for i := 1; i <= 3; i++ {
+			for clock.Pending() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			clock.Advance(time.Minute)
+			deadline := time.Now().Add(time.Second)
+			for runs.Load() < int32(i) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if n := runs.Load(); n != int32(i) {
+				t.Fatalf("после %d тиков выполнено %d запусков", i, n)
+			}
+		}
+	})
+
+	t.Run("Stop отменяет таймеры MockClock", func(t *testing.T) {
+		clock := NewMockClock(start)
+		wp := NewWorkerPool(1, WithClock(clock))
+
+		_ = wp.SubmitAfter(time.Hour, func() error { return nil })
+		wp.Stop()
+		if n := clock.Pending(); n != 0 {
+			t.Errorf("после Stop осталось %d таймеров", n)
+		}
+	})
+}
+
+func TestSubmitHandle(t *testing.T) {
+	t.Run("опрос Completed и Err", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		errBoom := errors.New("boom")
+		failing, err := wp.SubmitHandle(func() error {
+			<-release
+			return errBoom
+		})
+		if err != nil {
+			t.Fatalf("SubmitHandle вернул ошибку: %v", err)
+		}
+		ok, err := wp.SubmitHandle(func() error { return nil })
+		if err != nil {
+			t.Fatalf("SubmitHandle вернул ошибку: %v", err)
+		}
+
+		if failing.Completed() || failing.Err() != nil {
+			t.Fatal("задача завершена до освобождения")
+		}
+		close(release)
+
+		deadline := time.Now().Add(time.Second)
+		for !failing.Completed() {
+			if time.Now().After(deadline) {
+				t.Fatal("Completed не стал true")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := failing.Err(); err != errBoom {
+			t.Errorf("Err() = %v, ожидалась %v", err, errBoom)
+		}
+		<-ok.Done()
+		if err := ok.Err(); err != nil {
+			t.Errorf("успешная задача: Err() = %v", err)
+		}
+	})
+
+	t.Run("паника и отброшенная задача", func(t *testing.T) {
+		wp := NewWorkerPool(1, WithLogger(nil))
+
+		h, _ := wp.SubmitHandle(func() error { panic("boom") })
+		<-h.Done()
+		var pe *PanicError
+		if !errors.As(h.Err(), &pe) {
+			t.Errorf("ожидалась *PanicError, получили: %v", h.Err())
+		}
+
+		release := blockWorkers(t, wp, 1)
+		queued, err := wp.SubmitHandle(func() error { return nil })
+		if err != nil {
+			t.Fatalf("SubmitHandle вернул ошибку: %v", err)
+		}
+		wp.CancelAll()
+		if !queued.Completed() || queued.Err() != ErrTaskCancelled {
+			t.Errorf("отброшенная задача: Completed %v, Err %v", queued.Completed(), queued.Err())
+		}
+		release()
+		wp.Stop()
+
+		if h, err := wp.SubmitHandle(func() error { return nil }); err != ErrPoolStopped || h != nil {
+			t.Errorf("после Stop ожидались nil и ErrPoolStopped, получили %v, %v", h, err)
+		}
+		if _, err := wp.SubmitHandle(nil); err != ErrNilTask {
+			t.Errorf("ожидалась ErrNilTask, получили: %v", err)
+		}
+	})
+}
+
+func TestPriorityAging(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	order := func(t *testing.T, cfg AgingConfig) []int {
+		clock := NewMockClock(start)
+		wp := NewWorkerPool(1, WithClock(clock), WithPriorityAging(cfg))
+		defer wp.StopWait()
+
+		release := blockWorkers(t, wp, 1)
+
+		var got []int
+		var mu sync.Mutex
+		record := func(id int) func() error {
+			return func() error {
+				mu.Lock()
+				got = append(got, id)
+				mu.Unlock()
+				return nil
+			}
+		}
+
+		_ = wp.SubmitPriority(0, record(1))
+		clock.Advance(50 * time.Millisecond)
+		_ = wp.SubmitPriority(3, record(2))
+
+		release()
+		wp.WaitIdle()
+		return got
+	}
+
+	t.Run("долго ждущая задача обгоняет более приоритетную", func(t *testing.T) {
+		got := order(t, AgingConfig{Rate: 10 * time.Millisecond})
+		if want := []int{1, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ожидался порядок %v, получили %v", want, got)
+		}
+	})
+
+	t.Run("прибавка ограничена MaxBoost", func(t *testing.T) {
+		got := order(t, AgingConfig{Rate: 10 * time.Millisecond, MaxBoost: 2})
+		if want := []int{2, 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ожидался порядок %v, получили %v", want, got)
+		}
+	})
+
+	t.Run("без старения действует обычный приоритет", func(t *testing.T) {
+		got := order(t, AgingConfig{})
+		if want := []int{2, 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("ожидался порядок %v, получили %v", want, got)
+		}
+	})
+
+	t.Run("поток приоритетных задач не вытесняет низкоприоритетную навсегда", func(t *testing.T) {
+		wp := NewWorkerPoolWithQueue(1, 16,
+			WithPriorityAging(AgingConfig{Rate: 5 * time.Millisecond, MaxBoost: 100}))
+		defer wp.Stop()
+
+		stop := make(chan struct{})
+		var producer sync.WaitGroup
+		producer.Add(1)
+		go func() {
+			defer producer.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				err := wp.SubmitPriority(10, func() error {
+					time.Sleep(200 * time.Microsecond)
+					return nil
+				})
+				if errors.Is(err, ErrQueueFull) {
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+		}()
+		defer func() {
+			close(stop)
+			producer.Wait()
+		}()
+
+		// очередь уже забита приоритетными задачами
+		deadline := time.Now().Add(time.Second)
+		for wp.QueueLen() < 8 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		// место в очереди освобождается на доли миллисекунды — ждём его
+		ran := make(chan struct{})
+		deadline = time.Now().Add(time.Second)
+		for {
+			err := wp.SubmitPriority(0, func() error {
+				close(ran)
+				return nil
+			})
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrQueueFull) || time.Now().After(deadline) {
+				t.Fatalf("SubmitPriority вернул ошибку: %v", err)
+			}
+			time.Sleep(50 * time.Microsecond)
+		}
+
+		select {
+		case <-ran:
+		case <-time.After(2 * time.Second):
+			t.Fatal("низкоприоритетная задача не выполнилась за 2с")
+		}
+	})
+
+	t.Run("пересчёт прибавок сохраняет порядок кучи", func(t *testing.T) {
+		cfg := AgingConfig{Rate: 10 * time.Millisecond, MaxBoost: 6}
+		clock := NewMockClock(start)
+		s := newAgingStore(cfg, clock)
+
+		// задачи ставятся вразнобой по времени, чтобы прибавки росли
+		// у разных задач на разных пересчётах
+		at := make(map[*queueItem]time.Time)
+		var seq uint64
+		push := func(priority int) {
+			seq++
+			it := &queueItem{priority: priority, seq: seq}
+			at[it] = clock.Now()
+			s.push(it)
+			clock.Advance(3 * time.Millisecond)
+		}
+		for i := 0; i < 40; i++ {
+			push(i * 7 % 5)
+		}
+
+		for s.len() > 0 {
+			// шаг больше Rate: каждая выдача пересчитывает прибавки
+			clock.Advance(11 * time.Millisecond)
+			effective := func(it *queueItem) int {
+				return it.priority + cfg.boost(clock.Now().Sub(at[it]))
+			}
+			var best *queueItem
+			for it := range at {
+				if best == nil || effective(it) > effective(best) ||
+					effective(it) == effective(best) && it.seq < best.seq {
+					best = it
+				}
+			}
+			if got := s.pop(); got != best {
+				t.Fatalf("выдана задача seq=%d, ожидалась seq=%d", got.seq, best.seq)
+			}
+			delete(at, best)
+			if seq < 60 {
+				push(int(seq) * 3 % 5)
+			}
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	t.Run("задачи, отправленные до Close, выполняются", func(t *testing.T) {
+		var ran atomic.Int32
+		func() {
+			wp := NewWorkerPool(2)
+			defer wp.Close()
+
+			for range 20 {
+				if err := wp.Submit(func() error {
+					time.Sleep(time.Millisecond)
+					ran.Add(1)
+					return nil
+				}); err != nil {
+					t.Fatalf("Submit вернул ошибку: %v", err)
+				}
+			}
+		}()
+
+		if n := ran.Load(); n != 20 {
+			t.Errorf("выполнено %d задач из 20", n)
+		}
+	})
+
+	t.Run("возвращает ошибки задач и повторно ничего не делает", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := blockWorkers(t, wp, 1)
+
+		errBoom := errors.New("boom")
+		_ = wp.Submit(func() error { return errBoom })
+		// задача должна выполниться уже во время остановки
+		time.AfterFunc(20*time.Millisecond, release)
+
+		if err := wp.Close(); !errors.Is(err, errBoom) {
+			t.Errorf("Close вернул %v, ожидалась ошибка задачи", err)
+		}
+		if err := wp.Close(); err != nil {
+			t.Errorf("повторный Close вернул %v, ожидался nil", err)
+		}
+		if err := wp.Submit(func() error { return nil }); !errors.Is(err, ErrPoolStopped) {
+			t.Errorf("Submit после Close вернул %v, ожидалась ErrPoolStopped", err)
+		}
+	})
+
+	t.Run("Close после Stop", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		wp.Stop()
+		if err := wp.Close(); err != nil {
+			t.Errorf("Close после Stop вернул %v, ожидался nil", err)
+		}
+	})
+}
+
+func TestWaitStopped(t *testing.T) {
+	// waitGoroutines — дождаться, пока число горутин опустится до want:
+	// горутины рантайма и context.AfterFunc завершаются не мгновенно
+	waitGoroutines := func(t *testing.T, want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > want {
+			if time.Now().After(deadline) {
+				t.Fatalf("горутин %d, ожидалось не больше %d", runtime.NumGoroutine(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("после остановки горутин не больше, чем до создания пула", func(t *testing.T) {
+		baseline := runtime.NumGoroutine()
+
+		wp := NewWorkerPool(8)
+		if n := runtime.NumGoroutine(); n < baseline+8 {
+			t.Fatalf("горутин %d, ожидалось не меньше %d", n, baseline+8)
+		}
+		for range 100 {
+			_ = wp.SubmitBlocking(func() error { return nil })
+		}
+		wp.StopWait()
+		wp.WaitStopped()
+
+		waitGoroutines(t, baseline)
+	})
+
+	t.Run("ждёт зависшую задачу после StopWaitContext", func(t *testing.T) {
+		wp := NewWorkerPool(1)
+		release := blockWorkers(t, wp, 1)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := wp.StopWaitContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("StopWaitContext вернул %v, ожидался DeadlineExceeded", err)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.WaitStopped()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			t.Fatal("WaitStopped вернулся, пока задача выполняется")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		release()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("WaitStopped не вернулся после завершения задачи")
+		}
+	})
+
+	t.Run("повторные вызовы не блокируются", func(t *testing.T) {
+		wp := NewWorkerPool(2)
+		wp.Stop()
+		wp.WaitStopped()
+		wp.WaitStopped()
+	})
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Run("сообщает о зависшей задаче один раз и с её меткой", func(t *testing.T) {
+		stuck := make(chan StuckTask, 10)
+		wp := NewWorkerPool(2, WithWatchdog(WatchdogConfig{
+			StuckThreshold: 30 * time.Millisecond,
+			Interval:       5 * time.Millisecond,
+			OnStuck:        func(task StuckTask) { stuck <- task },
+		}))
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		_ = wp.SubmitLabeled("slow", func() error {
+			<-release
+			return nil
+		})
+		_ = wp.SubmitLabeled("fast", func() error { return nil })
+
+		var got StuckTask
+		select {
+		case got = <-stuck:
+		case <-time.After(time.Second):
+			close(release)
+			t.Fatal("сторож не сообщил о зависшей задаче")
+		}
+		if got.Label != "slow" || got.Worker <= 0 || got.Running < 30*time.Millisecond {
+			t.Errorf("получили %+v, ожидалась задача slow, выполняющаяся не меньше 30мс", got)
+		}
+
+		// следующие проверки о той же задаче не сообщают
+		time.Sleep(30 * time.Millisecond)
+		close(release)
+		wp.WaitIdle()
+		if n := len(stuck); n != 0 {
+			t.Errorf("о задаче сообщили повторно ещё %d раз", n)
+		}
+	})
+
+	t.Run("быстрые задачи не считаются зависшими", func(t *testing.T) {
+		var reports atomic.Int32
+		wp := NewWorkerPool(2, WithWatchdog(WatchdogConfig{
+			StuckThreshold: 50 * time.Millisecond,
+			Interval:       5 * time.Millisecond,
+			OnStuck:        func(StuckTask) { reports.Add(1) },
+		}))
+		defer wp.StopWait()
+
+		for range 50 {
+			_ = wp.SubmitBlocking(func() error {
+				time.Sleep(time.Millisecond)
+				return nil
+			})
+		}
+		wp.WaitIdle()
+		time.Sleep(60 * time.Millisecond)
+		if n := reports.Load(); n != 0 {
+			t.Errorf("ожидалось 0 сообщений, получили %d", n)
+		}
+	})
+
+	t.Run("без OnStuck пишет в лог с тегом задачи", func(t *testing.T) {
+		logger := &captureLogger{}
+		wp := NewWorkerPool(1, WithLogger(logger), WithWatchdog(WatchdogConfig{
+			StuckThreshold: 10 * time.Millisecond,
+		}))
+		defer wp.StopWait()
+
+		release := make(chan struct{})
+		_ = wp.SubmitTagged("import-42", func() error {
+			<-release
+			return nil
+		})
+		deadline := time.Now().Add(time.Second)
+		for logger.count("task stuck") == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		if n := logger.count("tag=import-42"); n != 1 {
+			t.Errorf("ожидалась одна запись о задаче import-42, получили %d: %v", n, logger.msgs)
+		}
+	})
+}
+
+func BenchmarkWorkerPool(b *testing.B) {
+	wp := NewWorkerPool(4)
+	defer wp.StopWait()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = wp.Submit(func() error {
+				time.Sleep(time.Microsecond)
+				return nil
+			})
+		}
+	})
+}
+
+func BenchmarkSubmitWait(b *testing.B) {
+	wp := NewWorkerPool(4)
+	defer wp.StopWait()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = wp.SubmitWait(func() error {
+			time.Sleep(time.Microsecond)
+			return nil
+		})
+	}
+}